@@ -2,6 +2,7 @@ package lc3
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -97,10 +98,12 @@ const (
 )
 
 const (
-	TrapGETC = uint8(0x20)
-	TrapOUT  = uint8(0x21)
-	TrapPUTS = uint8(0x22)
-	TrapHALT = uint8(0x25)
+	TrapGETC  = uint8(0x20)
+	TrapOUT   = uint8(0x21)
+	TrapPUTS  = uint8(0x22)
+	TrapIN    = uint8(0x23)
+	TrapPUTSP = uint8(0x24)
+	TrapHALT  = uint8(0x25)
 )
 
 const (
@@ -116,19 +119,49 @@ type VM struct {
 	output    io.Writer
 	input     *bufio.Reader
 	state     uint8
+	segments  []Segment
+	overflow  OverflowPolicy
+	traps     map[uint8]TrapHandler
+	devices   map[uint16]Device
+	tracers   []Tracer
+
+	// decoded caches decoded instructions of memory, allocated on first
+	// use. SetMemory invalidates the entries it overwrites.
+	decoded *[MemorySize]decoded
+	scratch decoded
+	engine  Engine
+	jit     *jit
+
+	psr        uint16
+	savedSSP   uint16
+	savedUSP   uint16
+	protection Protection
+	interrupts []interruptRequest
+	// interruptible tells whether a pending interrupt is above the priority
+	// level, to be serviced before the next instruction.
+	interruptible bool
+	// slow tells whether instructions go through the slow path of
+	// execInstruction, for the checks, timing, tracers or an interrupt.
+	slow bool
+
+	timing     *timing
+	shadow     *shadow
+	codeGuard  *codeGuard
+	stackGuard *stackGuard
+
+	micro        *microMachine
+	microTracers []MicroTracer
+
+	// inputPending tells that IN ran out of input after writing its prompt.
+	inputPending bool
+	// labels are the addresses of the symbols loaded, for CallLabel.
+	labels map[string]uint16
 }
 
 func (v *VM) GetMemory(address uint16) (uint16, error) {
-	if address == MemoryKBSR {
-		v.memory[MemoryKBSR] = 0
-		if v.peekChar() {
-			char, err := v.getChar()
-			if err != nil {
-				return 0, fmt.Errorf("peeked char, but couldn't read it: %v", err)
-			}
-
-			v.memory[MemoryKBSR] = (1 << 15)
-			v.memory[MemoryKBDR] = uint16(char)
+	if address > UserMemoryLimit {
+		if device, ok := v.devices[address]; ok {
+			return device.Read(address)
 		}
 	}
 
@@ -139,27 +172,23 @@ func (v *VM) GetRegister(reg Register) uint16 {
 	return v.registers[reg]
 }
 
+// NewVM creates a VM running program. A nil input or output falls back to
+// os.Stdin or os.Stdout.
 func NewVM(program io.Reader, input io.Reader, output io.Writer) (*VM, error) {
+	return New(withStdio(input, output), WithProgram(program))
+}
+
+func withStdio(input io.Reader, output io.Writer) Option {
 	if output == nil {
 		output = os.Stdout
 	}
 	if input == nil {
 		input = os.Stdin
 	}
-	vm := &VM{input: bufio.NewReader(input), output: output, state: StateRunning}
-
-	// .ORIG / Start address.
-	if err := vm.readStart(program); err != nil {
-		return nil, err
-	}
-
-	if err := vm.readProgram(program); err != nil {
-		return nil, err
+	return func(o *options) {
+		WithInput(input)(o)
+		WithOutput(output)(o)
 	}
-
-	vm.registers[RegisterCOND] = FlagZ
-
-	return vm, nil
 }
 
 func (v *VM) State() uint8 {
@@ -167,278 +196,353 @@ func (v *VM) State() uint8 {
 }
 
 func (v *VM) Step() error {
-	if v.state != StateRunning {
-		return fmt.Errorf("VM State: %s", stateNames[v.state])
+	if err := v.checkRunning(); err != nil {
+		return err
+	}
+	if v.engine == EngineMicrocode {
+		return v.stepMicro()
 	}
 
 	return v.execInstruction()
 }
 
+func (v *VM) checkRunning() error {
+	if v.state != StateRunning {
+		return fmt.Errorf("VM State: %s", stateNames[v.state])
+	}
+	return nil
+}
+
+// runSlice is the number of instructions Run executes per call to RunFor.
+const runSlice = 1 << 16
+
+// Run executes instructions until the VM halts or fails. With an input
+// returning ErrNoInput, it returns that error when the program waits for
+// input; use RunFor to resume it later.
 func (v *VM) Run() error {
-	for v.State() == StateRunning {
-		if err := v.Step(); err != nil {
+	if v.state != StateRunning {
+		return v.Step()
+	}
+	for v.state == StateRunning {
+		if _, err := v.RunFor(runSlice); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (v *VM) execAdd(inst uint16) {
-	destination := Register((inst >> 9) & 0x7)
-	source1 := Register((inst >> 6) & 0x7)
-
-	var value uint16
-	if inst&0x0020 == 0 {
-		source2 := Register(inst & 0x7)
+// RunFor executes up to n instructions with the selected engine and returns
+// the number executed, stopping early when the VM halts or fails. Embedders
+// that can't block, such as a browser, call it repeatedly to yield between
+// slices, and feed input through a reader returning ErrNoInput: RunFor then
+// returns ErrNoInput, wrapped, with PC on the instruction waiting for input,
+// which executes on the next call once input is available.
+func (v *VM) RunFor(n int) (int, error) {
+	if err := v.checkRunning(); err != nil {
+		return 0, err
+	}
+	executed := 0
+	for executed < n && v.state == StateRunning {
+		switch v.engine {
+		case EngineJIT:
+			count, err := v.runBlock(n - executed)
+			if err != nil {
+				// The count includes the failing instruction.
+				return executed + count - 1, err
+			}
+			executed += count
+			continue
+		case EngineMicrocode:
+			if err := v.stepMicro(); err != nil {
+				return executed, err
+			}
+		default:
+			for ; executed < n && v.state == StateRunning; executed++ {
+				if err := v.execInstruction(); err != nil {
+					return executed, err
+				}
+			}
+			continue
+		}
+		executed++
+	}
+	return executed, nil
+}
 
-		value = v.GetRegister(source2)
-	} else {
-		value = signExtend(inst, 5)
+func (v *VM) execAdd(d *decoded) {
+	value := d.offset
+	if !d.imm {
+		value = v.registers[d.sr2]
 	}
 
-	v.SetRegister(destination, v.GetRegister(source1)+value)
-	v.updateFlags(destination)
+	v.registers[d.dr] = v.registers[d.sr1] + value
+	v.updateFlags(d.dr)
 }
 
+// execInstruction executes the instruction at PC. Without the features of
+// the slow path, nor memory protection, instructions of user memory are
+// executed straight from the predecoded cache.
 func (v *VM) execInstruction() error {
-	inst, err := v.GetMemory(v.GetRegister(RegisterPC))
-	if err != nil {
+	pc := v.registers[RegisterPC]
+	if v.slow || v.protection != ProtectionOff || pc > UserMemoryLimit || v.decoded == nil {
+		return v.execSlow()
+	}
+
+	d := &v.decoded[pc]
+	if !d.valid {
+		*d = decode(v.memory[pc])
+	}
+	if err := v.exec(d); err != nil {
+		_, err = v.handleException(pc, err)
 		return err
 	}
-	op := uint8((inst & 0xf000) >> 12)
+	if doIncrementPC(d.op) {
+		v.registers[RegisterPC]++
+	}
+	return nil
+}
 
-	if exec, ok := instructions[op]; ok {
-		if err := exec(v, inst); err != nil {
+// execSlow executes the instruction at PC, servicing interrupts first and
+// running the checks, timing and tracers enabled.
+func (v *VM) execSlow() error {
+	if v.interruptible {
+		if err := v.serviceInterrupt(); err != nil {
 			return err
 		}
-	} else {
-		return fmt.Errorf("Operation %q not implemented", opNames[op])
 	}
 
-	if doIncrementPC(op) {
-		v.incrementRegister(RegisterPC, 1)
+	pc := v.registers[RegisterPC]
+	d, err := v.fetch(pc)
+	taken := false
+	if err == nil {
+		if v.timing != nil {
+			v.memoryAccess(pc)
+			taken = d.op == OperationBR && v.registers[RegisterCOND]&d.nzp != 0
+		}
+		if v.codeGuard != nil {
+			err = v.checkFetch(pc, d.inst)
+		}
+		if v.shadow != nil && err == nil {
+			err = v.checkInitialized(pc, d)
+		}
+		if v.stackGuard != nil && err == nil {
+			err = v.checkStack(pc, d)
+		}
+		if err == nil {
+			err = v.exec(d)
+		}
+	}
+	if err != nil {
+		raised, err := v.handleException(pc, err)
+		if v.timing != nil {
+			if raised {
+				v.chargeException()
+			} else {
+				v.timing.waits = 0
+			}
+		}
+		return err
+	}
+
+	if doIncrementPC(d.op) {
+		v.registers[RegisterPC]++
+	}
+	if v.shadow != nil {
+		v.markInitialized(d)
+	}
+	if v.codeGuard != nil {
+		v.trackTransfer(pc)
+	}
+	if v.stackGuard != nil {
+		v.trackFrames(pc, d.inst)
+	}
+	if v.timing != nil {
+		v.chargeInstruction(d.op, taken)
+	}
+
+	for _, tracer := range v.tracers {
+		tracer.Trace(v, pc, d.inst)
 	}
 	return nil
 }
 
 func doIncrementPC(op uint8) bool {
-	return op != OperationJMP && op != OperationJSR
+	return op != OperationJMP && op != OperationJSR && op != OperationRTI
 }
 
 func (v *VM) updateFlags(reg Register) {
-	value := v.GetRegister(reg)
+	v.registers[RegisterCOND] = conditionCodes(v.registers[reg])
+}
 
-	flags := FlagP
+func conditionCodes(value uint16) uint16 {
 	if value == 0 {
-		flags = FlagZ
+		return FlagZ
 	} else if value>>15 == 1 {
-		flags = FlagN
+		return FlagN
 	}
-	v.SetRegister(RegisterCOND, flags)
+	return FlagP
 }
 
 func (v *VM) SetRegister(reg Register, value uint16) {
 	v.registers[reg] = value
+	if v.shadow != nil {
+		v.shadow.setRegister(reg)
+	}
 }
 
-func (v *VM) execAnd(inst uint16) {
-	destination := Register((inst >> 9) & 0x7)
-	source1 := Register((inst >> 6) & 0x7)
-
-	var value uint16
-	if inst&0x0020 == 0 {
-		source2 := Register(inst & 0x7)
-
-		value = v.GetRegister(source2)
-	} else {
-		value = signExtend(inst, 5)
+func (v *VM) execAnd(d *decoded) {
+	value := d.offset
+	if !d.imm {
+		value = v.registers[d.sr2]
 	}
 
-	v.SetRegister(destination, v.GetRegister(source1)&value)
-	v.updateFlags(destination)
+	v.registers[d.dr] = v.registers[d.sr1] & value
+	v.updateFlags(d.dr)
 }
 
-func (v *VM) execNot(inst uint16) error {
-	if inst&0x3f != 0x3f {
-		return fmt.Errorf("Invalid instruction: NOT bits 5-0 must be 1")
+var errInvalidNot = errors.New("Invalid instruction: NOT bits 5-0 must be 1")
+
+func (v *VM) execNot(d *decoded) error {
+	if d.inst&0x3f != 0x3f {
+		return errInvalidNot
 	}
-	destination := Register((inst >> 9) & 0x7)
-	source := Register((inst >> 6) & 0x7)
-	value := v.GetRegister(source) ^ 0xffff
 
-	v.SetRegister(destination, value)
-	v.updateFlags(destination)
+	v.registers[d.dr] = v.registers[d.sr1] ^ 0xffff
+	v.updateFlags(d.dr)
 	return nil
 }
 
-func (v *VM) execLoad(inst uint16, indirect bool) error {
-	destination := Register((inst >> 9) & 0x7)
-	offset := signExtend(inst, 9)
-	value, err := v.GetMemory(v.GetRegister(RegisterPC) + offset + 1)
+func (v *VM) execLoad(d *decoded, indirect bool) error {
+	value, err := v.readMemory(v.registers[RegisterPC] + d.offset + 1)
 	if err != nil {
 		return err
 	}
 	if indirect {
-		value, err = v.GetMemory(value)
+		value, err = v.readMemory(value)
 		if err != nil {
 			return err
 		}
 	}
 
-	v.SetRegister(destination, value)
-	v.updateFlags(destination)
+	v.registers[d.dr] = value
+	v.updateFlags(d.dr)
 	return nil
 }
 
-func (v *VM) execStore(inst uint16, indirect bool) error {
-	source := Register((inst >> 9) & 0x7)
-	offset := signExtend(inst, 9)
-	address := v.GetRegister(RegisterPC) + offset + 1
+func (v *VM) execStore(d *decoded, indirect bool) error {
+	address := v.registers[RegisterPC] + d.offset + 1
 	if indirect {
 		var err error
-		address, err = v.GetMemory(address)
+		address, err = v.readMemory(address)
 		if err != nil {
 			return err
 		}
 	}
 
-	v.SetMemory(address, v.GetRegister(source))
-	return nil
+	return v.writeMemory(address, v.registers[d.dr])
 }
 
-func (v *VM) execStoreRegister(inst uint16) error {
-	source := Register((inst >> 9) & 0x7)
-	base := Register((inst >> 6) & 0x7)
-	offset := signExtend(inst, 6)
-	address := v.GetRegister(base) + offset
-
-	v.SetMemory(address, v.GetRegister(source))
-	return nil
+func (v *VM) execStoreRegister(d *decoded) error {
+	return v.writeMemory(v.registers[d.sr1]+d.offset, v.registers[d.dr])
 }
 
 func (v *VM) SetMemory(address uint16, value uint16) {
 	v.memory[address] = value
+	if v.shadow != nil {
+		v.shadow.setMemory(address)
+	}
+	if v.decoded != nil {
+		v.decoded[address].valid = false
+	}
+	if v.jit != nil && v.jit.compiled[address] {
+		v.jit.invalidate(address)
+	}
 }
 
-func (v *VM) execLoadRegister(inst uint16) error {
-	destination := Register((inst >> 9) & 0x7)
-	base := Register((inst >> 6) & 0x7)
-	offset := signExtend(inst, 6)
-	value, err := v.GetMemory(v.GetRegister(base) + offset)
-	if err != nil {
+// writeMemory stores a value on behalf of an instruction, checking access
+// control and forwarding it to the device mapped at address if any.
+func (v *VM) writeMemory(address uint16, value uint16) error {
+	if err := v.checkAccess(address, true); err != nil {
 		return err
 	}
-
-	v.SetRegister(destination, value)
-	v.updateFlags(destination)
-	return nil
+	v.memoryAccess(address)
+	return v.store(address, value)
 }
 
-func (v *VM) execTrap(inst uint16) error {
-	trap := uint8(inst & 0x00ff)
-
-	switch trap {
-	case TrapGETC:
-		if err := v.trapGetc(); err != nil {
-			return err
-		}
-	case TrapOUT:
-		if err := v.trapOut(); err != nil {
-			return err
+// store writes value to memory or to the device mapped at address.
+func (v *VM) store(address uint16, value uint16) error {
+	if address > UserMemoryLimit {
+		if device, ok := v.devices[address]; ok {
+			return device.Write(address, value)
 		}
-	case TrapPUTS:
-		if err := v.trapPuts(); err != nil {
-			return err
-		}
-	case TrapHALT:
-		v.trapHalt()
-	default:
-		return fmt.Errorf("trap 0x%x not implemented", trap)
+	}
+
+	v.SetMemory(address, value)
+	if v.codeGuard != nil {
+		v.codeGuard.writers[address] = v.codeGuard.current
 	}
 	return nil
 }
 
-func (v *VM) execLoadEffectiveAddress(inst uint16) {
-	offset := signExtend(inst, 9)
-	reg := Register((inst >> 9) & 0x7)
+func (v *VM) execLoadRegister(d *decoded) error {
+	value, err := v.readMemory(v.registers[d.sr1] + d.offset)
+	if err != nil {
+		return err
+	}
 
-	v.SetRegister(reg, v.GetRegister(RegisterPC)+offset+1)
-	v.updateFlags(reg)
+	v.registers[d.dr] = value
+	v.updateFlags(d.dr)
+	return nil
 }
 
-func (v *VM) execBreak(inst uint16) {
-	offset := signExtend(inst, 9)
-	flags := (inst >> 9) & 0x7
+func (v *VM) execTrap(d *decoded) error {
+	trap := uint8(d.offset)
 
-	if v.registers[RegisterCOND]&flags != 0 {
-		v.incrementRegister(RegisterPC, offset)
+	handler, ok := v.traps[trap]
+	if !ok {
+		return fmt.Errorf("trap 0x%x not implemented", trap)
 	}
+	v.memoryAccess(uint16(trap))
+	return handler(v)
 }
 
-func (v *VM) execJump(inst uint16) {
-	baseRegister := Register((inst >> 6) & 0x7)
-
-	v.SetRegister(RegisterPC, v.GetRegister(baseRegister))
+func (v *VM) execLoadEffectiveAddress(d *decoded) {
+	v.registers[d.dr] = v.registers[RegisterPC] + d.offset + 1
+	v.updateFlags(d.dr)
 }
 
-func (v *VM) execJumpSubroutine(inst uint16) {
-	v.SetRegister(RegisterR7, v.GetRegister(RegisterPC)+1)
-
-	var destination uint16
-	if inst&0x800 == 0 {
-		baseRegister := Register((inst >> 6) & 0x7)
-		destination = v.GetRegister(baseRegister)
-	} else {
-		destination = v.GetRegister(RegisterPC) + signExtend(inst, 11) + 1
+func (v *VM) execBreak(d *decoded) {
+	if v.registers[RegisterCOND]&d.nzp != 0 {
+		v.registers[RegisterPC] += d.offset
 	}
-
-	v.SetRegister(RegisterPC, destination)
 }
 
-func (v *VM) incrementRegister(reg Register, value uint16) {
-	v.registers[reg] += value
+func (v *VM) execJump(d *decoded) {
+	v.registers[RegisterPC] = v.registers[d.sr1]
 }
 
-func (v *VM) readProgram(program io.Reader) error {
-	address := v.GetRegister(RegisterPC)
-
-	for {
-		value, err := readValue(program)
-		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-			return fmt.Errorf("Error reading the program: %v", err)
-		}
+func (v *VM) execJumpSubroutine(d *decoded) {
+	pc := v.registers[RegisterPC]
 
-		v.SetMemory(address, value)
-		if address == UserMemoryLimit {
-			return nil
-		}
-		address++
+	destination := v.registers[d.sr1]
+	if d.imm {
+		destination = pc + d.offset + 1
 	}
-}
 
-func (v *VM) readStart(program io.Reader) error {
-	pc, err := readValue(program)
-	if err != nil {
-		return fmt.Errorf("Failed to read orig value from program: %v", err)
-	}
+	v.registers[RegisterR7] = pc + 1
+	v.registers[RegisterPC] = destination
+}
 
-	v.registers[RegisterPC] = pc
-	return nil
+func (v *VM) incrementRegister(reg Register, value uint16) {
+	v.registers[reg] += value
 }
 
 func readValue(program io.Reader) (uint16, error) {
 	var buffer [2]byte
 
-	n, err := program.Read(buffer[:])
-	if err != nil {
+	if _, err := io.ReadFull(program, buffer[:]); err != nil {
 		return 0, err
 	}
-	if n != 2 {
-		return 0, fmt.Errorf("Expected 2 bytes, got 1")
-	}
 
 	return (uint16(buffer[0]) << 8) + uint16(buffer[1]), nil
 }
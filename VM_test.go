@@ -3,15 +3,49 @@ package lc3_test
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
 
-	"github.com/stretchr/testify/assert"
 	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
 )
 
+// newVMFunc creates a VM like lc3.NewVM.
+type newVMFunc func(program io.Reader, input io.Reader, output io.Writer) (*lc3.VM, error)
+
 func TestVM(t *testing.T) {
+	t.Run("NewVM", func(t *testing.T) {
+		testVM(t, lc3.NewVM)
+	})
+
+	engines := []struct {
+		name   string
+		engine lc3.Engine
+	}{
+		{"interpreter", lc3.EngineInterpreter},
+		{"jit", lc3.EngineJIT},
+		{"microcode", lc3.EngineMicrocode},
+	}
+
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			testVM(t, func(program io.Reader, input io.Reader, output io.Writer) (*lc3.VM, error) {
+				opts := []lc3.Option{lc3.WithEngine(e.engine)}
+				if input != nil {
+					opts = append(opts, lc3.WithInput(input))
+				}
+				if output != nil {
+					opts = append(opts, lc3.WithOutput(output))
+				}
+				return lc3.New(append(opts, lc3.WithProgram(program))...)
+			})
+		})
+	}
+}
+
+func testVM(t *testing.T, newVM newVMFunc) {
 	t.Run("try to load erroneous programs", func(t *testing.T) {
 		testCases := []string{
 			"",
@@ -22,7 +56,7 @@ func TestVM(t *testing.T) {
 		for i, test := range testCases {
 			t.Run(fmt.Sprintf("test case #%d", i), func(t *testing.T) {
 				program := strings.NewReader(test)
-				_, err := lc3.NewVM(program, nil, nil)
+				_, err := newVM(program, nil, nil)
 				assert.Error(t, err)
 			})
 		}
@@ -32,7 +66,7 @@ func TestVM(t *testing.T) {
 		var pc uint16 = 0x3000
 		program := strings.NewReader("\x30\x00")
 
-		vm, err := lc3.NewVM(program, nil, nil)
+		vm, err := newVM(program, nil, nil)
 		assert.NoError(t, err)
 		assertInitVM(t, vm, pc)
 	})
@@ -41,7 +75,7 @@ func TestVM(t *testing.T) {
 		var start uint16 = 0x3000
 		program := strings.NewReader("\x30\x00\x12\x34")
 
-		vm, err := lc3.NewVM(program, nil, nil)
+		vm, err := newVM(program, nil, nil)
 		assert.NoError(t, err)
 		assert.Equal(t, start, vm.GetRegister(lc3.RegisterPC))
 		val, err := vm.GetMemory(start)
@@ -110,7 +144,7 @@ func TestVM(t *testing.T) {
 			t.Run(test.name, func(t *testing.T) {
 				program := strings.NewReader("\x30\x00" + test.instruction)
 
-				vm, err := lc3.NewVM(program, nil, nil)
+				vm, err := newVM(program, nil, nil)
 				assert.NoError(t, err)
 				vm.SetMemory(canaryAddress, canaryValue)
 
@@ -128,7 +162,7 @@ func TestVM(t *testing.T) {
 	t.Run("test NOT instruction with invalid trailing bits", func(t *testing.T) {
 		program := strings.NewReader("\x30\x00\x90\x00") // NOT R0, R0 with invalid trailing bits
 
-		vm, err := lc3.NewVM(program, nil, nil)
+		vm, err := newVM(program, nil, nil)
 		assert.NoError(t, err)
 
 		err = vm.Step()
@@ -157,7 +191,7 @@ func TestVM(t *testing.T) {
 			t.Run(test.name, func(t *testing.T) {
 				program := strings.NewReader("\x30\x00" + test.instruction)
 
-				vm, err := lc3.NewVM(program, nil, nil)
+				vm, err := newVM(program, nil, nil)
 				assert.NoError(t, err)
 
 				err = vm.Step()
@@ -177,7 +211,7 @@ func TestVM(t *testing.T) {
 		program := strings.NewReader("\x30\x00\xE0\x01\xf0\x22\x00\x41\x00\x00")
 
 		output := bytes.NewBuffer([]byte{})
-		vm, err := lc3.NewVM(program, nil, output)
+		vm, err := newVM(program, nil, output)
 		assert.NoError(t, err)
 
 		// LEA R0, x3002
@@ -196,7 +230,7 @@ func TestVM(t *testing.T) {
 		program := strings.NewReader("\x30\x00\xE0\x01\xf0\x22\x00\x41\x01\x00") // LEA R0, x3002; PUTS; 'A', 0x0100 (invalid)
 
 		output := bytes.NewBuffer([]byte{})
-		vm, err := lc3.NewVM(program, nil, output)
+		vm, err := newVM(program, nil, output)
 		assert.NoError(t, err)
 
 		// LEA R0, x3002
@@ -211,7 +245,7 @@ func TestVM(t *testing.T) {
 	t.Run("test HALT trap", func(t *testing.T) {
 		program := strings.NewReader("\x30\x00\xf0\x25\x00\x00")
 
-		vm, err := lc3.NewVM(program, nil, nil)
+		vm, err := newVM(program, nil, nil)
 		assert.NoError(t, err)
 
 		err = vm.Step()
@@ -230,7 +264,7 @@ func TestVM(t *testing.T) {
 		want := 'O'
 		input := strings.NewReader(string(want))
 
-		vm, err := lc3.NewVM(program, input, nil)
+		vm, err := newVM(program, input, nil)
 		assert.NoError(t, err)
 		// To make sure that top bytes are also cleared.
 		vm.SetRegister(lc3.RegisterR0, 0x1234)
@@ -247,7 +281,7 @@ func TestVM(t *testing.T) {
 		want := byte(0x41)
 
 		output := bytes.NewBuffer([]byte{})
-		vm, err := lc3.NewVM(program, nil, output)
+		vm, err := newVM(program, nil, output)
 		assert.NoError(t, err)
 		vm.SetRegister(lc3.RegisterR0, uint16(want))
 
@@ -256,12 +290,44 @@ func TestVM(t *testing.T) {
 		assert.Equal(t, string([]byte{0x41}), output.String())
 	})
 
+	t.Run("test IN trap", func(t *testing.T) {
+		program := strings.NewReader("\x30\x00\xf0\x23")
+		input := strings.NewReader("q")
+
+		output := bytes.NewBuffer([]byte{})
+		vm, err := newVM(program, input, output)
+		assert.NoError(t, err)
+
+		err = vm.Step()
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, uint16('q'), vm.GetRegister(lc3.RegisterR0))
+		// The prompt, then the character echoed.
+		assert.Equal(t, "Enter a character: q", output.String())
+	})
+
+	t.Run("test PUTSP trap", func(t *testing.T) {
+		// LEA R0, x3002; PUTSP; "Hi!" packed two characters per word
+		program := strings.NewReader("\x30\x00\xE0\x01\xf0\x24\x69\x48\x00\x21\x00\x00")
+
+		output := bytes.NewBuffer([]byte{})
+		vm, err := newVM(program, nil, output)
+		assert.NoError(t, err)
+
+		err = vm.Step()
+		assert.NoError(t, err)
+		err = vm.Step()
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0x3002), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, "Hi!", output.String())
+	})
+
 	t.Run("execute hello-world.obj program", func(t *testing.T) {
 		f, closer := openTestfile(t, "testdata/hello-world.obj")
 		defer closer()
 
 		output := bytes.NewBuffer([]byte{})
-		vm, err := lc3.NewVM(f, nil, output)
+		vm, err := newVM(f, nil, output)
 		assert.NoError(t, err)
 
 		var start uint16 = 0x3000
@@ -292,7 +358,7 @@ func TestVM(t *testing.T) {
 		f, closer := openTestfile(t, "testdata/loop.obj")
 		defer closer()
 
-		vm, err := lc3.NewVM(f, nil, nil)
+		vm, err := newVM(f, nil, nil)
 		assert.NoError(t, err)
 
 		err = vm.Run()
@@ -309,7 +375,7 @@ func TestVM(t *testing.T) {
 		defer closer()
 
 		output := bytes.NewBuffer([]byte{})
-		vm, err := lc3.NewVM(f, nil, output)
+		vm, err := newVM(f, nil, output)
 		assert.NoError(t, err)
 
 		err = vm.Run()
@@ -318,12 +384,25 @@ func TestVM(t *testing.T) {
 		assert.Equal(t, lc3.StateHalted, vm.State())
 	})
 
+	t.Run("execute self-modifying code", func(t *testing.T) {
+		// ADD R0, R0, #1; LD R1, x3005; ST R1, x3000; BRnzp x3000; HALT; .FILL xF025 (HALT)
+		program := strings.NewReader("\x30\x00\x10\x21\x22\x03\x33\xFD\x0F\xFC\xF0\x25\xF0\x25")
+
+		vm, err := newVM(program, nil, nil)
+		assert.NoError(t, err)
+
+		err = vm.Run()
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+	})
+
 	t.Run("test KBSR/KBDR memory registers", func(t *testing.T) {
 		program := strings.NewReader("\x30\x00")
 		want := 'A'
 		input := strings.NewReader(string(want))
 
-		vm, err := lc3.NewVM(program, input, nil)
+		vm, err := newVM(program, input, nil)
 		assert.NoError(t, err)
 
 		// On memory read, KBSR highest-bit is set, KBDR contains wanted character.
@@ -368,4 +447,81 @@ func openTestfile(t *testing.T, name string) (*os.File, func() error) {
 	assert.NoError(t, err)
 
 	return f, f.Close
-}
\ No newline at end of file
+}
+
+// pendingInput is an input that doesn't block, returning lc3.ErrNoInput until
+// characters are added.
+type pendingInput struct {
+	data []byte
+}
+
+func (r *pendingInput) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, lc3.ErrNoInput
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestRunFor(t *testing.T) {
+	engines := map[string]lc3.Engine{
+		"interpreter": lc3.EngineInterpreter,
+		"jit":         lc3.EngineJIT,
+		"microcode":   lc3.EngineMicrocode,
+	}
+	for name, engine := range engines {
+		t.Run(name, func(t *testing.T) {
+			t.Run("runs at most n instructions", func(t *testing.T) {
+				// ADD R0, R0, #1 x4, then loop.
+				vm, err := lc3.New(lc3.WithEngine(engine), lc3.WithMemory(0x3000, 0x1021, 0x1021, 0x1021, 0x1021, 0x0ffb))
+				assert.NoError(t, err)
+
+				n, err := vm.RunFor(3)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, n)
+				assert.Equal(t, uint16(3), vm.GetRegister(lc3.RegisterR0))
+				assert.Equal(t, uint16(0x3003), vm.GetRegister(lc3.RegisterPC))
+
+				n, err = vm.RunFor(7)
+				assert.NoError(t, err)
+				assert.Equal(t, 7, n)
+				assert.Equal(t, uint16(8), vm.GetRegister(lc3.RegisterR0))
+			})
+
+			t.Run("stops on HALT", func(t *testing.T) {
+				vm, err := lc3.New(lc3.WithEngine(engine), lc3.WithMemory(0x3000, 0x1021, 0xf025))
+				assert.NoError(t, err)
+
+				n, err := vm.RunFor(100)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, n)
+				assert.Equal(t, lc3.StateHalted, vm.State())
+			})
+
+			t.Run("waits for input", func(t *testing.T) {
+				// ADD R0, R0, #1; IN; OUT; HALT.
+				input := &pendingInput{}
+				var output bytes.Buffer
+				vm, err := lc3.New(lc3.WithEngine(engine), lc3.WithInput(input), lc3.WithOutput(&output),
+					lc3.WithMemory(0x3000, 0x1021, 0xf023, 0xf021, 0xf025))
+				assert.NoError(t, err)
+
+				for i := 0; i < 2; i++ {
+					n, err := vm.RunFor(100)
+					assert.ErrorIs(t, err, lc3.ErrNoInput)
+					assert.Equal(t, 1-i, n)
+					assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+					assert.Equal(t, lc3.StateRunning, vm.State())
+				}
+
+				input.data = []byte("a")
+				n, err := vm.RunFor(100)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, n)
+				assert.Equal(t, lc3.StateHalted, vm.State())
+				assert.Equal(t, "Enter a character: aa", output.String())
+			})
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package lc3_test
+
+import (
+	"os"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// loopVM loads loop.obj with its HALT replaced by a branch back to the start,
+// so that it runs forever.
+func loopVM(b *testing.B, opts ...lc3.Option) *lc3.VM {
+	b.Helper()
+
+	f, err := os.Open("testdata/loop.obj")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	vm, err := lc3.New(append(opts, lc3.WithProgram(f))...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm.SetMemory(0x3004, 0x0ffb) // BRnzp x3000
+	return vm
+}
+
+// BenchmarkStep compares decoding each instruction as it is executed with
+// the predecoded instructions the interpreter caches.
+func BenchmarkStep(b *testing.B) {
+	for _, cached := range []bool{false, true} {
+		name := "uncached"
+		if cached {
+			name = "predecoded"
+		}
+		b.Run(name, func(b *testing.B) {
+			vm := loopVM(b)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !cached {
+					vm.Uncache(vm.GetRegister(lc3.RegisterPC))
+				}
+				if err := vm.Step(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "inst/s")
+		})
+	}
+}
+
+func BenchmarkJIT(b *testing.B) {
+	vm := loopVM(b, lc3.WithEngine(lc3.EngineJIT))
+
+	instructions := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := vm.StepBlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+		instructions += n
+	}
+	b.ReportMetric(float64(instructions)/b.Elapsed().Seconds(), "inst/s")
+}
+
+// BenchmarkRun compares the throughput of the engines running loop.obj with
+// the dispatch loop of the VM before instructions were predecoded.
+func BenchmarkRun(b *testing.B) {
+	b.Run("legacy", func(b *testing.B) {
+		vm := loopVM(b)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := vm.LegacyStep(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "inst/s")
+	})
+
+	for _, engine := range []struct {
+		name   string
+		engine lc3.Engine
+	}{
+		{"interpreter", lc3.EngineInterpreter},
+		{"jit", lc3.EngineJIT},
+	} {
+		b.Run(engine.name, func(b *testing.B) {
+			vm := loopVM(b, lc3.WithEngine(engine.engine))
+
+			b.ResetTimer()
+			if _, err := vm.RunFor(b.N); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "inst/s")
+		})
+	}
+}
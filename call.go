@@ -0,0 +1,96 @@
+package lc3
+
+import "fmt"
+
+// CallSentinel is the return address Call plants in R7. It is in the device
+// registers space, where no subroutine legitimately jumps.
+const CallSentinel = uint16(0xffff)
+
+// MemoryChange is a memory word changed by a call.
+type MemoryChange struct {
+	Address  uint16
+	Old, New uint16
+}
+
+// CallResult is the state of the VM once a subroutine returned.
+type CallResult struct {
+	// Registers are indexed by Register; PC is CallSentinel.
+	Registers    [RegisterCOUNT]uint16
+	Memory       []MemoryChange
+	Instructions uint64
+}
+
+// Call runs the subroutine at address until it returns to CallSentinel, for
+// at most limit instructions if limit isn't 0. Arguments are set beforehand
+// with SetRegister and SetMemory, including R6 if the subroutine uses a
+// stack.
+//
+// The VM keeps the state left by the subroutine. On error, e.g. if the
+// program halts before returning, the result holds the state at that point.
+func (v *VM) Call(address uint16, limit uint64) (*CallResult, error) {
+	if err := v.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	before := v.memory
+	v.SetRegister(RegisterR7, CallSentinel)
+	v.SetRegister(RegisterPC, address)
+	r := &CallResult{}
+	var err error
+	for v.registers[RegisterPC] != CallSentinel {
+		if limit != 0 && r.Instructions == limit {
+			err = fmt.Errorf("subroutine at x%04X didn't return within %d instructions", address, limit)
+			break
+		}
+		if v.state != StateRunning {
+			err = fmt.Errorf("subroutine at x%04X halted before returning", address)
+			break
+		}
+		if err = v.Step(); err != nil {
+			break
+		}
+		r.Instructions++
+	}
+
+	r.Registers = v.registers
+	for i := range v.memory {
+		if v.memory[i] != before[i] {
+			r.Memory = append(r.Memory, MemoryChange{Address: uint16(i), Old: before[i], New: v.memory[i]})
+		}
+	}
+	return r, err
+}
+
+// CallLabel runs the subroutine at label like Call. Labels are the symbols of
+// the objects loaded and those added with WithSymbols or AddSymbols.
+func (v *VM) CallLabel(label string, limit uint64) (*CallResult, error) {
+	address, ok := v.labels[label]
+	if !ok {
+		return nil, fmt.Errorf("unknown label %q", label)
+	}
+	return v.Call(address, limit)
+}
+
+// WithSymbols adds labels for CallLabel, e.g. read from the .sym file of an
+// image without symbols.
+func WithSymbols(symbols ...Symbol) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			v.AddSymbols(symbols...)
+			return nil
+		})
+	}
+}
+
+// AddSymbols adds labels for CallLabel, ignoring external symbols.
+func (v *VM) AddSymbols(symbols ...Symbol) {
+	for _, sym := range symbols {
+		if sym.Kind == SymbolExternal {
+			continue
+		}
+		if v.labels == nil {
+			v.labels = map[string]uint16{}
+		}
+		v.labels[sym.Name] = sym.Address
+	}
+}
@@ -0,0 +1,123 @@
+package lc3_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCall(t *testing.T) {
+	t.Run("call a subroutine with arguments", func(t *testing.T) {
+		// MAIN: HALT
+		// DOUBLE: ADD R0, R0, R0; ST R0, RESULT; RET
+		// RESULT: .BLKW 1
+		vm, err := lc3.New(lc3.WithMemory(0x3000, 0xf025, 0x1000, 0x3001, 0xc1c0, 0x0000))
+		require.NoError(t, err)
+
+		vm.SetRegister(lc3.RegisterR0, 21)
+		r, err := vm.Call(0x3001, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(42), r.Registers[lc3.RegisterR0])
+		assert.Equal(t, lc3.CallSentinel, r.Registers[lc3.RegisterPC])
+		assert.Equal(t, lc3.CallSentinel, r.Registers[lc3.RegisterR7])
+		assert.Equal(t, []lc3.MemoryChange{{Address: 0x3004, Old: 0, New: 42}}, r.Memory)
+		assert.Equal(t, uint64(3), r.Instructions)
+
+		// The VM may be called again.
+		r, err = vm.Call(0x3001, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(84), r.Registers[lc3.RegisterR0])
+	})
+
+	t.Run("call the string reversal of reverse-string", func(t *testing.T) {
+		f, err := os.Open("testdata/reverse-string.obj")
+		require.NoError(t, err)
+		defer f.Close()
+		vm, err := lc3.New(lc3.WithProgram(f))
+		require.NoError(t, err)
+
+		// Return at DONE2 instead of printing the string, and reverse "abc"
+		// instead of FILE.
+		vm.SetMemory(0x3012, 0xc1c0)
+		for i, c := range "abc\x00" {
+			vm.SetMemory(0x3015+uint16(i), uint16(c))
+		}
+		r, err := vm.Call(0x3000, 1000)
+		require.NoError(t, err)
+		assert.Equal(t, []lc3.MemoryChange{
+			{Address: 0x3015, Old: 'a', New: 'c'},
+			{Address: 0x3017, Old: 'c', New: 'a'},
+		}, r.Memory)
+		assert.Equal(t, uint16(0x3016), r.Registers[lc3.RegisterR0])
+	})
+
+	t.Run("call a label of reverse-string", func(t *testing.T) {
+		f, err := os.Open("testdata/reverse-string.obj")
+		require.NoError(t, err)
+		defer f.Close()
+		symbols, err := lc3.ReadSymbolFile(strings.NewReader("//	rev   3000\n//	DONE2 3012\n//	FILE  3015\n"))
+		require.NoError(t, err)
+		vm, err := lc3.New(lc3.WithProgram(f), lc3.WithSymbols(symbols...))
+		require.NoError(t, err)
+
+		vm.SetMemory(0x3012, 0xc1c0) // DONE2: RET
+		for i, c := range "ab\x00" {
+			vm.SetMemory(0x3015+uint16(i), uint16(c))
+		}
+		r, err := vm.CallLabel("rev", 1000)
+		require.NoError(t, err)
+		assert.Equal(t, []lc3.MemoryChange{
+			{Address: 0x3015, Old: 'a', New: 'b'},
+			{Address: 0x3016, Old: 'b', New: 'a'},
+		}, r.Memory)
+
+		_, err = vm.CallLabel("REV", 1000)
+		assert.EqualError(t, err, `unknown label "REV"`)
+	})
+
+	t.Run("call the labels of a loaded object", func(t *testing.T) {
+		obj := &lc3.Object{
+			// MAIN: HALT; INC: ADD R0, R0, #1; RET
+			Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{0xf025, 0x1021, 0xc1c0}}},
+			Symbols:  []lc3.Symbol{{Name: "INC", Address: 0x3001, Kind: lc3.SymbolGlobal}},
+		}
+		vm, err := lc3.New(lc3.WithObject(obj))
+		require.NoError(t, err)
+
+		r, err := vm.CallLabel("INC", 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(1), r.Registers[lc3.RegisterR0])
+	})
+
+	t.Run("call a subroutine with the sanitizer", func(t *testing.T) {
+		// MAIN: HALT; INC: ADD R0, R0, #1; RET
+		vm, err := lc3.New(lc3.WithSanitizer(lc3.CheckError), lc3.WithMemory(0x3000, 0xf025, 0x1021, 0xc1c0))
+		require.NoError(t, err)
+
+		vm.SetRegister(lc3.RegisterR0, 41)
+		r, err := vm.Call(0x3001, 0)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(42), r.Registers[lc3.RegisterR0])
+	})
+
+	t.Run("fail if the subroutine halts or doesn't return", func(t *testing.T) {
+		// HALT; BR #-1
+		vm, err := lc3.New(lc3.WithMemory(0x3000, 0xf025, 0x0fff))
+		require.NoError(t, err)
+
+		r, err := vm.Call(0x3001, 100)
+		assert.EqualError(t, err, "subroutine at x3001 didn't return within 100 instructions")
+		assert.Equal(t, uint64(100), r.Instructions)
+
+		r, err = vm.Call(0x3000, 0)
+		assert.EqualError(t, err, "subroutine at x3000 halted before returning")
+		assert.Equal(t, uint64(1), r.Instructions)
+
+		_, err = vm.Call(0x3000, 0)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,174 @@
+package lc3
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultSavedRegisters are the registers subroutines must preserve unless
+// told otherwise: R0 holds return values, R6 is checked as the stack pointer
+// and R7 through the return address.
+var DefaultSavedRegisters = []Register{RegisterR1, RegisterR2, RegisterR3, RegisterR4, RegisterR5}
+
+// ViolationKind is a kind of calling convention violation.
+type ViolationKind uint8
+
+const (
+	// ViolationClobber is a saved register changed by a subroutine.
+	ViolationClobber ViolationKind = iota
+	// ViolationStack is R6 differing between entry and return.
+	ViolationStack
+	// ViolationReturn is a RET to an address other than the return site of
+	// the subroutine, e.g. after R7 was clobbered by a nested call.
+	ViolationReturn
+)
+
+// Violation is a calling convention violation, counted once per RET
+// instruction, kind and register.
+type Violation struct {
+	Kind ViolationKind
+	// Subroutine is the entry of the returning subroutine, if any.
+	Subroutine   uint16
+	InSubroutine bool
+	// At is the address of the RET.
+	At       uint16
+	Register Register
+	// Expected and Actual are the register values on entry and return, or
+	// the expected and actual return addresses, when first detected.
+	Expected, Actual uint16
+	Count            uint64
+}
+
+// CallChecker is a tracer checking that subroutines, entered with JSR or
+// JSRR and left with RET, preserve saved registers, leave the stack pointer
+// as they found it and return where they were called from.
+type CallChecker struct {
+	symbols *SymbolTable
+	saved   []Register
+	frames  []callFrame
+	// violations are keyed by kind, RET address and register.
+	violations map[[3]uint16]*Violation
+}
+
+// callFrame is a pending subroutine call.
+type callFrame struct {
+	entry     uint16
+	ret       uint16
+	registers [RegisterCOUNT]uint16
+}
+
+// NewCallChecker returns a checker of the saved registers, or of
+// DefaultSavedRegisters if nil, naming subroutines with symbols.
+func NewCallChecker(saved []Register, symbols ...Symbol) *CallChecker {
+	if saved == nil {
+		saved = DefaultSavedRegisters
+	}
+	return &CallChecker{symbols: NewSymbolTable(symbols...), saved: saved, violations: map[[3]uint16]*Violation{}}
+}
+
+func (c *CallChecker) Trace(v *VM, pc uint16, inst uint16) {
+	switch {
+	case inst>>12 == OperationJSR:
+		frame := callFrame{entry: v.GetRegister(RegisterPC), ret: pc + 1}
+		for reg := range frame.registers {
+			frame.registers[reg] = v.GetRegister(Register(reg))
+		}
+		c.frames = append(c.frames, frame)
+	case inst == instRET:
+		c.ret(v, pc)
+	}
+}
+
+func (c *CallChecker) ret(v *VM, pc uint16) {
+	target := v.GetRegister(RegisterPC)
+	if len(c.frames) == 0 {
+		c.record(Violation{Kind: ViolationReturn, At: pc, Actual: target})
+		return
+	}
+
+	frame := c.frames[len(c.frames)-1]
+	if target != frame.ret {
+		c.record(Violation{Kind: ViolationReturn, Subroutine: frame.entry, InSubroutine: true, At: pc,
+			Expected: frame.ret, Actual: target})
+		// Unwind to a caller returning there, if any.
+		for i := len(c.frames) - 2; i >= 0; i-- {
+			if c.frames[i].ret == target {
+				c.frames = c.frames[:i]
+				break
+			}
+		}
+		return
+	}
+
+	c.frames = c.frames[:len(c.frames)-1]
+	for _, reg := range c.saved {
+		if entry, exit := frame.registers[reg], v.GetRegister(reg); entry != exit {
+			c.record(Violation{Kind: ViolationClobber, Subroutine: frame.entry, InSubroutine: true, At: pc,
+				Register: reg, Expected: entry, Actual: exit})
+		}
+	}
+	if entry, exit := frame.registers[RegisterR6], v.GetRegister(RegisterR6); entry != exit {
+		c.record(Violation{Kind: ViolationStack, Subroutine: frame.entry, InSubroutine: true, At: pc,
+			Register: RegisterR6, Expected: entry, Actual: exit})
+	}
+}
+
+func (c *CallChecker) record(violation Violation) {
+	key := [3]uint16{uint16(violation.Kind), violation.At, uint16(violation.Register)}
+	if v := c.violations[key]; v != nil {
+		v.Count++
+		return
+	}
+	violation.Count = 1
+	c.violations[key] = &violation
+}
+
+// Violations returns the violations found, by RET address.
+func (c *CallChecker) Violations() []Violation {
+	violations := make([]Violation, 0, len(c.violations))
+	for _, v := range c.violations {
+		violations = append(violations, *v)
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.At != b.At {
+			return a.At < b.At
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Register < b.Register
+	})
+	return violations
+}
+
+// WriteReport writes one line per violation.
+func (c *CallChecker) WriteReport(w io.Writer) error {
+	var b strings.Builder
+	for _, v := range c.Violations() {
+		if v.InSubroutine {
+			fmt.Fprintf(&b, "%s: ", c.symbols.Name(v.Subroutine))
+		}
+		fmt.Fprintf(&b, "RET at x%04X ", v.At)
+		switch v.Kind {
+		case ViolationClobber:
+			fmt.Fprintf(&b, "clobbers %s: x%04X on entry, x%04X on return", v.Register, v.Expected, v.Actual)
+		case ViolationStack:
+			fmt.Fprintf(&b, "unbalances the stack: R6 x%04X on entry, x%04X on return", v.Expected, v.Actual)
+		case ViolationReturn:
+			if v.InSubroutine {
+				fmt.Fprintf(&b, "returns to x%04X instead of x%04X", v.Actual, v.Expected)
+			} else {
+				fmt.Fprintf(&b, "returns to x%04X outside of any subroutine", v.Actual)
+			}
+		}
+		if v.Count > 1 {
+			fmt.Fprintf(&b, " (%d times)", v.Count)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
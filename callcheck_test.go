@@ -0,0 +1,71 @@
+package lc3_test
+
+import (
+	"bytes"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallChecker(t *testing.T) {
+	check := func(t *testing.T, saved []lc3.Register, words ...uint16) *lc3.CallChecker {
+		checker := lc3.NewCallChecker(saved, lc3.Symbol{Name: "BAD", Address: 0x3006}, lc3.Symbol{Name: "NESTED", Address: 0x3009})
+		vm, err := lc3.New(
+			lc3.WithTracer(checker),
+			lc3.WithRegister(lc3.RegisterR6, 0xfe00),
+			lc3.WithMemory(0x3000, words...),
+		)
+		require.NoError(t, err)
+		require.NoError(t, vm.Run())
+		return checker
+	}
+	// MAIN: JSR GOOD; JSR BAD; JSR NESTED; HALT
+	// GOOD: ADD R0, R0, #1; RET
+	// BAD: ADD R1, R1, #1; ADD R6, R6, #-1; RET
+	// NESTED: LEA R7, END; RET
+	// END: HALT
+	program := []uint16{0x4803, 0x4804, 0x4806, 0xf025, 0x1021, 0xc1c0, 0x1261, 0x1dbf, 0xc1c0, 0xee01, 0xc1c0, 0xf025}
+
+	t.Run("report clobbers, stack imbalance and bad returns", func(t *testing.T) {
+		checker := check(t, nil, program...)
+		assert.Equal(t, []lc3.Violation{
+			{Kind: lc3.ViolationClobber, Subroutine: 0x3006, InSubroutine: true, At: 0x3008,
+				Register: lc3.RegisterR1, Expected: 0, Actual: 1, Count: 1},
+			{Kind: lc3.ViolationStack, Subroutine: 0x3006, InSubroutine: true, At: 0x3008,
+				Register: lc3.RegisterR6, Expected: 0xfe00, Actual: 0xfdff, Count: 1},
+			{Kind: lc3.ViolationReturn, Subroutine: 0x3009, InSubroutine: true, At: 0x300a,
+				Expected: 0x3003, Actual: 0x300b, Count: 1},
+		}, checker.Violations())
+
+		var report bytes.Buffer
+		require.NoError(t, checker.WriteReport(&report))
+		assert.Equal(t, "BAD: RET at x3008 clobbers R1: x0000 on entry, x0001 on return\n"+
+			"BAD: RET at x3008 unbalances the stack: R6 xFE00 on entry, xFDFF on return\n"+
+			"NESTED: RET at x300A returns to x300B instead of x3003\n", report.String())
+	})
+
+	t.Run("check the given saved registers", func(t *testing.T) {
+		checker := check(t, []lc3.Register{lc3.RegisterR0}, program...)
+		violations := checker.Violations()
+		require.Len(t, violations, 3)
+		assert.Equal(t, lc3.RegisterR0, violations[0].Register)
+		assert.Equal(t, uint16(0x3005), violations[0].At)
+	})
+
+	t.Run("accept subroutines saving registers", func(t *testing.T) {
+		// MAIN: JSR SUB; HALT
+		// SUB: ADD R6, R6, #-1; STR R7, R6, #0; JSR LEAF; LDR R7, R6, #0; ADD R6, R6, #1; RET
+		// LEAF: RET
+		checker := check(t, nil, 0x4801, 0xf025, 0x1dbf, 0x7f80, 0x4802, 0x6f80, 0x1da1, 0xc1c0, 0xc1c0)
+		assert.Empty(t, checker.Violations())
+	})
+
+	t.Run("count returns outside of subroutines", func(t *testing.T) {
+		// LEA R7, #1; RET; HALT
+		checker := check(t, nil, 0xee01, 0xc1c0, 0xf025)
+		assert.Equal(t, []lc3.Violation{{Kind: lc3.ViolationReturn, At: 0x3001, Actual: 0x3002, Count: 1}},
+			checker.Violations())
+	})
+}
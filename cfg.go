@@ -0,0 +1,514 @@
+package lc3
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// EdgeKind is the way control flows from a basic block to another.
+type EdgeKind uint8
+
+const (
+	// taken and the return site of a call of a subroutine that returns.
+	// taken and the return site of a call.
+	EdgeFallthrough EdgeKind = iota
+	// EdgeBranch is a branch taken.
+	EdgeBranch
+	// EdgeCall is a JSR to a subroutine.
+	EdgeCall
+	// EdgeReturn is a RET to the return site of a call of its subroutine.
+	EdgeReturn
+	// EdgeTrap is the instruction after a TRAP, once serviced. HALT has no
+	// successor.
+	EdgeTrap
+)
+
+var edgeNames = [...]string{
+	EdgeFallthrough: "fallthrough",
+	EdgeBranch:      "branch",
+	EdgeCall:        "call",
+	EdgeReturn:      "return",
+	EdgeTrap:        "trap",
+}
+
+func (k EdgeKind) String() string {
+	if int(k) < len(edgeNames) {
+		return edgeNames[k]
+	}
+	return fmt.Sprintf("EdgeKind(%d)", k)
+}
+
+// Edge links two basic blocks, given by their start addresses.
+type Edge struct {
+	From, To uint16
+	Kind     EdgeKind
+}
+
+// BasicBlock is a run of instructions entered at its first one and left
+// at its last one.
+type BasicBlock struct {
+	Start uint16
+	Words []uint16
+	Succs []Edge
+	// Indirect tells the block ends with a JMP or JSRR, whose target isn't
+	// known statically.
+	Indirect bool
+}
+
+// Last returns the address of the last instruction of the block.
+func (b *BasicBlock) Last() uint16 {
+	return b.Start + uint16(len(b.Words)) - 1
+}
+
+// IssueKind is a kind of problem found in reachable code.
+type IssueKind uint8
+
+const (
+	// IssueIllegal is a reachable word that isn't a valid instruction.
+	IssueIllegal IssueKind = iota
+	// IssueUnloaded is a reachable address outside the image.
+	IssueUnloaded
+	// IssueDataReference is a reachable instruction also read or written
+	// as data by LD, LDI, ST or STI.
+	IssueDataReference
+)
+
+// CodeIssue is data found in code: an address both reachable and used, or
+// looking, as data.
+type CodeIssue struct {
+	Kind    IssueKind
+	Address uint16
+	Word    uint16
+	// From is the instruction leading to Address, or referencing it for
+	// IssueDataReference. It is Address itself for entry points.
+	From uint16
+}
+
+func (i CodeIssue) String() string {
+	switch i.Kind {
+	case IssueIllegal:
+		return fmt.Sprintf("illegal instruction x%04X at x%04X, reached from x%04X", i.Word, i.Address, i.From)
+	case IssueUnloaded:
+		return fmt.Sprintf("jump outside the image to x%04X from x%04X", i.Address, i.From)
+	default:
+		return fmt.Sprintf("data reference to code at x%04X (%s) from x%04X", i.Address, Disassemble(i.Address, i.Word), i.From)
+	}
+}
+
+// CFG is the control-flow graph of the code of an image reachable from its
+// entry points, found by recursive disassembly.
+type CFG struct {
+	Entries []uint16
+	// Blocks are sorted by address.
+	Blocks []*BasicBlock
+	// Subroutines are the entries of the subroutines called with JSR.
+	Subroutines []uint16
+	// Unreachable are the runs of words of the image never reached from
+	// the entries: dead code, but also data such as strings.
+	Unreachable []Segment
+	Issues      []CodeIssue
+
+	memory  map[uint16]uint16
+	blocks  map[uint16]*BasicBlock
+	symbols *SymbolTable
+	// returning are the subroutines reaching a RET. Calls of the others
+	// are jumps, their return sites being reached only from elsewhere.
+	returning map[uint16]bool
+}
+
+// flowEdge is a successor of an instruction.
+type flowEdge struct {
+	to   uint16
+	kind EdgeKind
+}
+
+// flow returns the successors of the instruction at pc and whether it ends a
+// basic block, indirectly when its target isn't known statically. RET has no
+// successor until its subroutine is known.
+func flow(pc uint16, d decoded) (succs []flowEdge, ends, indirect bool) {
+	next := pc + 1
+	switch d.op {
+	case OperationBR:
+		switch d.nzp {
+		case 0:
+			return []flowEdge{{next, EdgeFallthrough}}, false, false
+		case 0x7:
+			return []flowEdge{{next + d.offset, EdgeBranch}}, true, false
+		}
+		return []flowEdge{{next + d.offset, EdgeBranch}, {next, EdgeFallthrough}}, true, false
+	case OperationJMP:
+		return nil, true, d.sr1 != RegisterR7
+	case OperationJSR:
+		if d.imm {
+			return []flowEdge{{next + d.offset, EdgeCall}, {next, EdgeFallthrough}}, true, false
+		}
+		return []flowEdge{{next, EdgeFallthrough}}, true, true
+	case OperationTRAP:
+		if d.offset == uint16(TrapHALT) {
+			return nil, true, false
+		}
+		return []flowEdge{{next, EdgeTrap}}, true, false
+	case OperationRTI:
+		return nil, true, false
+	}
+	return []flowEdge{{next, EdgeFallthrough}}, false, false
+}
+
+// BuildCFG disassembles the code of obj reachable from entries, or from its
+// entry point (the origin of its first section without one) when none are
+// given, and builds its control-flow graph.
+func BuildCFG(obj *Object, entries ...uint16) (*CFG, error) {
+	linked, err := Link(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		entry, ok := linked.EntryPoint()
+		if !ok {
+			return nil, errors.New("no entry point")
+		}
+		entries = []uint16{entry}
+	}
+
+	g := &CFG{
+		Entries:   entries,
+		memory:    map[uint16]uint16{},
+		blocks:    map[uint16]*BasicBlock{},
+		symbols:   NewSymbolTable(linked.Symbols...),
+		returning: map[uint16]bool{},
+	}
+	for _, segment := range linked.Segments() {
+		for i, word := range segment.Words {
+			g.memory[segment.Origin+uint16(i)] = word
+		}
+	}
+
+	reached, leaders, subroutines := g.explore()
+	g.buildBlocks(reached, leaders)
+	for entry := range subroutines {
+		if g.blocks[entry] != nil {
+			g.Subroutines = append(g.Subroutines, entry)
+		}
+	}
+	sort.Slice(g.Subroutines, func(i, j int) bool { return g.Subroutines[i] < g.Subroutines[j] })
+	g.linkReturns()
+	g.findUnreachable(reached)
+	sort.SliceStable(g.Issues, func(i, j int) bool { return g.Issues[i].Address < g.Issues[j].Address })
+	return g, nil
+}
+
+// explore walks the instructions reachable from the entries. It returns them
+// with the addresses starting basic blocks and the targets of JSR. The return
+// site of a JSR is only walked once its subroutine is found to reach a RET,
+// as some programs use JSR as a jump followed by data.
+func (g *CFG) explore() (reached, leaders, subroutines map[uint16]bool) {
+	reached, leaders, subroutines = map[uint16]bool{}, map[uint16]bool{}, map[uint16]bool{}
+	issues := map[[2]uint16]bool{}
+	issue := func(i CodeIssue) {
+		if key := [2]uint16{uint16(i.Kind), i.Address}; !issues[key] {
+			issues[key] = true
+			g.Issues = append(g.Issues, i)
+		}
+	}
+
+	type item struct{ at, from uint16 }
+	var work []item
+	for _, entry := range g.Entries {
+		leaders[entry] = true
+		work = append(work, item{entry, entry})
+	}
+	// sites are the JSR instructions of each subroutine whose return site
+	// isn't walked yet.
+	sites := map[uint16][]uint16{}
+	for {
+		for len(work) > 0 {
+			it := work[len(work)-1]
+			work = work[:len(work)-1]
+			if reached[it.at] {
+				continue
+			}
+			word, ok := g.memory[it.at]
+			if !ok {
+				issue(CodeIssue{Kind: IssueUnloaded, Address: it.at, From: it.from})
+				continue
+			}
+			if !wellFormed(word) {
+				issue(CodeIssue{Kind: IssueIllegal, Address: it.at, Word: word, From: it.from})
+				continue
+			}
+			reached[it.at] = true
+
+			d := decode(word)
+			succs, ends, _ := flow(it.at, d)
+			for _, s := range succs {
+				if s.kind == EdgeCall {
+					subroutines[s.to] = true
+				} else if d.op == OperationJSR && d.imm && !g.returning[it.at+1+d.offset] {
+					callee := it.at + 1 + d.offset
+					sites[callee] = append(sites[callee], it.at)
+					continue
+				}
+				if ends || s.kind != EdgeFallthrough {
+					leaders[s.to] = true
+				}
+				work = append(work, item{s.to, it.at})
+			}
+		}
+
+		// Walk the return sites of the subroutines now found to return,
+		// until there are no more.
+		for _, entry := range sortedAddresses(sites) {
+			if !g.returns(entry, reached) {
+				continue
+			}
+			g.returning[entry] = true
+			for _, call := range sites[entry] {
+				leaders[call+1] = true
+				work = append(work, item{call + 1, call})
+			}
+			delete(sites, entry)
+		}
+		if len(work) == 0 {
+			break
+		}
+	}
+
+	for _, pc := range sortedAddresses(reached) {
+		d := decode(g.memory[pc])
+		switch d.op {
+		case OperationLD, OperationLDI, OperationST, OperationSTI:
+			if target := pc + 1 + d.offset; reached[target] {
+				issue(CodeIssue{Kind: IssueDataReference, Address: target, Word: g.memory[target], From: pc})
+			}
+		}
+	}
+	return reached, leaders, subroutines
+}
+
+// returns tells whether the subroutine at entry reaches a RET, without
+// following calls, nor the return sites of subroutines not known to return.
+func (g *CFG) returns(entry uint16, reached map[uint16]bool) bool {
+	seen := map[uint16]bool{}
+	work := []uint16{entry}
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		if seen[pc] || !reached[pc] {
+			continue
+		}
+		seen[pc] = true
+		if g.memory[pc] == instRET {
+			return true
+		}
+		d := decode(g.memory[pc])
+		succs, _, _ := flow(pc, d)
+		for _, s := range succs {
+			if s.kind == EdgeCall || (d.op == OperationJSR && d.imm && !g.returning[pc+1+d.offset]) {
+				continue
+			}
+			work = append(work, s.to)
+		}
+	}
+	return false
+}
+
+// buildBlocks splits the reached instructions into basic blocks and links
+// them, calls included.
+func (g *CFG) buildBlocks(reached, leaders map[uint16]bool) {
+	var b *BasicBlock
+	for _, pc := range sortedAddresses(reached) {
+		if b == nil || leaders[pc] || pc != b.Last()+1 {
+			b = &BasicBlock{Start: pc}
+			g.Blocks = append(g.Blocks, b)
+			g.blocks[pc] = b
+		}
+		b.Words = append(b.Words, g.memory[pc])
+		if _, ends, _ := flow(pc, decode(g.memory[pc])); ends {
+			b = nil
+		}
+	}
+
+	for _, b := range g.Blocks {
+		d := decode(g.memory[b.Last()])
+		succs, _, indirect := flow(b.Last(), d)
+		b.Indirect = indirect
+		for _, s := range succs {
+			if s.kind == EdgeFallthrough && d.op == OperationJSR && d.imm && !g.returning[b.Last()+1+d.offset] {
+				continue
+			}
+			if g.blocks[s.to] != nil {
+				b.Succs = append(b.Succs, Edge{From: b.Start, To: s.to, Kind: s.kind})
+			}
+		}
+	}
+}
+
+// linkReturns links the RET blocks of each subroutine to the return sites of
+// its calls.
+func (g *CFG) linkReturns() {
+	sites := map[uint16][]uint16{}
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			if e.Kind == EdgeCall && g.returning[e.To] && g.blocks[b.Last()+1] != nil {
+				sites[e.To] = append(sites[e.To], b.Last()+1)
+			}
+		}
+	}
+
+	for _, entry := range g.Subroutines {
+		for _, b := range g.body(entry) {
+			if g.memory[b.Last()] != instRET {
+				continue
+			}
+			for _, site := range sites[entry] {
+				e := Edge{From: b.Start, To: site, Kind: EdgeReturn}
+				if !containsEdge(b.Succs, e) {
+					b.Succs = append(b.Succs, e)
+				}
+			}
+		}
+	}
+}
+
+// body returns the blocks reachable from entry without following calls nor
+// returns, i.e. those of the subroutine at entry.
+func (g *CFG) body(entry uint16) []*BasicBlock {
+	seen := map[uint16]bool{entry: true}
+	body := []*BasicBlock{g.blocks[entry]}
+	for i := 0; i < len(body); i++ {
+		for _, e := range body[i].Succs {
+			if e.Kind == EdgeCall || e.Kind == EdgeReturn || seen[e.To] {
+				continue
+			}
+			seen[e.To] = true
+			body = append(body, g.blocks[e.To])
+		}
+	}
+	return body
+}
+
+func containsEdge(edges []Edge, e Edge) bool {
+	for _, other := range edges {
+		if other == e {
+			return true
+		}
+	}
+	return false
+}
+
+// findUnreachable collects the runs of words of the image neither reached
+// nor reported as illegal instructions.
+func (g *CFG) findUnreachable(reached map[uint16]bool) {
+	illegal := map[uint16]bool{}
+	for _, i := range g.Issues {
+		if i.Kind == IssueIllegal {
+			illegal[i.Address] = true
+		}
+	}
+
+	for _, pc := range sortedAddresses(g.memory) {
+		if reached[pc] || illegal[pc] {
+			continue
+		}
+		if n := len(g.Unreachable); n == 0 || g.Unreachable[n-1].End()+1 != pc {
+			g.Unreachable = append(g.Unreachable, Segment{Origin: pc})
+		}
+		last := &g.Unreachable[len(g.Unreachable)-1]
+		last.Words = append(last.Words, g.memory[pc])
+	}
+}
+
+// sortedAddresses returns the keys of m in increasing order.
+func sortedAddresses[T any](m map[uint16]T) []uint16 {
+	addresses := make([]uint16, 0, len(m))
+	for address := range m {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
+
+// Block returns the basic block holding the instruction at address, or nil.
+func (g *CFG) Block(address uint16) *BasicBlock {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].Start > address })
+	if i == 0 || g.Blocks[i-1].Last() < address {
+		return nil
+	}
+	return g.Blocks[i-1]
+}
+
+// DeadCode returns the unreachable runs of instructions of the source m,
+// leaving out its data.
+func (g *CFG) DeadCode(m *SourceMap) []Segment {
+	var dead []Segment
+	for _, segment := range g.Unreachable {
+		for i, word := range segment.Words {
+			pc := segment.Origin + uint16(i)
+			if !m.IsCode(pc) {
+				continue
+			}
+			if n := len(dead); n == 0 || dead[n-1].End()+1 != pc {
+				dead = append(dead, Segment{Origin: pc})
+			}
+			dead[len(dead)-1].Words = append(dead[len(dead)-1].Words, word)
+		}
+	}
+	return dead
+}
+
+// WriteDOT writes the graph in Graphviz DOT format, one node per basic block
+// listing its instructions. Entries are drawn bold and blocks ending with an
+// indirect jump dashed.
+func (g *CFG) WriteDOT(w io.Writer) error {
+	entries := map[uint16]bool{}
+	for _, entry := range g.Entries {
+		entries[entry] = true
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph cfg {")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=\"monospace\"];")
+	for _, b := range g.Blocks {
+		var label strings.Builder
+		if sym, ok := g.symbols.Lookup(b.Start); ok && sym.Address == b.Start {
+			label.WriteString(dotEscape(sym.Name + ":"))
+			label.WriteString(`\l`)
+		}
+		for i, word := range b.Words {
+			pc := b.Start + uint16(i)
+			label.WriteString(dotEscape(fmt.Sprintf("x%04X  %s", pc, Disassemble(pc, word))))
+			label.WriteString(`\l`)
+		}
+		attrs := ""
+		switch {
+		case entries[b.Start]:
+			attrs = ", style=bold"
+		case b.Indirect:
+			attrs = ", style=dashed"
+		}
+		fmt.Fprintf(bw, "\t\"x%04X\" [label=\"%s\"%s];\n", b.Start, label.String(), attrs)
+	}
+	for _, b := range g.Blocks {
+		for _, e := range b.Succs {
+			fmt.Fprintf(bw, "\t\"x%04X\" -> \"x%04X\"%s;\n", e.From, e.To, edgeStyles[e.Kind])
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+var edgeStyles = [...]string{
+	EdgeFallthrough: "",
+	EdgeBranch:      ` [label="branch"]`,
+	EdgeCall:        ` [label="call", style=dashed]`,
+	EdgeReturn:      ` [label="return", style=dotted]`,
+	EdgeTrap:        ` [label="trap"]`,
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
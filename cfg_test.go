@@ -0,0 +1,140 @@
+package lc3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCFG(t *testing.T) {
+	obj := &lc3.Object{
+		Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{
+			0xe007, // LEA R0, MSG
+			0x4804, // JSR SUB
+			0x0401, // BRz SKIP
+			0xf022, // PUTS
+			0xf025, // SKIP HALT
+			0x1234, // .FILL x1234
+			0x23ff, // SUB LD R1, SUB
+			0xc1c0, // RET
+			0x0061, // MSG .STRINGZ "a"
+			0x0000,
+		}}},
+		Symbols: []lc3.Symbol{{Name: "SUB", Address: 0x3006, Kind: lc3.SymbolLocal}},
+	}
+
+	t.Run("build basic blocks and edges", func(t *testing.T) {
+		g, err := lc3.BuildCFG(obj)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0x3000}, g.Entries)
+		assert.Equal(t, []uint16{0x3006}, g.Subroutines)
+
+		var starts []uint16
+		var edges []lc3.Edge
+		for _, b := range g.Blocks {
+			starts = append(starts, b.Start)
+			edges = append(edges, b.Succs...)
+		}
+		assert.Equal(t, []uint16{0x3000, 0x3002, 0x3003, 0x3004, 0x3006}, starts)
+		assert.Equal(t, []lc3.Edge{
+			{From: 0x3000, To: 0x3006, Kind: lc3.EdgeCall},
+			{From: 0x3000, To: 0x3002, Kind: lc3.EdgeFallthrough},
+			{From: 0x3002, To: 0x3004, Kind: lc3.EdgeBranch},
+			{From: 0x3002, To: 0x3003, Kind: lc3.EdgeFallthrough},
+			{From: 0x3003, To: 0x3004, Kind: lc3.EdgeTrap},
+			{From: 0x3006, To: 0x3002, Kind: lc3.EdgeReturn},
+		}, edges)
+
+		b := g.Block(0x3007)
+		require.NotNil(t, b)
+		assert.Equal(t, uint16(0x3006), b.Start)
+		assert.Equal(t, uint16(0x3007), b.Last())
+		assert.Nil(t, g.Block(0x3005))
+	})
+
+	t.Run("detect unreachable words and data in code", func(t *testing.T) {
+		g, err := lc3.BuildCFG(obj)
+		require.NoError(t, err)
+		assert.Equal(t, []lc3.Segment{
+			{Origin: 0x3005, Words: []uint16{0x1234}},
+			{Origin: 0x3008, Words: []uint16{0x0061, 0x0000}},
+		}, g.Unreachable)
+		assert.Equal(t, []lc3.CodeIssue{
+			{Kind: lc3.IssueDataReference, Address: 0x3006, Word: 0x23ff, From: 0x3006},
+		}, g.Issues)
+		assert.Equal(t, "data reference to code at x3006 (LD R1, x3006) from x3006", g.Issues[0].String())
+
+		m, err := lc3.ReadSourceMap(strings.NewReader(`        .ORIG x3000
+        LEA R0, MSG
+        JSR SUB
+        BRz SKIP
+        PUTS
+SKIP    HALT
+        ADD R1, R0, R4
+SUB     LD R1, SUB
+        RET
+MSG     .STRINGZ "a"
+        .END
+`), "cfg.asm")
+		require.NoError(t, err)
+		assert.Equal(t, []lc3.Segment{{Origin: 0x3005, Words: []uint16{0x1234}}}, g.DeadCode(m))
+	})
+
+	t.Run("report illegal instructions and indirect jumps", func(t *testing.T) {
+		g, err := lc3.BuildCFG(&lc3.Object{Sections: []lc3.Section{{Origin: 0x4000, Words: []uint16{
+			0x0202, // BRp x4003
+			0x0410, // BRz x4012
+			0xd000, // reserved opcode
+			0xc080, // JMP R2
+		}}}}, 0x4000)
+		require.NoError(t, err)
+		assert.Equal(t, []lc3.CodeIssue{
+			{Kind: lc3.IssueIllegal, Address: 0x4002, Word: 0xd000, From: 0x4001},
+			{Kind: lc3.IssueUnloaded, Address: 0x4012, From: 0x4001},
+		}, g.Issues)
+		assert.Equal(t, "illegal instruction xD000 at x4002, reached from x4001", g.Issues[0].String())
+		assert.Empty(t, g.Unreachable)
+		assert.True(t, g.Block(0x4003).Indirect)
+	})
+
+	t.Run("treat calls of subroutines that never return as jumps", func(t *testing.T) {
+		// rogue's LOOP never returns: the word after JSR LOOP is data.
+		program, err := lc3.ReadProgramFile("testdata/rogue.obj")
+		require.NoError(t, err)
+		g, err := lc3.BuildCFG(program)
+		require.NoError(t, err)
+		for _, issue := range g.Issues {
+			assert.NotEqual(t, lc3.IssueIllegal, issue.Kind, issue.String())
+		}
+		b := g.Block(0x30cf)
+		require.NotNil(t, b)
+		assert.Equal(t, uint16(0x30cf), b.Last())
+		for _, e := range b.Succs {
+			assert.NotEqual(t, lc3.EdgeFallthrough, e.Kind)
+		}
+		assert.Nil(t, g.Block(0x30d0))
+	})
+
+	t.Run("write DOT", func(t *testing.T) {
+		g, err := lc3.BuildCFG(obj)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		require.NoError(t, g.WriteDOT(&out))
+		dot := out.String()
+		assert.True(t, strings.HasPrefix(dot, "digraph cfg {\n"))
+		assert.Contains(t, dot, `"x3000" [label="x3000  LEA R0, x3008\lx3001  JSR x3006\l", style=bold];`)
+		assert.Contains(t, dot, `"x3006" [label="SUB:\lx3006  LD R1, x3006\lx3007  RET\l"];`)
+		assert.Contains(t, dot, `"x3000" -> "x3006" [label="call", style=dashed];`)
+		assert.Contains(t, dot, `"x3006" -> "x3002" [label="return", style=dotted];`)
+		assert.Contains(t, dot, `"x3002" -> "x3003";`)
+	})
+
+	t.Run("require an entry point", func(t *testing.T) {
+		_, err := lc3.BuildCFG(&lc3.Object{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,49 @@
+package lc3
+
+// CheckMode tells how the violations found by a runtime check are handled:
+// the sanitizer, the code guard and the stack guard.
+type CheckMode uint8
+
+const (
+	// CheckOff disables the check.
+	CheckOff CheckMode = iota
+	// CheckReport records the violations, once per instruction and cause
+	// with the number of times it happened, and executes the instruction
+	// anyway.
+	CheckReport
+	// CheckError makes Step return the violation as an error before
+	// executing the instruction.
+	CheckError
+)
+
+// counted is a violation counting the times it happened.
+type counted[V any] interface {
+	*V
+	repeat()
+}
+
+// recorder holds the violations of a check in the order they first happened,
+// indexed by key.
+type recorder[K comparable, V any] struct {
+	violations []V
+	seen       map[K]int
+}
+
+// record records v under key, or counts the violation already recorded under
+// it again.
+func record[K comparable, V any, P counted[V]](r *recorder[K, V], key K, v V) {
+	if i, ok := r.seen[key]; ok {
+		P(&r.violations[i]).repeat()
+		return
+	}
+	if r.seen == nil {
+		r.seen = map[K]int{}
+	}
+	r.seen[key] = len(r.violations)
+	r.violations = append(r.violations, v)
+}
+
+// list returns a copy of the violations.
+func (r *recorder[K, V]) list() []V {
+	return append([]V(nil), r.violations...)
+}
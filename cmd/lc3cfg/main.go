@@ -0,0 +1,105 @@
+// Command lc3cfg writes the control-flow graph of LC-3 object files in
+// Graphviz DOT format.
+//
+// The code reachable from the entry points is disassembled recursively and
+// split into basic blocks. Data reached as code and words never reached are
+// reported on stderr; with -src, words unreached are limited to the
+// instructions of the assembly sources, i.e. dead code.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+func main() {
+	var entries []uint16
+	flag.Func("entry", "entry point `address`, e.g. x3000 (repeatable, default: entry of the last object)", func(s string) error {
+		address, err := lc3.ParseAddress(s)
+		entries = append(entries, address)
+		return err
+	})
+	var sources []string
+	flag.Func("src", "assembly `file` a program was assembled from, to report dead code rather than unreached words (repeatable)", func(s string) error {
+		sources = append(sources, s)
+		return nil
+	})
+	output := flag.String("o", "", "write the graph to `file` (default: stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args(), entries, sources, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3cfg: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, entries []uint16, sources []string, output string) error {
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+	if len(entries) == 0 {
+		if entry, ok := objects[len(objects)-1].EntryPoint(); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	linked, err := lc3.Link(objects...)
+	if err != nil {
+		return err
+	}
+	g, err := lc3.BuildCFG(linked, entries...)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range g.Issues {
+		fmt.Fprintf(os.Stderr, "lc3cfg: %v\n", issue)
+	}
+	unreached := g.Unreachable
+	if len(sources) > 0 {
+		unreached = nil
+		for _, path := range sources {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			m, err := lc3.ReadSourceMap(f, path)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			unreached = append(unreached, g.DeadCode(m)...)
+		}
+	}
+	for _, segment := range unreached {
+		fmt.Fprintf(os.Stderr, "lc3cfg: x%04X-x%04X is unreachable\n", segment.Origin, segment.End())
+	}
+
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			return err
+		}
+	}
+	if err := g.WriteDOT(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,162 @@
+// Command lc3cov merges and reports coverage recorded by lc3vm -coverage.
+//
+// Usage:
+//
+//	lc3cov merge -o all.cov run1.cov run2.cov...
+//	lc3cov report -src prog.asm [-src os.asm] [-html out.html] [-lcov out.info] run.cov...
+//
+// Reports map executed addresses back to the assembly sources. Several
+// coverage files given to report are merged first. Without -html or -lcov,
+// report prints a summary per source.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "merge":
+		err = merge(os.Args[2:])
+	case "report":
+		err = report(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lc3cov: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s merge -o out.cov <coverage file>...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s report -src file.asm [-html file] [-lcov file] <coverage file>...\n", os.Args[0])
+	os.Exit(2)
+}
+
+func merge(args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	output := flags.String("o", "merged.cov", "output file")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		usage()
+	}
+
+	coverage, err := readCoverage(flags.Args())
+	if err != nil {
+		return err
+	}
+	return writeFile(*output, func(w io.Writer) error { return lc3.WriteCoverage(w, coverage) })
+}
+
+func report(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	var sources []string
+	flags.Func("src", "assembly `file` the program was assembled from (repeatable)", func(s string) error {
+		sources = append(sources, s)
+		return nil
+	})
+	html := flags.String("html", "", "write an HTML report to `file`")
+	lcov := flags.String("lcov", "", "write an lcov tracefile to `file`")
+	flags.Parse(args)
+	if flags.NArg() == 0 || len(sources) == 0 {
+		usage()
+	}
+
+	coverage, err := readCoverage(flags.Args())
+	if err != nil {
+		return err
+	}
+	var maps []*lc3.SourceMap
+	for _, path := range sources {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		m, err := lc3.ReadSourceMap(f, path)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		maps = append(maps, m)
+	}
+
+	if *html != "" {
+		if err := writeFile(*html, func(w io.Writer) error { return coverage.WriteHTML(w, maps...) }); err != nil {
+			return err
+		}
+	}
+	if *lcov != "" {
+		if err := writeFile(*lcov, func(w io.Writer) error { return coverage.WriteLcov(w, maps...) }); err != nil {
+			return err
+		}
+	}
+	if *html == "" && *lcov == "" {
+		for _, m := range maps {
+			var hit, branches, branchesHit int
+			lines := coverage.Lines(m)
+			for _, line := range lines {
+				if line.Count > 0 {
+					hit++
+				}
+				if line.Branch {
+					branches += 2
+					if line.Taken > 0 {
+						branchesHit++
+					}
+					if line.NotTaken > 0 {
+						branchesHit++
+					}
+				}
+			}
+			fmt.Printf("%s: %d/%d lines, %d/%d branches\n", m.File, hit, len(lines), branchesHit, branches)
+		}
+	}
+	return nil
+}
+
+func readCoverage(paths []string) (*lc3.Coverage, error) {
+	merged := lc3.NewCoverage()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		coverage, err := lc3.ReadCoverage(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		merged.Merge(coverage)
+	}
+	return merged, nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,45 @@
+// Command lc3diff runs random LC-3 programs on the VM and on a reference
+// model written from the ISA specification, and prints the first divergence
+// with a minimized case reproducing it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/kroosec/lc3vm-go/lc3ref"
+)
+
+func main() {
+	n := flag.Int("n", 1000, "number of cases")
+	size := flag.Int("size", 512, "instructions per case")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	engine := flag.String("engine", "interpreter", "execution engine: interpreter, jit or microcode")
+	flag.Parse()
+
+	var opts []lc3.Option
+	switch *engine {
+	case "interpreter":
+	case "jit":
+		opts = append(opts, lc3.WithEngine(lc3.EngineJIT))
+	case "microcode":
+		opts = append(opts, lc3.WithEngine(lc3.EngineMicrocode))
+	default:
+		fmt.Fprintf(os.Stderr, "lc3diff: invalid engine %q\n", *engine)
+		os.Exit(2)
+	}
+	d, err := lc3ref.Run(*n, *size, *seed, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lc3diff:", err)
+		os.Exit(1)
+	}
+	if d == nil {
+		fmt.Printf("%d cases, no divergence (seed %d)\n", *n, *seed)
+		return
+	}
+	fmt.Printf("divergence (seed %d): %v\n%v", *seed, d, d.Case)
+	os.Exit(1)
+}
@@ -0,0 +1,88 @@
+// Command lc3fuzz fuzzes the input of an LC-3 program, guided by the
+// control-flow edges it covers.
+//
+// Inputs making the program execute an invalid instruction, print a bad
+// PUTS string or hang are minimized and saved to the -crashes directory,
+// and the inputs covering new edges to the -corpus directory, whose files
+// seed the next session.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+func main() {
+	var cfg lc3.FuzzConfig
+	corpus := flag.String("corpus", "", "read seeds from and save new inputs to `dir`")
+	crashes := flag.String("crashes", "crashes", "save crashing inputs to `dir`")
+	duration := flag.Duration("time", time.Minute, "fuzzing duration")
+	flag.Uint64Var(&cfg.Limit, "limit", lc3.DefaultFuzzLimit, "instructions after which a run is considered hung")
+	flag.IntVar(&cfg.MaxLen, "max-len", lc3.DefaultFuzzMaxLen, "length of the inputs generated")
+	flag.Int64Var(&cfg.RandSeed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), cfg, *corpus, *crashes, *duration); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3fuzz: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string, cfg lc3.FuzzConfig, corpus, crashes string, duration time.Duration) error {
+	var err error
+	if cfg.Program, err = lc3.ReadProgramFile(path); err != nil {
+		return err
+	}
+	if corpus != "" {
+		entries, err := os.ReadDir(corpus)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			seed, err := os.ReadFile(filepath.Join(corpus, entry.Name()))
+			if err != nil {
+				return err
+			}
+			cfg.Seeds = append(cfg.Seeds, seed)
+		}
+	}
+
+	fuzzer, err := lc3.NewFuzzer(cfg)
+	if err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(duration); time.Now().Before(deadline); {
+		if err := fuzzer.Fuzz(100); err != nil {
+			return err
+		}
+	}
+	found := fuzzer.Crashes()
+	for _, crash := range found {
+		fmt.Println(crash)
+	}
+	fmt.Fprintf(os.Stderr, "lc3fuzz: %d runs, %d edges, %d inputs, %d crashes\n",
+		fuzzer.Runs(), fuzzer.Edges(), len(fuzzer.Corpus()), len(found))
+
+	if corpus != "" {
+		if err := lc3.WriteCorpus(corpus, fuzzer.Corpus()); err != nil {
+			return err
+		}
+	}
+	if len(found) > 0 {
+		return lc3.WriteCrashes(crashes, found)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Command lc3ld links LC-3 object files into a single image.
+//
+// Usage:
+//
+//	lc3ld [-legacy] -o out.obj a.obj b.obj...
+//
+// Inputs may be in any format lc3vm runs: relocatable or legacy .obj files,
+// text images or Intel HEX.
+// The output is written in the relocatable object format, keeping symbols and
+// line information. With -legacy, the linked sections are instead merged into
+// one legacy image starting at the lowest origin, with gaps zero-filled.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+func main() {
+	output := flag.String("o", "a.obj", "output file")
+	legacy := flag.Bool("legacy", false, "write a legacy .obj image")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s [-legacy] [-o out.obj] <object file>...\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args(), *output, *legacy); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3ld: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, output string, legacy bool) error {
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+
+	linked, err := lc3.Link(objects...)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	write := lc3.WriteObject
+	if legacy {
+		write = writeImage
+	}
+	if err := write(w, linked); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeImage(w io.Writer, obj *lc3.Object) error {
+	segments := obj.Segments()
+	if len(segments) == 0 {
+		return errors.New("nothing to link")
+	}
+
+	start, end := int(segments[0].Origin), 0
+	for _, seg := range segments {
+		if int(seg.Origin) < start {
+			start = int(seg.Origin)
+		}
+		if last := int(seg.Origin) + len(seg.Words); last > end {
+			end = last
+		}
+	}
+	if obj.HasEntry && int(obj.Entry) != start {
+		return fmt.Errorf("entry point x%04X is not the lowest origin x%04X", obj.Entry, start)
+	}
+
+	image := make([]uint16, end-start)
+	for _, seg := range segments {
+		copy(image[int(seg.Origin)-start:], seg.Words)
+	}
+	for _, word := range append([]uint16{uint16(start)}, image...) {
+		if _, err := w.Write([]byte{byte(word >> 8), byte(word)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
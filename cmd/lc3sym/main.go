@@ -0,0 +1,114 @@
+// Command lc3sym explores the paths of an LC-3 program with symbolic input,
+// printing input reaching each target address and each illegal instruction.
+//
+// Registers and memory words may also be made symbolic, e.g. to explore a
+// subroutine for any argument:
+//
+//	lc3sym -entry x3010 -reg R0 -target x3020 prog.obj
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+func main() {
+	var cfg lc3.SymbolicConfig
+	entry := flag.String("entry", "", "entry point address, e.g. x3000 (default: entry of the last object)")
+	flag.Func("target", "`address` to find input reaching (repeatable)", func(s string) error {
+		address, err := lc3.ParseAddress(s)
+		cfg.Targets = append(cfg.Targets, address)
+		return err
+	})
+	flag.Func("reg", "`register` R0-R7 holding any value (repeatable)", func(s string) error {
+		for reg := lc3.RegisterR0; reg <= lc3.RegisterR7; reg++ {
+			if strings.EqualFold(s, reg.String()) {
+				cfg.Registers = append(cfg.Registers, reg)
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid register %q", s)
+	})
+	flag.Func("mem", "`address[:count]` of memory words holding any value (repeatable)", func(s string) error {
+		address, count, _ := strings.Cut(s, ":")
+		region := lc3.DataRegion{Size: 1}
+		var err error
+		if region.Origin, err = lc3.ParseAddress(address); err != nil {
+			return err
+		}
+		if count != "" {
+			size, err := strconv.ParseUint(count, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid count %q", count)
+			}
+			region.Size = uint16(size)
+		}
+		cfg.Memory = append(cfg.Memory, region)
+		return nil
+	})
+	flag.IntVar(&cfg.MaxInput, "max-input", lc3.DefaultMaxInput, "characters read per path")
+	flag.IntVar(&cfg.MaxSteps, "max-steps", lc3.DefaultMaxSteps, "instructions executed per path")
+	flag.IntVar(&cfg.MaxPaths, "max-paths", lc3.DefaultMaxPaths, "paths explored")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args(), *entry, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3sym: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, entry string, cfg lc3.SymbolicConfig) error {
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+	pc, _ := objects[len(objects)-1].EntryPoint()
+	if entry != "" {
+		var err error
+		if pc, err = lc3.ParseAddress(entry); err != nil {
+			return err
+		}
+	}
+
+	linked, err := lc3.Link(objects...)
+	if err != nil {
+		return err
+	}
+	vm, err := lc3.New(lc3.WithPC(pc))
+	if err != nil {
+		return err
+	}
+	if _, err := vm.LoadSegments(linked.Segments()...); err != nil {
+		return err
+	}
+
+	x, err := vm.Explore(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range x.Findings {
+		fmt.Println(f)
+	}
+	fmt.Fprintf(os.Stderr, "lc3sym: %d paths, %d instructions\n", x.Paths, x.Instructions)
+	if !x.Complete {
+		fmt.Fprintln(os.Stderr, "lc3sym: warning: limits reached, some paths weren't explored")
+	}
+	return nil
+}
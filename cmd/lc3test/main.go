@@ -0,0 +1,130 @@
+// Command lc3test runs a program against a directory of lc3test specs, e.g.
+// to grade a student submission.
+//
+// Usage:
+//
+//	lc3test -specs tests/ [-junit report.xml] program.obj...
+//
+// Several object files are linked together like with lc3vm. Each failing
+// spec is printed with its failed expectations and an output diff. The exit
+// status is 1 if any spec fails.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/kroosec/lc3vm-go/lc3test"
+)
+
+func main() {
+	specs := flag.String("specs", "tests", "`directory` of *.json specs")
+	junit := flag.String("junit", "", "write a JUnit XML report to `file`")
+	engine := flag.String("engine", "interpreter", "execution engine: interpreter or microcode")
+	verbose := flag.Bool("v", false, "print passing specs too")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	passed, err := run(flag.Args(), *specs, *junit, *engine, *verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lc3test: %v\n", err)
+		os.Exit(2)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, dir, junit, engine string, verbose bool) (bool, error) {
+	var opts []lc3.Option
+	switch engine {
+	case "interpreter":
+	case "microcode":
+		opts = append(opts, lc3.WithEngine(lc3.EngineMicrocode))
+	default:
+		return false, fmt.Errorf("invalid engine %q", engine)
+	}
+
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return false, err
+		}
+		objects = append(objects, obj)
+	}
+	program, err := lc3.Link(objects...)
+	if err != nil {
+		return false, err
+	}
+	// Like lc3vm, start at the entry point of the last object.
+	program.Entry, program.HasEntry = objects[len(objects)-1].EntryPoint()
+
+	specs, err := lc3test.ReadSpecDir(dir)
+	if err != nil {
+		return false, err
+	}
+	if len(specs) == 0 {
+		return false, fmt.Errorf("no specs in %s", dir)
+	}
+
+	var results []*lc3test.Result
+	failed := 0
+	for _, spec := range specs {
+		r := lc3test.Run(program, spec, opts...)
+		results = append(results, r)
+		if r.Passed() {
+			if verbose {
+				fmt.Printf("PASS %s (%d instructions)\n", r.Name, r.Instructions)
+			}
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %s\n", r.Name)
+		if r.Err != nil {
+			fmt.Printf("    %v\n", r.Err)
+		}
+		for _, failure := range r.Failures {
+			fmt.Printf("    %s\n", failure)
+		}
+		if r.Diff != "" {
+			fmt.Print(indent(r.Diff))
+		}
+	}
+	fmt.Printf("%d/%d passed\n", len(specs)-failed, len(specs))
+
+	if junit != "" {
+		f, err := os.Create(junit)
+		if err != nil {
+			return false, err
+		}
+		w := bufio.NewWriter(f)
+		err = lc3test.WriteJUnit(w, paths[len(paths)-1], results)
+		if err == nil {
+			err = w.Flush()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return failed == 0, nil
+}
+
+func indent(text string) string {
+	return "    " + strings.ReplaceAll(strings.TrimSuffix(text, "\n"), "\n", "\n    ") + "\n"
+}
@@ -0,0 +1,348 @@
+// Command lc3vm runs LC-3 object files.
+//
+// Programs may be legacy or relocatable .obj files, .hex or .bin text images,
+// or Intel HEX (.ihx, .ihex) files.
+//
+// Several object files may be given, e.g. an operating system and a user
+// program; they must not overlap and are linked together. Execution starts at
+// the entry point of the last object unless -entry is given.
+//
+// With -tui, the program runs in a full-screen terminal debugger.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// config holds the command line flags.
+type config struct {
+	entry      string
+	truncate   bool
+	trace      string
+	protection string
+	supervisor bool
+	jit        bool
+	microcode  bool
+	cycles     bool
+	latency    int
+	profile    string
+	report     bool
+	symbols    string
+	coverage   string
+	checkCalls bool
+	sanitize   string
+	checkCode  string
+	checkStack string
+	stack      string
+	sources    []string
+	tui        bool
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.entry, "entry", "", "entry point address, e.g. x3000 (default: entry of the last object)")
+	flag.BoolVar(&cfg.truncate, "truncate", false, "truncate images overflowing user memory instead of failing")
+	flag.StringVar(&cfg.protection, "protection", "off", "user mode memory protection: off, error or exception")
+	flag.BoolVar(&cfg.supervisor, "supervisor", false, "start in supervisor mode")
+	flag.BoolVar(&cfg.jit, "jit", false, "compile basic blocks into Go closures")
+	flag.BoolVar(&cfg.microcode, "microcode", false, "execute instructions through the LC-3 state machine")
+	flag.BoolVar(&cfg.cycles, "cycles", false, "count cycles and print per-opcode statistics on exit")
+	flag.IntVar(&cfg.latency, "latency", lc3.DefaultTimingModel.MemoryLatency, "memory latency in cycles, with -cycles")
+	flag.StringVar(&cfg.profile, "profile", "", "write a pprof profile of the program to `file`")
+	flag.BoolVar(&cfg.report, "report", false, "print a profile report with hot spots and the call graph on exit")
+	flag.StringVar(&cfg.symbols, "symbols", "", "read symbol names from an lc3as .sym `file`")
+	flag.StringVar(&cfg.coverage, "coverage", "", "write the executed instructions and branches to `file`, for lc3cov")
+	flag.BoolVar(&cfg.checkCalls, "check-calls", false, "report subroutines clobbering R1-R5, unbalancing R6 or returning elsewhere on exit")
+	flag.StringVar(&cfg.sanitize, "sanitize", "off", "uninitialized memory and register reads: off, report or error")
+	flag.StringVar(&cfg.checkCode, "check-code", "off", "execution of data or of words written at runtime: off, report or error")
+	flag.StringVar(&cfg.checkStack, "check-stack", "off", "R6 leaving the stack through ADD, LDR or STR: off, report or error")
+	flag.StringVar(&cfg.stack, "stack", "xF000:xFE00", "stack `limit:base` for -check-stack, R6 being base when empty")
+	flag.Func("src", "assembly `file` a program was assembled from, giving the data regions for -check-code (repeatable)", func(s string) error {
+		cfg.sources = append(cfg.sources, s)
+		return nil
+	})
+	flag.StringVar(&cfg.trace, "trace", "", "write an instruction trace to `file` (- for stderr)")
+	flag.BoolVar(&cfg.tui, "tui", false, "debug the program in a full-screen terminal UI")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args(), cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3vm: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, cfg config) error {
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+
+	pc, _ := objects[len(objects)-1].EntryPoint()
+	if cfg.entry != "" {
+		var err error
+		if pc, err = lc3.ParseAddress(cfg.entry); err != nil {
+			return err
+		}
+	}
+
+	linked, err := lc3.Link(objects...)
+	if err != nil {
+		return err
+	}
+
+	opts := []lc3.Option{lc3.WithInput(os.Stdin), lc3.WithOutput(os.Stdout), lc3.WithPC(pc)}
+	switch cfg.protection {
+	case "off":
+	case "error":
+		opts = append(opts, lc3.WithMemoryProtection(lc3.ProtectionError))
+	case "exception":
+		opts = append(opts, lc3.WithMemoryProtection(lc3.ProtectionException))
+	default:
+		return fmt.Errorf("invalid protection %q", cfg.protection)
+	}
+	sanitize, err := checkMode("sanitize", cfg.sanitize)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, lc3.WithSanitizer(sanitize))
+	checkCode, err := checkMode("check-code", cfg.checkCode)
+	if err != nil {
+		return err
+	}
+	if checkCode != lc3.CheckOff {
+		var regions []lc3.DataRegion
+		for _, path := range cfg.sources {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			m, err := lc3.ReadSourceMap(f, path)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			regions = append(regions, m.DataRegions()...)
+		}
+		opts = append(opts, lc3.WithCodeGuard(checkCode, regions...))
+	}
+	checkStack, err := checkMode("check-stack", cfg.checkStack)
+	if err != nil {
+		return err
+	}
+	if checkStack != lc3.CheckOff {
+		limit, base, ok := strings.Cut(cfg.stack, ":")
+		if !ok {
+			return fmt.Errorf("invalid stack %q", cfg.stack)
+		}
+		var stack lc3.Stack
+		if stack.Limit, err = lc3.ParseAddress(limit); err != nil {
+			return err
+		}
+		if stack.Base, err = lc3.ParseAddress(base); err != nil {
+			return err
+		}
+		opts = append(opts, lc3.WithStackGuard(checkStack, stack))
+	}
+	var input *console
+	var output *vt
+	if cfg.tui {
+		if cfg.jit {
+			return fmt.Errorf("-tui steps instructions one at a time, without -jit")
+		}
+		if cfg.trace == "-" {
+			return fmt.Errorf("-tui needs -trace to write to a file")
+		}
+		input, output = &console{}, newVT(tuiMinHeight, tuiMinWidth)
+		opts = append(opts, lc3.WithInput(input), lc3.WithOutput(output))
+	}
+	switch {
+	case cfg.jit && cfg.microcode:
+		return fmt.Errorf("-jit and -microcode are exclusive")
+	case cfg.jit:
+		opts = append(opts, lc3.WithEngine(lc3.EngineJIT))
+	case cfg.microcode:
+		opts = append(opts, lc3.WithEngine(lc3.EngineMicrocode))
+	}
+	if cfg.cycles {
+		model := lc3.DefaultTimingModel
+		model.MemoryLatency = cfg.latency
+		opts = append(opts, lc3.WithTiming(model))
+	}
+	if cfg.supervisor {
+		opts = append(opts, lc3.WithSupervisorMode())
+	}
+	if cfg.truncate {
+		opts = append(opts, lc3.WithOverflowPolicy(lc3.OverflowTruncate))
+	}
+	if cfg.trace != "" {
+		trace := os.Stderr
+		if cfg.trace != "-" {
+			if trace, err = os.Create(cfg.trace); err != nil {
+				return err
+			}
+			defer trace.Close()
+		}
+		w := bufio.NewWriter(trace)
+		defer w.Flush()
+		opts = append(opts, lc3.WithTracer(lc3.NewTextTracer(w)))
+	}
+
+	symbols := linked.Symbols
+	if cfg.symbols != "" {
+		f, err := os.Open(cfg.symbols)
+		if err != nil {
+			return err
+		}
+		more, err := lc3.ReadSymbolFile(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", cfg.symbols, err)
+		}
+		symbols = append(symbols, more...)
+	}
+
+	var profiler *lc3.Profiler
+	if cfg.profile != "" || cfg.report {
+		profiler = lc3.NewProfiler(symbols...)
+		opts = append(opts, lc3.WithTracer(profiler))
+	}
+
+	var checker *lc3.CallChecker
+	if cfg.checkCalls {
+		checker = lc3.NewCallChecker(nil, symbols...)
+		opts = append(opts, lc3.WithTracer(checker))
+	}
+
+	var coverage *lc3.Coverage
+	if cfg.coverage != "" {
+		coverage = lc3.NewCoverage()
+		opts = append(opts, lc3.WithTracer(coverage))
+	}
+
+	vm, err := lc3.New(opts...)
+	if err != nil {
+		return err
+	}
+	summaries, err := vm.LoadSegments(linked.Segments()...)
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		if summary.Truncated > 0 {
+			fmt.Fprintf(os.Stderr, "lc3vm: warning: dropped %d words overflowing user memory from segment at x%04X\n",
+				summary.Truncated, summary.Origin)
+		}
+	}
+	if cfg.tui {
+		err = runTUI(vm, input, output, symbols)
+	} else {
+		err = vm.Run()
+	}
+	if cfg.cycles {
+		printCycles(vm)
+	}
+	if profiler != nil {
+		if perr := writeProfile(profiler, cfg); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	for _, read := range vm.UninitializedReads() {
+		fmt.Fprintf(os.Stderr, "lc3vm: %v (%d times)\n", read, read.Count)
+	}
+	for _, violation := range vm.CodeViolations() {
+		fmt.Fprintf(os.Stderr, "lc3vm: %v (%d times)\n", violation, violation.Count)
+	}
+	for _, violation := range vm.StackViolations() {
+		fmt.Fprintf(os.Stderr, "lc3vm: %v (%d times)\n", violation, violation.Count)
+	}
+	if checker != nil {
+		checker.WriteReport(os.Stderr)
+	}
+	if coverage != nil {
+		if cerr := writeCoverage(coverage, cfg.coverage); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func writeCoverage(coverage *lc3.Coverage, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := lc3.WriteCoverage(f, coverage); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeProfile writes the report to stderr and the pprof profile, as asked.
+func writeProfile(profiler *lc3.Profiler, cfg config) error {
+	if cfg.report {
+		if err := profiler.WriteReport(os.Stderr, 20); err != nil {
+			return err
+		}
+	}
+	if cfg.profile == "" {
+		return nil
+	}
+	f, err := os.Create(cfg.profile)
+	if err != nil {
+		return err
+	}
+	if err := profiler.WritePprof(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// printCycles writes the cycle count and per-opcode statistics to stderr.
+func printCycles(vm *lc3.VM) {
+	stats := vm.CycleStats()
+	ops := make([]string, 0, len(stats))
+	for op := range stats {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return stats[ops[i]].Cycles > stats[ops[j]].Cycles })
+
+	fmt.Fprintf(os.Stderr, "%d cycles\n", vm.Cycles())
+	for _, op := range ops {
+		s := stats[op]
+		fmt.Fprintf(os.Stderr, "%-5s %10d inst %12d cycles %6.2f CPI\n", op, s.Count, s.Cycles, float64(s.Cycles)/float64(s.Count))
+	}
+}
+
+// checkMode parses the mode of the check set with the given flag.
+func checkMode(flag, mode string) (lc3.CheckMode, error) {
+	switch mode {
+	case "off":
+		return lc3.CheckOff, nil
+	case "report":
+		return lc3.CheckReport, nil
+	case "error":
+		return lc3.CheckError, nil
+	}
+	return 0, fmt.Errorf("invalid %s mode %q", flag, mode)
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+const (
+	// tuiBatch is the number of instructions run between checks for keys.
+	tuiBatch = 10000
+	// tuiRefresh is the interval of redraws while running.
+	tuiRefresh = 50 * time.Millisecond
+	// Minimum terminal size.
+	tuiMinWidth  = 80
+	tuiMinHeight = 24
+)
+
+// Keys with a meaning of their own. Ctrl-C is read as a key in raw mode.
+const (
+	keyCtrlC    = "\x03"
+	keyEscape   = "\x1b"
+	keyUp       = "\x1b[A"
+	keyDown     = "\x1b[B"
+	keyPageUp   = "\x1b[5~"
+	keyPageDown = "\x1b[6~"
+)
+
+const tuiHelp = "s step  n next  c continue  ^C pause  b break  ↑↓ PgUp PgDn  g goto  q quit"
+
+// console is the input of the program, typed in the TUI. Reads never block:
+// io.EOF means nothing was typed yet, which the keyboard registers report as
+// no key, and the TUI doesn't run GETC or IN until something is. Reads
+// return a byte at a time, so that the VM doesn't buffer input the TUI can't
+// see.
+type console struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (c *console) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = c.buf[0]
+	c.buf = c.buf[1:]
+	return 1, nil
+}
+
+func (c *console) Write(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, p...)
+}
+
+func (c *console) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.buf)
+}
+
+// tui is a full-screen debugger: registers, disassembly around PC with
+// breakpoints, a memory hexdump, the stack and the program's console.
+type tui struct {
+	vm      *lc3.VM
+	input   *console
+	output  *vt
+	symbols *lc3.SymbolTable
+	term    *bufio.Writer
+	grid    *grid
+
+	running bool
+	// resume skips the breakpoint at PC when continuing from it.
+	resume bool
+	// until is the return address of a call stepped over by next.
+	until     uint16
+	untilSet  bool
+	breaks    map[uint16]bool
+	steps     uint64
+	err       error
+	message   string
+	cursor    uint16
+	memory    uint16
+	prompt    *strings.Builder
+	wantInput bool
+	quit      bool
+}
+
+// runTUI runs vm in a full-screen debugger on the terminal, until the user
+// quits. vm must read from input and write to output.
+func runTUI(vm *lc3.VM, input *console, output *vt, symbols []lc3.Symbol) error {
+	width, height, err := terminalSize(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("-tui needs a terminal: %v", err)
+	}
+	restore, err := rawMode(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("-tui needs a terminal: %v", err)
+	}
+	defer restore()
+
+	t := &tui{
+		vm:      vm,
+		input:   input,
+		output:  output,
+		symbols: lc3.NewSymbolTable(symbols...),
+		term:    bufio.NewWriterSize(os.Stdout, 1<<16),
+		breaks:  map[uint16]bool{},
+		cursor:  vm.GetRegister(lc3.RegisterPC),
+		memory:  vm.GetRegister(lc3.RegisterPC),
+	}
+	t.resize(width, height)
+	// Alternate screen, hidden cursor.
+	t.term.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		t.term.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		t.term.Flush()
+	}()
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+
+	last := time.Now()
+	for !t.quit {
+		if t.running && !t.blocked() {
+			t.execute(tuiBatch)
+			select {
+			case key, ok := <-keys:
+				t.key(key, ok)
+			case <-resize:
+				t.checkSize()
+			default:
+			}
+			if !t.running || time.Since(last) >= tuiRefresh {
+				t.draw()
+				last = time.Now()
+			}
+			continue
+		}
+		t.draw()
+		select {
+		case key, ok := <-keys:
+			t.key(key, ok)
+		case <-resize:
+			t.checkSize()
+		}
+	}
+	return t.err
+}
+
+// readKeys sends the keys read from r, escape sequences whole.
+func readKeys(r io.Reader, keys chan<- string) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for data := buf[:n]; len(data) > 0; {
+			size := 1
+			if len(data) > 2 && data[0] == 0x1b && data[1] == '[' {
+				size = 2
+				for size < len(data) && (data[size] < 0x40 || data[size] > 0x7e) {
+					size++
+				}
+				size = min(size+1, len(data))
+			}
+			keys <- string(data[:size])
+			data = data[size:]
+		}
+		if err != nil {
+			close(keys)
+			return
+		}
+	}
+}
+
+func (t *tui) checkSize() {
+	if width, height, err := terminalSize(os.Stdin); err == nil {
+		t.resize(width, height)
+	}
+}
+
+func (t *tui) resize(width, height int) {
+	width, height = max(width, tuiMinWidth), max(height, tuiMinHeight)
+	t.grid = newGrid(width, height)
+	l := t.layout()
+	t.output.resize(l.consoleRows, l.consoleCols)
+}
+
+// blocked tells whether the next instruction reads a character that wasn't
+// typed yet.
+func (t *tui) blocked() bool {
+	pc := t.vm.GetRegister(lc3.RegisterPC)
+	if pc >= lc3.MemoryKBSR {
+		return false
+	}
+	inst, _ := t.vm.GetMemory(pc)
+	trap := uint8(inst)
+	return inst>>12 == 0xf && (trap == lc3.TrapGETC || trap == lc3.TrapIN) && t.input.Len() == 0
+}
+
+// execute runs up to n instructions, stopping at breakpoints, at the end of
+// a call stepped over, on errors and before waiting for input.
+func (t *tui) execute(n int) {
+	for i := 0; i < n && t.running; i++ {
+		pc := t.vm.GetRegister(lc3.RegisterPC)
+		switch {
+		case t.vm.State() != lc3.StateRunning:
+			t.stop("halted")
+			return
+		case t.untilSet && pc == t.until:
+			t.stop("")
+			return
+		case t.breaks[pc] && !t.resume:
+			t.stop(fmt.Sprintf("breakpoint at %s", t.symbols.Name(pc)))
+			return
+		case t.blocked():
+			return
+		}
+		t.resume = false
+		t.step()
+	}
+}
+
+// step executes an instruction, stopping on errors.
+func (t *tui) step() {
+	if err := t.vm.Step(); err != nil {
+		t.err = err
+		t.stop(err.Error())
+		return
+	}
+	t.steps++
+	if t.vm.State() != lc3.StateRunning {
+		t.stop("halted")
+	}
+}
+
+func (t *tui) stop(message string) {
+	t.running, t.untilSet = false, false
+	t.message = message
+	t.cursor = t.vm.GetRegister(lc3.RegisterPC)
+}
+
+func (t *tui) start() {
+	if t.vm.State() != lc3.StateRunning {
+		t.message = "halted"
+		return
+	}
+	t.running, t.resume, t.message = true, true, ""
+}
+
+// key handles a key, or the end of the terminal input if !ok. While
+// running, all keys but Ctrl-C go to the program.
+func (t *tui) key(key string, ok bool) {
+	switch {
+	case !ok:
+		t.quit = true
+		return
+	case t.running:
+		if key == keyCtrlC {
+			t.stop("paused")
+			return
+		}
+		t.send(key)
+		return
+	case t.prompt != nil:
+		t.promptKey(key)
+		return
+	case t.wantInput:
+		t.wantInput = false
+		t.send(key)
+		t.message = ""
+		t.step()
+		t.cursor = t.vm.GetRegister(lc3.RegisterPC)
+		return
+	}
+
+	pc := t.vm.GetRegister(lc3.RegisterPC)
+	switch key {
+	case "s", " ":
+		switch {
+		case t.vm.State() != lc3.StateRunning:
+			t.message = "halted"
+		case t.blocked():
+			t.wantInput = true
+			t.message = "waiting for input: type a key"
+		default:
+			t.message = ""
+			t.step()
+			t.cursor = t.vm.GetRegister(lc3.RegisterPC)
+		}
+	case "n":
+		// Step over calls and traps, running until the next instruction.
+		inst, _ := t.vm.GetMemory(pc)
+		if op := inst >> 12; op == 0x4 || op == 0xf {
+			t.until, t.untilSet = pc+1, true
+			t.start()
+			return
+		}
+		t.key("s", true)
+	case "c":
+		t.start()
+	case "b":
+		if t.breaks[t.cursor] {
+			delete(t.breaks, t.cursor)
+		} else {
+			t.breaks[t.cursor] = true
+		}
+	case keyUp, "k":
+		t.cursor--
+	case keyDown, "j":
+		t.cursor++
+	case keyPageUp:
+		l := t.layout()
+		t.memory -= uint16(l.memoryRows * l.memoryWords)
+	case keyPageDown:
+		l := t.layout()
+		t.memory += uint16(l.memoryRows * l.memoryWords)
+	case "g":
+		t.prompt = &strings.Builder{}
+	case "q", keyCtrlC:
+		t.quit = true
+	}
+}
+
+// send types a key for the program, Enter as a newline.
+func (t *tui) send(key string) {
+	if key == "\r" {
+		key = "\n"
+	}
+	t.input.Write([]byte(key))
+}
+
+// promptKey edits the address typed after g, then shows memory there.
+func (t *tui) promptKey(key string) {
+	switch key {
+	case "\r":
+		text := t.prompt.String()
+		t.prompt = nil
+		address, err := lc3.ParseAddress(text)
+		if err != nil {
+			t.message = err.Error()
+			return
+		}
+		t.memory, t.message = address, ""
+	case keyEscape, keyCtrlC:
+		t.prompt = nil
+	case "\x7f", "\b":
+		text := t.prompt.String()
+		t.prompt.Reset()
+		if len(text) > 0 {
+			t.prompt.WriteString(text[:len(text)-1])
+		}
+	default:
+		if len(key) == 1 && key[0] > ' ' && key[0] < 0x7f {
+			t.prompt.WriteString(key)
+		}
+	}
+}
+
+// layout is the position and size of the panes: registers, disassembly and
+// stack on the left, console and memory on the right, between the status
+// line at the top and the help line at the bottom.
+type layout struct {
+	leftCols                  int
+	registersRows, disasmRows int
+	stackRows                 int
+	consoleCols, consoleRows  int
+	memoryRows                int
+	// memoryWords is the number of words per row of the hexdump.
+	memoryWords int
+}
+
+func (t *tui) layout() layout {
+	content := t.grid.height - 2
+	l := layout{leftCols: t.grid.width / 2, registersRows: 5}
+	l.consoleCols = t.grid.width - l.leftCols - 1
+	// Each pane has a title line.
+	l.stackRows = (content - l.registersRows - 3) / 3
+	l.disasmRows = content - l.registersRows - l.stackRows - 3
+	l.memoryRows = max(content/4, 3)
+	l.consoleRows = content - l.memoryRows - 2
+	l.memoryWords = 4
+	if l.consoleCols >= 58 {
+		l.memoryWords = 8
+	}
+	return l
+}
+
+// pane draws the title of a pane and returns its first row.
+func (t *tui) pane(row, col, width int, title string) int {
+	t.grid.text(row, col, width, " "+title, attrReverse)
+	t.grid.fill(row, col, width, attrReverse)
+	return row + 1
+}
+
+func (t *tui) draw() {
+	g, l := t.grid, t.layout()
+	g.clear()
+	if t.running {
+		t.cursor = t.vm.GetRegister(lc3.RegisterPC)
+	}
+
+	status := "paused"
+	switch {
+	case t.running && t.blocked():
+		status = "waiting for input"
+	case t.running:
+		status = "running"
+	case t.vm.State() != lc3.StateRunning:
+		status = "halted"
+	}
+	line := fmt.Sprintf(" lc3vm  %s  %d instructions", status, t.steps)
+	if t.message != "" {
+		line += "  " + t.message
+	}
+	g.text(0, 0, g.width, line, attrReverse|attrBold)
+	g.fill(0, 0, g.width, attrReverse|attrBold)
+	if t.prompt != nil {
+		g.text(g.height-1, 0, g.width, "goto address: "+t.prompt.String()+"_", 0)
+	} else {
+		g.text(g.height-1, 0, g.width, tuiHelp, 0)
+	}
+
+	row := t.pane(1, 0, l.leftCols, "Registers")
+	t.drawRegisters(row, l.leftCols)
+	row = t.pane(row+l.registersRows, 0, l.leftCols, "Disassembly")
+	t.drawDisassembly(row, l.leftCols, l.disasmRows)
+	row = t.pane(row+l.disasmRows, 0, l.leftCols, "Stack")
+	t.drawStack(row, l.leftCols, l.stackRows)
+
+	col := l.leftCols + 1
+	row = t.pane(1, col, l.consoleCols, "Console")
+	for i, line := range t.output.lines {
+		g.text(row+i, col, l.consoleCols, string(line), 0)
+	}
+	row = t.pane(row+l.consoleRows, col, l.consoleCols, "Memory")
+	t.drawMemory(row, col, l.consoleCols, l.memoryRows, l.memoryWords)
+
+	g.render(t.term)
+}
+
+func (t *tui) drawRegisters(row, width int) {
+	for i := 0; i < 4; i++ {
+		a, b := lc3.Register(i), lc3.Register(i+4)
+		va, vb := t.vm.GetRegister(a), t.vm.GetRegister(b)
+		t.grid.text(row+i, 1, width-1, fmt.Sprintf("%s x%04X %6d   %s x%04X %6d", a, va, int16(va), b, vb, int16(vb)), 0)
+	}
+	psr := t.vm.PSR()
+	cc := ""
+	for i, flag := range "NZP" {
+		if psr&(4>>i) != 0 {
+			cc += string(flag)
+		}
+	}
+	mode := "user"
+	if t.vm.Privileged() {
+		mode = "supervisor"
+	}
+	t.grid.text(row+4, 1, width-1, fmt.Sprintf("PC x%04X  PSR x%04X  CC %s  %s", t.vm.GetRegister(lc3.RegisterPC), psr, cc, mode), attrBold)
+}
+
+// drawDisassembly shows the words around the cursor: PC is bold, the cursor
+// reversed, and breakpoints marked with a red dot.
+func (t *tui) drawDisassembly(row, width, rows int) {
+	pc := t.vm.GetRegister(lc3.RegisterPC)
+	start := t.cursor - uint16(rows/3)
+	for i := 0; i < rows; i++ {
+		address := start + uint16(i)
+		if address >= lc3.MemoryKBSR && start < lc3.MemoryKBSR {
+			break
+		}
+		var a attr
+		switch {
+		case address == t.cursor:
+			a = attrReverse
+		case address == pc:
+			a = attrBold
+		}
+		marker := "  "
+		if address == pc {
+			marker = "> "
+		}
+		label := ""
+		if sym, ok := t.symbols.Lookup(address); ok && sym.Address == address {
+			label = sym.Name
+		}
+		text := "(device)"
+		if address < lc3.MemoryKBSR {
+			word, _ := t.vm.GetMemory(address)
+			text = fmt.Sprintf("%04X  %s", word, lc3.Disassemble(address, word))
+		}
+		n := t.grid.text(row+i, 2, width-2, fmt.Sprintf("%sx%04X %-8.8s %s", marker, address, label, text), a)
+		t.grid.fill(row+i, 2+n, width-2-n, a)
+		if t.breaks[address] {
+			t.grid.text(row+i, 0, 1, "●", attrRed|attrBold)
+		}
+	}
+}
+
+// drawStack shows the words from R6 up, marking the frames tracked by
+// -check-stack.
+func (t *tui) drawStack(row, width, rows int) {
+	frames := map[uint16]lc3.StackFrame{}
+	for _, frame := range t.vm.StackFrames() {
+		frames[frame.SP] = frame
+	}
+	sp := t.vm.GetRegister(lc3.RegisterR6)
+	for i := 0; i < rows; i++ {
+		address := sp + uint16(i)
+		if address >= lc3.MemoryKBSR {
+			break
+		}
+		word, _ := t.vm.GetMemory(address)
+		line := fmt.Sprintf("x%04X  %04X %6d", address, word, int16(word))
+		if i == 0 {
+			line += "  <- R6"
+		}
+		if frame, ok := frames[address]; ok {
+			line += "  frame of " + t.symbols.Name(frame.Entry)
+		}
+		t.grid.text(row+i, 1, width-1, line, 0)
+	}
+}
+
+// drawMemory shows a hexdump of words per row, with their characters.
+func (t *tui) drawMemory(row, col, width, rows, words int) {
+	for i := 0; i < rows; i++ {
+		address := t.memory + uint16(i*words)
+		var hex, chars strings.Builder
+		for j := uint16(0); j < uint16(words); j++ {
+			if address+j >= lc3.MemoryKBSR {
+				hex.WriteString(" ----")
+				chars.WriteByte(' ')
+				continue
+			}
+			word, _ := t.vm.GetMemory(address + j)
+			fmt.Fprintf(&hex, " %04X", word)
+			if word >= ' ' && word < 0x7f {
+				chars.WriteByte(byte(word))
+			} else {
+				chars.WriteByte('.')
+			}
+		}
+		t.grid.text(row+i, col+1, width-1, fmt.Sprintf("x%04X%s  %s", address, hex.String(), chars.String()), 0)
+	}
+}
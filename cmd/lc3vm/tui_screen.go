@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// attr is a set of display attributes of a cell.
+type attr uint8
+
+const (
+	attrBold attr = 1 << iota
+	attrReverse
+	attrRed
+)
+
+// sgr returns the escape sequence selecting a.
+func (a attr) sgr() string {
+	codes := []string{"0"}
+	if a&attrBold != 0 {
+		codes = append(codes, "1")
+	}
+	if a&attrReverse != 0 {
+		codes = append(codes, "7")
+	}
+	if a&attrRed != 0 {
+		codes = append(codes, "31")
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+type cell struct {
+	r rune
+	a attr
+}
+
+// grid is the content of the terminal, drawn in one go to avoid flicker.
+type grid struct {
+	width, height int
+	cells         []cell
+}
+
+func newGrid(width, height int) *grid {
+	return &grid{width: width, height: height, cells: make([]cell, width*height)}
+}
+
+func (g *grid) clear() {
+	for i := range g.cells {
+		g.cells[i] = cell{' ', 0}
+	}
+}
+
+// text writes s at row and col, clipped to width cells, and returns the
+// number of cells written.
+func (g *grid) text(row, col, width int, s string, a attr) int {
+	if row < 0 || row >= g.height {
+		return 0
+	}
+	n := 0
+	for _, r := range s {
+		if n == width || col+n >= g.width {
+			break
+		}
+		if r < ' ' || r == 0x7f {
+			r = '.'
+		}
+		g.cells[row*g.width+col+n] = cell{r, a}
+		n++
+	}
+	return n
+}
+
+// fill sets the attributes of width cells at row and col, keeping their
+// content.
+func (g *grid) fill(row, col, width int, a attr) {
+	if row < 0 || row >= g.height {
+		return
+	}
+	for i := col; i < col+width && i < g.width; i++ {
+		g.cells[row*g.width+i].a = a
+	}
+}
+
+// render draws the grid from the top left corner of the terminal.
+func (g *grid) render(w *bufio.Writer) error {
+	current := attr(0)
+	w.WriteString("\x1b[0m")
+	for row := 0; row < g.height; row++ {
+		fmt.Fprintf(w, "\x1b[%d;1H", row+1)
+		for _, c := range g.cells[row*g.width : (row+1)*g.width] {
+			if c.a != current {
+				w.WriteString(c.a.sgr())
+				current = c.a
+			}
+			w.WriteRune(c.r)
+		}
+	}
+	w.WriteString("\x1b[0m")
+	return w.Flush()
+}
+
+// vt is a minimal terminal the program output is drawn on. It understands
+// the control characters and the ANSI sequences LC-3 programs use to clear
+// the screen and move the cursor, and ignores the others.
+type vt struct {
+	rows, cols int
+	lines      [][]rune
+	row, col   int
+	// esc holds the escape sequence being read.
+	esc []byte
+}
+
+func newVT(rows, cols int) *vt {
+	t := &vt{rows: rows, cols: cols}
+	for i := 0; i < rows; i++ {
+		t.lines = append(t.lines, t.blank())
+	}
+	return t
+}
+
+func (t *vt) blank() []rune {
+	line := make([]rune, t.cols)
+	for i := range line {
+		line[i] = ' '
+	}
+	return line
+}
+
+// resize changes the size of the terminal, keeping the bottom of the
+// content up to the cursor.
+func (t *vt) resize(rows, cols int) {
+	old := t.lines[:t.row+1]
+	if len(old) > rows {
+		old = old[len(old)-rows:]
+	}
+	t.rows, t.cols = rows, cols
+	t.lines = nil
+	for i := 0; i < rows; i++ {
+		line := t.blank()
+		if i < len(old) {
+			copy(line, old[i])
+		}
+		t.lines = append(t.lines, line)
+	}
+	t.row, t.col = len(old)-1, min(t.col, cols-1)
+}
+
+func (t *vt) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if t.esc != nil {
+			t.escape(c)
+			continue
+		}
+		switch c {
+		case 0x1b:
+			t.esc = []byte{}
+		case '\n':
+			t.newline()
+		case '\r':
+			t.col = 0
+		case '\b':
+			t.col = max(t.col-1, 0)
+		case '\t':
+			t.col = min((t.col/8+1)*8, t.cols-1)
+		default:
+			if c >= ' ' && c != 0x7f {
+				t.put(rune(c))
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (t *vt) put(r rune) {
+	if t.col == t.cols {
+		t.newline()
+	}
+	t.lines[t.row][t.col] = r
+	t.col++
+}
+
+func (t *vt) newline() {
+	t.col = 0
+	if t.row < t.rows-1 {
+		t.row++
+		return
+	}
+	t.lines = append(t.lines[1:], t.blank())
+}
+
+// escape reads a byte of an escape sequence, running it once complete.
+// Only CSI sequences are supported.
+func (t *vt) escape(c byte) {
+	if len(t.esc) == 0 && c != '[' {
+		t.esc = nil
+		return
+	}
+	t.esc = append(t.esc, c)
+	if len(t.esc) == 1 || c < 0x40 || c > 0x7e {
+		return
+	}
+	params := string(t.esc[1 : len(t.esc)-1])
+	t.esc = nil
+	if strings.HasPrefix(params, "?") {
+		return
+	}
+	var args []int
+	for _, field := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(field)
+		args = append(args, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	switch c {
+	case 'H', 'f':
+		t.row = min(arg(0, 1), t.rows) - 1
+		t.col = min(arg(1, 1), t.cols) - 1
+	case 'A':
+		t.row = max(t.row-arg(0, 1), 0)
+	case 'B':
+		t.row = min(t.row+arg(0, 1), t.rows-1)
+	case 'C':
+		t.col = min(t.col+arg(0, 1), t.cols-1)
+	case 'D':
+		t.col = max(t.col-arg(0, 1), 0)
+	case 'J':
+		switch args[0] {
+		case 0:
+			t.erase(t.row, t.col, t.rows-1, t.cols)
+		case 1:
+			t.erase(0, 0, t.row, t.col+1)
+		default:
+			t.erase(0, 0, t.rows-1, t.cols)
+		}
+	case 'K':
+		switch args[0] {
+		case 0:
+			t.erase(t.row, t.col, t.row, t.cols)
+		case 1:
+			t.erase(t.row, 0, t.row, t.col+1)
+		default:
+			t.erase(t.row, 0, t.row, t.cols)
+		}
+	}
+}
+
+// erase blanks the cells from row, col up to toRow, toCol excluded.
+func (t *vt) erase(row, col, toRow, toCol int) {
+	for r := row; r <= toRow; r++ {
+		from, to := 0, t.cols
+		if r == row {
+			from = col
+		}
+		if r == toRow {
+			to = min(toCol, t.cols)
+		}
+		for c := from; c < to; c++ {
+			t.lines[r][c] = ' '
+		}
+	}
+}
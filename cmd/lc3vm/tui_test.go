@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// screen returns the lines of t, without trailing spaces.
+func (t *vt) screen() []string {
+	var lines []string
+	for _, line := range t.lines {
+		lines = append(lines, strings.TrimRight(string(line), " "))
+	}
+	return lines
+}
+
+func TestVT(t *testing.T) {
+	t.Run("write lines and scroll", func(t *testing.T) {
+		term := newVT(3, 8)
+		term.Write([]byte("one\ntwo\nthree\nfour"))
+		assert.Equal(t, []string{"two", "three", "four"}, term.screen())
+	})
+
+	t.Run("wrap long lines", func(t *testing.T) {
+		term := newVT(3, 4)
+		term.Write([]byte("abcdefgh"))
+		assert.Equal(t, []string{"abcd", "efgh", ""}, term.screen())
+	})
+
+	t.Run("handle control characters", func(t *testing.T) {
+		term := newVT(2, 16)
+		term.Write([]byte("abc\rX\by\tz\x07\x7f"))
+		assert.Equal(t, []string{"ybc     z", ""}, term.screen())
+	})
+
+	t.Run("move the cursor and erase", func(t *testing.T) {
+		term := newVT(3, 8)
+		term.Write([]byte("aaaa\nbbbb\ncccc"))
+		term.Write([]byte("\x1b[2;3Hx\x1b[K"))
+		assert.Equal(t, []string{"aaaa", "bbx", "cccc"}, term.screen())
+		term.Write([]byte("\x1b[A\x1b[2DY\x1b[BZ\x1b[CW"))
+		assert.Equal(t, []string{"aYaa", "bbZ W", "cccc"}, term.screen())
+		term.Write([]byte("\x1b[1J"))
+		assert.Equal(t, []string{"", "", "cccc"}, term.screen())
+		term.Write([]byte("\x1b[H\x1b[2J\x1b[?25lok"))
+		assert.Equal(t, []string{"ok", "", ""}, term.screen())
+	})
+
+	t.Run("ignore unsupported sequences", func(t *testing.T) {
+		term := newVT(2, 8)
+		term.Write([]byte("\x1bcab\x1b[1;31mc\x1b[0m"))
+		assert.Equal(t, []string{"abc", ""}, term.screen())
+	})
+
+	t.Run("keep the bottom of the content on resize", func(t *testing.T) {
+		term := newVT(4, 8)
+		term.Write([]byte("one\ntwo\nthree"))
+		term.resize(2, 4)
+		assert.Equal(t, []string{"two", "thre"}, term.screen())
+		term.Write([]byte("\nx"))
+		assert.Equal(t, []string{"thre", "x"}, term.screen())
+	})
+}
+
+func TestReadKeys(t *testing.T) {
+	keys := make(chan string)
+	go readKeys(strings.NewReader("ab\x1b[A\x1b[5~\x1bq\x1b["), keys)
+	var got []string
+	for key := range keys {
+		got = append(got, key)
+	}
+	assert.Equal(t, []string{"a", "b", keyUp, keyPageUp, keyEscape, "q", "\x1b", "["}, got)
+}
+
+func TestConsole(t *testing.T) {
+	c := &console{}
+	buf := make([]byte, 4)
+	n, err := c.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	c.Write([]byte("ab"))
+	assert.Equal(t, 2, c.Len())
+	n, err = c.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(buf[:n]))
+	assert.Equal(t, 1, c.Len())
+}
+
+// newTUI returns a TUI debugging a program at x3000, drawing to term.
+func newTUI(t *testing.T, term io.Writer, words ...uint16) *tui {
+	input, output := &console{}, newVT(tuiMinHeight, tuiMinWidth)
+	vm, err := lc3.New(lc3.WithInput(input), lc3.WithOutput(output), lc3.WithMemory(0x3000, words...), lc3.WithPC(0x3000))
+	require.NoError(t, err)
+	ui := &tui{
+		vm:      vm,
+		input:   input,
+		output:  output,
+		symbols: lc3.NewSymbolTable(lc3.Symbol{Name: "MAIN", Address: 0x3000}, lc3.Symbol{Name: "SUB", Address: 0x3003}),
+		term:    bufio.NewWriter(term),
+		breaks:  map[uint16]bool{},
+		cursor:  0x3000,
+		memory:  0x3000,
+	}
+	ui.resize(tuiMinWidth, tuiMinHeight)
+	return ui
+}
+
+// keys handles keys, running the program while it is running as runTUI
+// does.
+func (t *tui) keys(keys ...string) {
+	for _, key := range keys {
+		t.key(key, true)
+		for t.running && !t.blocked() {
+			t.execute(tuiBatch)
+		}
+	}
+}
+
+func TestTUI(t *testing.T) {
+	program := []uint16{
+		0x4802, // MAIN JSR SUB
+		0x1261, //      ADD R1, R1, #1
+		0xf025, //      HALT
+		0x14a1, // SUB  ADD R2, R2, #1
+		0xc1c0, //      RET
+	}
+
+	t.Run("step into and over calls", func(t *testing.T) {
+		ui := newTUI(t, io.Discard, program...)
+		ui.keys("s")
+		assert.Equal(t, uint16(0x3003), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, uint16(0x3003), ui.cursor)
+
+		ui = newTUI(t, io.Discard, program...)
+		ui.keys("n")
+		assert.False(t, ui.running)
+		assert.Equal(t, uint16(0x3001), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, uint16(1), ui.vm.GetRegister(lc3.RegisterR2))
+		assert.Equal(t, uint64(3), ui.steps)
+
+		// n steps over other instructions like s.
+		ui.keys("n")
+		assert.Equal(t, uint16(0x3002), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, uint16(1), ui.vm.GetRegister(lc3.RegisterR1))
+	})
+
+	t.Run("stop at breakpoints and continue from them", func(t *testing.T) {
+		ui := newTUI(t, io.Discard, program...)
+		ui.keys("j", "j", "j", "b", "c")
+		assert.False(t, ui.running)
+		assert.Equal(t, uint16(0x3003), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, "breakpoint at SUB", ui.message)
+
+		ui.keys("c")
+		assert.Equal(t, lc3.StateHalted, ui.vm.State())
+		assert.Equal(t, "halted", ui.message)
+		assert.Equal(t, uint16(1), ui.vm.GetRegister(lc3.RegisterR1))
+
+		ui.keys("s")
+		assert.Equal(t, "halted", ui.message)
+	})
+
+	t.Run("stop at breakpoints within a call stepped over", func(t *testing.T) {
+		ui := newTUI(t, io.Discard, program...)
+		ui.keys("j", "j", "j", "j", "b", "k", "k", "k", "k", "n")
+		assert.Equal(t, uint16(0x3004), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, "breakpoint at SUB+1", ui.message)
+		assert.False(t, ui.untilSet)
+	})
+
+	t.Run("wait for input", func(t *testing.T) {
+		ui := newTUI(t, io.Discard,
+			0xf020, // GETC
+			0xf021, // OUT
+			0xf020, // GETC
+			0xf025, // HALT
+		)
+		assert.True(t, ui.blocked())
+		ui.keys("s")
+		assert.True(t, ui.wantInput)
+		assert.Equal(t, uint16(0x3000), ui.vm.GetRegister(lc3.RegisterPC))
+		ui.keys("a")
+		assert.False(t, ui.wantInput)
+		assert.Equal(t, uint16('a'), ui.vm.GetRegister(lc3.RegisterR0))
+
+		// While running, keys go to the program, Enter as a newline.
+		ui.keys("c")
+		assert.True(t, ui.running)
+		assert.Equal(t, uint16(0x3002), ui.vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, "a", ui.output.screen()[0])
+		ui.keys("\r")
+		assert.Equal(t, uint16('\n'), ui.vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, lc3.StateHalted, ui.vm.State())
+	})
+
+	t.Run("pause with Ctrl-C", func(t *testing.T) {
+		ui := newTUI(t, io.Discard, 0x0fff) // BRnzp #-1
+		ui.key("c", true)
+		ui.execute(100)
+		assert.True(t, ui.running)
+		ui.key(keyCtrlC, true)
+		assert.False(t, ui.running)
+		assert.Equal(t, "paused", ui.message)
+		assert.Equal(t, uint64(100), ui.steps)
+	})
+
+	t.Run("go to an address", func(t *testing.T) {
+		ui := newTUI(t, io.Discard, program...)
+		ui.keys("g", "x", "4", "0", "0", "0", "1", "\x7f", "\r")
+		assert.Nil(t, ui.prompt)
+		assert.Equal(t, uint16(0x4000), ui.memory)
+		ui.keys("g", "z", "\r")
+		assert.Equal(t, `invalid address "z"`, ui.message)
+		ui.keys(keyPageDown)
+		assert.Equal(t, uint16(0x4000+4*ui.layout().memoryRows), ui.memory)
+	})
+
+	t.Run("lay out the panes", func(t *testing.T) {
+		for _, size := range [][2]int{{tuiMinWidth, tuiMinHeight}, {200, 60}} {
+			ui := newTUI(t, io.Discard)
+			ui.resize(size[0], size[1])
+			l := ui.layout()
+			content := size[1] - 2
+			assert.Equal(t, content, l.registersRows+l.disasmRows+l.stackRows+3, "left column of %v", size)
+			assert.Equal(t, content, l.consoleRows+l.memoryRows+2, "right column of %v", size)
+			assert.Equal(t, size[0], l.leftCols+1+l.consoleCols, "width of %v", size)
+			assert.Equal(t, []int{l.consoleRows, l.consoleCols}, []int{ui.output.rows, ui.output.cols})
+		}
+	})
+
+	t.Run("draw the screen", func(t *testing.T) {
+		var term bytes.Buffer
+		ui := newTUI(t, &term, program...)
+		ui.keys("b", "n", "q")
+		assert.True(t, ui.quit)
+		ui.draw()
+		screen := term.String()
+		assert.Contains(t, screen, " lc3vm  paused  3 instructions")
+		assert.Contains(t, screen, "> x3001")
+		assert.Contains(t, screen, "x3000 MAIN     4802  JSR x3003")
+		assert.Contains(t, screen, "●")
+		assert.Contains(t, screen, tuiHelp)
+	})
+}
@@ -0,0 +1,348 @@
+//go:build js && wasm
+
+// Command lc3wasm runs the VM in a browser. Built with GOOS=js GOARCH=wasm and
+// started with Go's wasm_exec.js, it defines a global lc3 object:
+//
+//	lc3.load(bytes, name)        load a program from a Uint8Array, the format
+//	                             chosen from the name as with lc3vm; returns
+//	                             null or an error message
+//	lc3.reset()                  reload the program
+//	lc3.step()                   execute an instruction; returns
+//	                             {executed, halted, waiting, error}
+//	lc3.run(n)                   execute up to n instructions, returning
+//	                             the same
+//	lc3.getRegister(reg)         read R0-R7, PC, COND or PSR, by name or index
+//	lc3.setRegister(reg, value)
+//	lc3.getMemory(address, n)    read n words, 1 by default, as an array;
+//	                             device registers read as 0
+//	lc3.setMemory(address, words)
+//	lc3.disassemble(address)     the instruction at address
+//	lc3.input(text)              type characters for the program
+//	lc3.onOutput(callback)       call callback(text) with the program output
+//
+// Invalid arguments make the functions return an error message.
+//
+// Programs never block: run returns with waiting set when the program waits
+// for input, and resumes where it stopped once input is typed. Call run in
+// slices, e.g. from requestAnimationFrame, to keep the page responsive.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"syscall/js"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// input holds the characters typed, returning lc3.ErrNoInput rather than
+// blocking when there are none.
+type input struct {
+	buf []byte
+}
+
+func (in *input) Read(p []byte) (int, error) {
+	if len(in.buf) == 0 {
+		return 0, lc3.ErrNoInput
+	}
+	n := copy(p, in.buf)
+	in.buf = in.buf[n:]
+	return n, nil
+}
+
+// output passes the program output to the JavaScript callback, if any.
+type output struct {
+	callback js.Value
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.callback.Type() != js.TypeFunction {
+		return len(p), nil
+	}
+	// Characters are bytes: map them to the first 256 code points rather
+	// than decoding them as UTF-8.
+	var b strings.Builder
+	for _, c := range p {
+		b.WriteRune(rune(c))
+	}
+	o.callback.Invoke(b.String())
+	return len(p), nil
+}
+
+// machine is the VM behind the lc3 object.
+type machine struct {
+	program *lc3.Object
+	vm      *lc3.VM
+	input   *input
+	output  *output
+}
+
+func main() {
+	m := &machine{output: &output{}}
+	m.reset()
+
+	api := map[string]any{
+		"load":        m.load,
+		"reset":       func(js.Value, []js.Value) any { return result(m.reset()) },
+		"step":        func(js.Value, []js.Value) any { return m.status(m.vm.RunFor(1)) },
+		"run":         m.run,
+		"getRegister": m.getRegister,
+		"setRegister": m.setRegister,
+		"getMemory":   m.getMemory,
+		"setMemory":   m.setMemory,
+		"disassemble": m.disassemble,
+		"input": func(_ js.Value, args []js.Value) any {
+			if arg(args, 0).Type() != js.TypeString {
+				return "input takes a string"
+			}
+			for _, r := range args[0].String() {
+				if r <= 0xff {
+					m.input.buf = append(m.input.buf, byte(r))
+				}
+			}
+			return nil
+		},
+		"onOutput": func(_ js.Value, args []js.Value) any {
+			m.output.callback = arg(args, 0)
+			return nil
+		},
+	}
+	object := js.Global().Get("Object").New()
+	for name, value := range api {
+		if f, ok := value.(func(js.Value, []js.Value) any); ok {
+			value = js.FuncOf(guard(f))
+		}
+		object.Set(name, value)
+	}
+	js.Global().Set("lc3", object)
+
+	// The functions must outlive main.
+	select {}
+}
+
+// guard returns f reporting a panic as an error message, since a panic in a
+// callback would stop the Go program and break every later call.
+func guard(f func(js.Value, []js.Value) any) func(js.Value, []js.Value) any {
+	return func(this js.Value, args []js.Value) (ret any) {
+		defer func() {
+			if r := recover(); r != nil {
+				ret = fmt.Sprint(r)
+			}
+		}()
+		return f(this, args)
+	}
+}
+
+// arg returns args[i], or undefined.
+func arg(args []js.Value, i int) js.Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return js.Undefined()
+}
+
+// intArg returns args[i] as an integer from 0 to limit, or def if args[i] is
+// undefined.
+func intArg(args []js.Value, i int, name string, limit, def int) (int, error) {
+	v := arg(args, i)
+	if v.IsUndefined() && def >= 0 {
+		return def, nil
+	}
+	if v.Type() != js.TypeNumber {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	n := v.Float()
+	if n != float64(int(n)) || n < 0 || n > float64(limit) {
+		return 0, fmt.Errorf("%s must be an integer from 0 to %d", name, limit)
+	}
+	return int(n), nil
+}
+
+// result returns err as a message, or null.
+func result(err error) any {
+	if err != nil {
+		return err.Error()
+	}
+	return nil
+}
+
+// reset creates a VM with the program loaded, if any, and empty input.
+func (m *machine) reset() error {
+	m.input = &input{}
+	vm, err := lc3.New(lc3.WithInput(m.input), lc3.WithOutput(m.output))
+	if err != nil {
+		return err
+	}
+	m.vm = vm
+	if m.program == nil {
+		return nil
+	}
+	return vm.LoadObject(m.program)
+}
+
+func (m *machine) load(_ js.Value, args []js.Value) any {
+	data := arg(args, 0)
+	if !data.InstanceOf(js.Global().Get("Uint8Array")) {
+		return "load takes a Uint8Array"
+	}
+	buf := make([]byte, data.Get("length").Int())
+	js.CopyBytesToGo(buf, data)
+	name := "program.obj"
+	if arg(args, 1).Type() == js.TypeString {
+		name = args[1].String()
+	}
+
+	program, err := lc3.ReadNamedProgram(name, bytes.NewReader(buf))
+	if err != nil {
+		return err.Error()
+	}
+	m.program = program
+	return result(m.reset())
+}
+
+func (m *machine) run(_ js.Value, args []js.Value) any {
+	n, err := intArg(args, 0, "count", math.MaxInt32, 1)
+	if err != nil {
+		return map[string]any{"executed": 0, "halted": false, "waiting": false, "error": err.Error()}
+	}
+	return m.status(m.vm.RunFor(n))
+}
+
+// status reports the result of running the VM. Waiting for input isn't an
+// error.
+func (m *machine) status(executed int, err error) any {
+	waiting := errors.Is(err, lc3.ErrNoInput)
+	if waiting {
+		err = nil
+	}
+	return map[string]any{
+		"executed": executed,
+		"halted":   m.vm.State() == lc3.StateHalted,
+		"waiting":  waiting,
+		"error":    result(err),
+	}
+}
+
+// register resolves a register given by name or index. PSR is returned as
+// RegisterCOUNT.
+func register(v js.Value) (lc3.Register, error) {
+	if v.Type() == js.TypeNumber {
+		if n := v.Float(); n == float64(int(n)) && n >= 0 && n < float64(lc3.RegisterCOUNT) {
+			return lc3.Register(n), nil
+		}
+	} else if v.Type() == js.TypeString {
+		name := strings.ToUpper(v.String())
+		if name == "PSR" {
+			return lc3.RegisterCOUNT, nil
+		}
+		for reg := lc3.RegisterR0; reg < lc3.RegisterCOUNT; reg++ {
+			if reg.String() == name {
+				return reg, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid register %v", v)
+}
+
+func (m *machine) getRegister(_ js.Value, args []js.Value) any {
+	reg, err := register(arg(args, 0))
+	switch {
+	case err != nil:
+		return err.Error()
+	case reg == lc3.RegisterCOUNT:
+		return int(m.vm.PSR())
+	}
+	return int(m.vm.GetRegister(reg))
+}
+
+func (m *machine) setRegister(_ js.Value, args []js.Value) any {
+	reg, err := register(arg(args, 0))
+	switch {
+	case err != nil:
+		return err.Error()
+	case reg == lc3.RegisterCOUNT:
+		return "PSR is read-only"
+	}
+	value, err := intArg(args, 1, "value", 0xffff, -1)
+	if err != nil {
+		return err.Error()
+	}
+	m.vm.SetRegister(reg, uint16(value))
+	return nil
+}
+
+// readable reports whether address can be read without side effects. Reading
+// the device registers would e.g. consume a key typed for the program.
+func readable(address int) bool {
+	return address < int(lc3.MemoryKBSR)
+}
+
+func (m *machine) getMemory(_ js.Value, args []js.Value) any {
+	address, err := intArg(args, 0, "address", 0xffff, -1)
+	if err != nil {
+		return err.Error()
+	}
+	n, err := intArg(args, 1, "count", lc3.MemorySize-address, 1)
+	if err != nil {
+		return err.Error()
+	}
+	// Device registers read as 0.
+	words := make([]any, 0, n)
+	for a := address; a < address+n; a++ {
+		var word uint16
+		if readable(a) {
+			if word, err = m.vm.GetMemory(uint16(a)); err != nil {
+				return err.Error()
+			}
+		}
+		words = append(words, int(word))
+	}
+	return words
+}
+
+func (m *machine) setMemory(_ js.Value, args []js.Value) any {
+	address, err := intArg(args, 0, "address", 0xffff, -1)
+	if err != nil {
+		return err.Error()
+	}
+	values := []js.Value{arg(args, 1)}
+	if values[0].InstanceOf(js.Global().Get("Array")) {
+		values = values[:0]
+		for i := 0; i < args[1].Length(); i++ {
+			values = append(values, args[1].Index(i))
+		}
+	}
+	if address+len(values) > lc3.MemorySize {
+		return "words extend past the end of memory"
+	}
+	words := make([]uint16, len(values))
+	for i := range values {
+		word, err := intArg(values, i, "word", 0xffff, -1)
+		if err != nil {
+			return err.Error()
+		}
+		words[i] = uint16(word)
+	}
+	for i, word := range words {
+		m.vm.SetMemory(uint16(address+i), word)
+	}
+	return nil
+}
+
+func (m *machine) disassemble(_ js.Value, args []js.Value) any {
+	address, err := intArg(args, 0, "address", 0xffff, -1)
+	if err != nil {
+		return err.Error()
+	}
+	if !readable(address) {
+		return "device register"
+	}
+	word, err := m.vm.GetMemory(uint16(address))
+	if err != nil {
+		return err.Error()
+	}
+	return lc3.Disassemble(uint16(address), word)
+}
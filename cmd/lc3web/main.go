@@ -0,0 +1,100 @@
+// Command lc3web serves a visual LC-3 simulator on a local web page: the
+// registers, a memory table with disassembly and breakpoints, a console
+// wired to the VM input and output, and step, run and pause controls.
+//
+// Each browser tab gets its own VM running the given object files, linked
+// together as with lc3vm. The page and its scripts are embedded in the
+// binary, so it works offline.
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+//go:embed static
+var static embed.FS
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "`address` to listen on")
+	entry := flag.String("entry", "", "entry point address, e.g. x3000 (default: entry of the last object)")
+	microcode := flag.Bool("microcode", false, "execute instructions through the LC-3 state machine")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, err := load(flag.Args(), *entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lc3web: %v\n", err)
+		os.Exit(1)
+	}
+	if *microcode {
+		p.opts = append(p.opts, lc3.WithEngine(lc3.EngineMicrocode))
+	}
+
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r, *addr)
+		if err != nil {
+			log.Printf("lc3web: %v", err)
+			return
+		}
+		serve(conn, p)
+	})
+	fmt.Fprintf(os.Stderr, "lc3web: serving on http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "lc3web: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// load reads and links the object files, checking that they load.
+func load(paths []string, entry string) (*program, error) {
+	var objects []*lc3.Object
+	for _, path := range paths {
+		obj, err := lc3.ReadProgramFile(path)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	pc, _ := objects[len(objects)-1].EntryPoint()
+	if entry != "" {
+		var err error
+		if pc, err = lc3.ParseAddress(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	linked, err := lc3.Link(objects...)
+	if err != nil {
+		return nil, err
+	}
+	p := &program{segments: linked.Segments(), pc: pc, symbols: lc3.NewSymbolTable(linked.Symbols...)}
+	vm, err := lc3.New()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := vm.LoadSegments(p.segments...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// Session statuses, as shown by the UI.
+const (
+	statusPaused  = "paused"
+	statusRunning = "running"
+	statusHalted  = "halted"
+	statusError   = "error"
+)
+
+const (
+	// memoryRows is the number of words of the memory table.
+	memoryRows = 24
+	// batch is the number of instructions run between checks for commands.
+	batch = 10000
+	// refresh is the interval of state updates while running.
+	refresh = 100 * time.Millisecond
+)
+
+// program is what each session loads.
+type program struct {
+	segments []lc3.Segment
+	pc       uint16
+	symbols  *lc3.SymbolTable
+	opts     []lc3.Option
+}
+
+// command is a message from the browser. Address is used by break and view,
+// Data by input.
+type command struct {
+	Cmd     string `json:"cmd"`
+	Address uint16 `json:"address"`
+	Data    string `json:"data"`
+}
+
+// row is a word of the memory table. Device registers aren't read, reading
+// some of them having side effects.
+type row struct {
+	Address    uint16 `json:"address"`
+	Word       uint16 `json:"word"`
+	Label      string `json:"label,omitempty"`
+	Text       string `json:"text"`
+	Device     bool   `json:"device,omitempty"`
+	Breakpoint bool   `json:"breakpoint,omitempty"`
+}
+
+// message is console output, a reset clearing the console, or a wait for
+// input.
+type message struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+}
+
+// state is the state of the VM and the memory table.
+type state struct {
+	Type      string   `json:"type"`
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+	Registers []uint16 `json:"registers"`
+	PC        uint16   `json:"pc"`
+	PSR       uint16   `json:"psr"`
+	Steps     uint64   `json:"steps"`
+	Follow    bool     `json:"follow"`
+	Memory    []row    `json:"memory"`
+}
+
+// session is the VM of a browser connection. The browser drives it with
+// commands, which loop runs in order; input goes straight to the console,
+// the VM possibly being blocked reading it.
+type session struct {
+	conn     *wsConn
+	program  *program
+	commands chan command
+
+	mu sync.Mutex
+	// console is replaced by loop on reset, and closed by the reader to
+	// unblock the VM.
+	console *console
+
+	vm          *lc3.VM
+	status      string
+	err         error
+	steps       uint64
+	breakpoints map[uint16]bool
+	// resume skips the breakpoint at PC when running or stepping from it.
+	resume bool
+	view   uint16
+	follow bool
+}
+
+// serve runs a session until the browser disconnects.
+func serve(conn *wsConn, p *program) {
+	s := &session{
+		conn:        conn,
+		program:     p,
+		commands:    make(chan command, 64),
+		breakpoints: map[uint16]bool{},
+		follow:      true,
+	}
+	s.reset()
+	done := make(chan struct{})
+	go func() {
+		s.loop()
+		close(done)
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("lc3web: %v", err)
+			}
+			break
+		}
+		var cmd command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			log.Printf("lc3web: invalid command: %v", err)
+			continue
+		}
+		switch cmd.Cmd {
+		case "input":
+			s.currentConsole().Write(cmd.Data)
+			continue
+		case "reset":
+			s.currentConsole().Close()
+		}
+		// The loop may be blocked on input: drop commands rather than
+		// blocking the input behind them.
+		select {
+		case s.commands <- cmd:
+		default:
+			log.Printf("lc3web: dropped command %q", cmd.Cmd)
+		}
+	}
+	close(s.commands)
+	s.currentConsole().Close()
+	<-done
+	conn.Close()
+}
+
+func (s *session) currentConsole() *console {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.console
+}
+
+// loop runs the commands, and the VM in batches while running.
+func (s *session) loop() {
+	s.sendState()
+	last := time.Now()
+	for {
+		var cmd command
+		var ok bool
+		if s.status == statusRunning {
+			select {
+			case cmd, ok = <-s.commands:
+			default:
+				s.execute(batch)
+				if s.status != statusRunning || time.Since(last) >= refresh {
+					s.sendState()
+					last = time.Now()
+				}
+				continue
+			}
+		} else {
+			cmd, ok = <-s.commands
+		}
+		if !ok {
+			return
+		}
+		s.handle(cmd)
+		s.sendState()
+	}
+}
+
+func (s *session) handle(cmd command) {
+	switch cmd.Cmd {
+	case "step":
+		if s.status == statusPaused {
+			s.resume = true
+			s.execute(1)
+		}
+	case "run":
+		if s.status == statusPaused {
+			s.status, s.resume = statusRunning, true
+		}
+	case "pause":
+		if s.status == statusRunning {
+			s.status = statusPaused
+		}
+	case "reset":
+		s.reset()
+	case "break":
+		if s.breakpoints[cmd.Address] {
+			delete(s.breakpoints, cmd.Address)
+		} else {
+			s.breakpoints[cmd.Address] = true
+		}
+	case "view":
+		s.view, s.follow = cmd.Address, false
+	case "follow":
+		s.follow = true
+	default:
+		log.Printf("lc3web: unknown command %q", cmd.Cmd)
+	}
+}
+
+// reset loads the program into a new VM, keeping the breakpoints.
+func (s *session) reset() {
+	c := newConsole(func() { s.send(message{Type: "input"}) })
+	s.mu.Lock()
+	s.console = c
+	s.mu.Unlock()
+
+	opts := append(slices.Clip(s.program.opts), lc3.WithInput(c), lc3.WithOutput(output{s}), lc3.WithPC(s.program.pc))
+	vm, err := lc3.New(opts...)
+	if err == nil {
+		_, err = vm.LoadSegments(s.program.segments...)
+	}
+	s.vm, s.status, s.err, s.steps = vm, statusPaused, nil, 0
+	if err != nil {
+		s.status, s.err = statusError, err
+	}
+	s.send(message{Type: "reset"})
+}
+
+// execute runs up to n instructions, stopping at breakpoints.
+func (s *session) execute(n int) {
+	for i := 0; i < n; i++ {
+		if s.vm.State() != lc3.StateRunning {
+			s.status = statusHalted
+			return
+		}
+		if s.breakpoints[s.vm.GetRegister(lc3.RegisterPC)] && !s.resume {
+			s.status = statusPaused
+			return
+		}
+		s.resume = false
+		if err := s.vm.Step(); err != nil {
+			if s.console.closed() {
+				// Reset while waiting for input.
+				return
+			}
+			s.status, s.err = statusError, err
+			return
+		}
+		s.steps++
+	}
+	if s.vm.State() != lc3.StateRunning {
+		s.status = statusHalted
+	}
+}
+
+// sendState sends the registers and the memory table.
+func (s *session) sendState() {
+	m := state{Type: "state", Status: s.status, Steps: s.steps, Follow: s.follow}
+	if s.err != nil {
+		m.Error = s.err.Error()
+	}
+	if s.vm == nil {
+		s.send(m)
+		return
+	}
+	for reg := lc3.RegisterR0; reg <= lc3.RegisterR7; reg++ {
+		m.Registers = append(m.Registers, s.vm.GetRegister(reg))
+	}
+	m.PC, m.PSR = s.vm.GetRegister(lc3.RegisterPC), s.vm.PSR()
+
+	if s.follow {
+		s.view = m.PC - memoryRows/3
+	}
+	for i := 0; i < memoryRows; i++ {
+		address := s.view + uint16(i)
+		r := row{Address: address, Breakpoint: s.breakpoints[address]}
+		if sym, ok := s.program.symbols.Lookup(address); ok && sym.Address == address {
+			r.Label = sym.Name
+		}
+		if address >= lc3.MemoryKBSR {
+			r.Device = true
+		} else {
+			r.Word, _ = s.vm.GetMemory(address)
+			r.Text = lc3.Disassemble(address, r.Word)
+		}
+		m.Memory = append(m.Memory, r)
+	}
+	s.send(m)
+}
+
+// send sends m as JSON.
+func (s *session) send(m any) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("lc3web: %v", err)
+		return
+	}
+	// Write errors mean the browser is gone, which the reader notices.
+	s.conn.WriteText(data)
+}
+
+// output sends the VM output to the console of the browser.
+type output struct {
+	s *session
+}
+
+func (o output) Write(p []byte) (int, error) {
+	// Characters are bytes: map them to the first 256 code points rather
+	// than decoding them as UTF-8.
+	var b strings.Builder
+	for _, c := range p {
+		b.WriteRune(rune(c))
+	}
+	o.s.send(message{Type: "output", Data: b.String()})
+	return len(p), nil
+}
+
+// console is the VM input, fed by the browser. Reads block until a key is
+// typed or the console is closed.
+type console struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []byte
+	done    bool
+	waiting func()
+}
+
+func newConsole(waiting func()) *console {
+	c := &console{waiting: waiting}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *console) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) == 0 && !c.done {
+		c.waiting()
+	}
+	for len(c.buf) == 0 && !c.done {
+		c.cond.Wait()
+	}
+	if len(c.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write queues the characters typed, the code points up to 255 as bytes.
+func (c *console) Write(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range data {
+		if r <= 0xff {
+			c.buf = append(c.buf, byte(r))
+		}
+	}
+	c.cond.Broadcast()
+}
+
+func (c *console) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	c.cond.Broadcast()
+}
+
+func (c *console) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
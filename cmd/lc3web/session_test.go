@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reply is any message of a session.
+type reply struct {
+	Type      string
+	Data      string
+	Status    string
+	Error     string
+	Registers []uint16
+	PC        uint16
+	Steps     uint64
+	Memory    []row
+}
+
+// send sends a command as the browser does.
+func (c *testClient) send(cmd command) {
+	data, err := json.Marshal(cmd)
+	require.NoError(c.t, err)
+	c.writeFrame(true, opText, data, true)
+}
+
+// expect reads messages until one of type typ, returning it.
+func (c *testClient) expect(typ string) reply {
+	for {
+		op, payload, err := c.readFrame()
+		require.NoError(c.t, err)
+		require.Equal(c.t, byte(opText), op)
+		var r reply
+		require.NoError(c.t, json.Unmarshal(payload, &r))
+		if r.Type == typ {
+			return r
+		}
+	}
+}
+
+// until reads states until one has the given status.
+func (c *testClient) until(status string) reply {
+	for {
+		if r := c.expect("state"); r.Status == status {
+			return r
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	p := &program{
+		segments: []lc3.Segment{{Origin: 0x3000, Words: []uint16{
+			0xf020, // GETC
+			0xf021, // OUT
+			0x1261, // ADD R1, R1, #1
+			0xf025, // HALT
+		}}},
+		pc:      0x3000,
+		symbols: lc3.NewSymbolTable(lc3.Symbol{Name: "START", Address: 0x3000}),
+	}
+	srv := newServer(t, func(conn *wsConn) { serve(conn, p) })
+	c := dial(t, srv)
+
+	c.expect("reset")
+	r := c.expect("state")
+	assert.Equal(t, statusPaused, r.Status)
+	assert.Equal(t, uint16(0x3000), r.PC)
+	require.Len(t, r.Memory, memoryRows)
+	start := r.Memory[memoryRows/3]
+	assert.Equal(t, row{Address: 0x3000, Word: 0xf020, Label: "START", Text: "GETC"}, start)
+
+	c.send(command{Cmd: "break", Address: 0x3002})
+	r = c.expect("state")
+	assert.True(t, r.Memory[memoryRows/3+2].Breakpoint)
+
+	// GETC waits for a key.
+	c.send(command{Cmd: "step"})
+	c.expect("input")
+	c.send(command{Cmd: "input", Data: "a"})
+	r = c.expect("state")
+	assert.Equal(t, uint16(0x3001), r.PC)
+	assert.Equal(t, uint16('a'), r.Registers[0])
+	assert.Equal(t, uint64(1), r.Steps)
+
+	// Run up to the breakpoint, then on from it to HALT.
+	c.send(command{Cmd: "run"})
+	assert.Equal(t, "a", c.expect("output").Data)
+	r = c.until(statusPaused)
+	assert.Equal(t, uint16(0x3002), r.PC)
+	assert.Equal(t, uint16(0), r.Registers[1])
+
+	c.send(command{Cmd: "run"})
+	r = c.until(statusHalted)
+	assert.Equal(t, uint16(1), r.Registers[1])
+
+	c.send(command{Cmd: "view", Address: 0xfdf8})
+	r = c.expect("state")
+	assert.Equal(t, uint16(0xfdf8), r.Memory[0].Address)
+	assert.False(t, r.Memory[7].Device)
+	assert.Equal(t, row{Address: 0xfe00, Device: true}, r.Memory[8])
+
+	// A reset unblocks a VM waiting for input and keeps the breakpoints.
+	c.send(command{Cmd: "reset"})
+	c.expect("reset")
+	r = c.expect("state")
+	assert.Equal(t, statusPaused, r.Status)
+	assert.Equal(t, uint16(0x3000), r.PC)
+	c.send(command{Cmd: "follow"})
+	c.send(command{Cmd: "run"})
+	c.expect("input")
+	c.send(command{Cmd: "reset"})
+	c.expect("reset")
+	r = c.until(statusPaused)
+	assert.Equal(t, uint16(0x3000), r.PC)
+	assert.Equal(t, uint64(0), r.Steps)
+	assert.True(t, r.Memory[memoryRows/3+2].Breakpoint)
+}
@@ -0,0 +1,126 @@
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+const hex = (value) => "x" + value.toString(16).toUpperCase().padStart(4, "0");
+
+const socket = new WebSocket(`ws://${location.host}/ws`);
+
+function send(cmd, fields) {
+  socket.send(JSON.stringify(Object.assign({ cmd }, fields)));
+}
+
+function flags(psr) {
+  return ["n", "z", "p"].filter((flag, i) => psr & (4 >> i)).join("");
+}
+
+function cell(row, text) {
+  const td = row.insertCell();
+  td.textContent = text;
+  return td;
+}
+
+function render(state) {
+  $("status").textContent = state.status;
+  $("error").textContent = state.error || "";
+  $("steps").textContent = `${state.steps} instructions`;
+  $("follow").checked = state.follow;
+  $("waiting").hidden = true;
+
+  const registers = $("registers");
+  registers.replaceChildren();
+  (state.registers || []).forEach((value, i) => {
+    const row = registers.insertRow();
+    cell(row, `R${i}`);
+    cell(row, hex(value));
+    cell(row, (value << 16 >> 16).toString());
+  });
+  for (const [name, value] of [["PC", hex(state.pc)], ["PSR", hex(state.psr)], ["CC", flags(state.psr)]]) {
+    const row = registers.insertRow();
+    cell(row, name);
+    cell(row, value);
+  }
+
+  const memory = $("memory").tBodies[0];
+  memory.replaceChildren();
+  for (const word of state.memory || []) {
+    const row = memory.insertRow();
+    if (word.address === state.pc) {
+      row.className = "pc";
+    } else if (word.device) {
+      row.className = "device";
+    }
+    const dot = cell(row, word.breakpoint ? "●" : "");
+    dot.title = "Toggle breakpoint";
+    dot.onclick = () => send("break", { address: word.address });
+    cell(row, hex(word.address));
+    cell(row, word.label || "");
+    cell(row, word.device ? "" : hex(word.word));
+    cell(row, word.device ? "device register" : word.text);
+  }
+}
+
+const output = $("console");
+// view is the first address of the memory table.
+let view = 0x3000;
+
+socket.onmessage = (event) => {
+  const message = JSON.parse(event.data);
+  switch (message.type) {
+  case "state":
+    view = message.memory.length ? message.memory[0].address : view;
+    render(message);
+    break;
+  case "output":
+    output.textContent += message.data;
+    output.scrollTop = output.scrollHeight;
+    break;
+  case "reset":
+    output.textContent = "";
+    break;
+  case "input":
+    $("waiting").hidden = false;
+    output.focus();
+    break;
+  }
+};
+
+socket.onclose = () => {
+  $("status").textContent = "disconnected";
+};
+
+for (const cmd of ["step", "run", "pause", "reset"]) {
+  $(cmd).onclick = () => send(cmd);
+}
+
+$("goto").onsubmit = (event) => {
+  event.preventDefault();
+  let text = $("address").value.trim();
+  if (/^x/i.test(text)) {
+    text = "0x" + text.slice(1);
+  }
+  const address = Number(text);
+  if (Number.isInteger(address) && address >= 0 && address <= 0xffff) {
+    send("view", { address });
+  }
+};
+
+$("follow").onchange = (event) => {
+  if (event.target.checked) {
+    send("follow");
+  } else {
+    send("view", { address: view });
+  }
+};
+
+output.onkeydown = (event) => {
+  let data = event.key;
+  if (data === "Enter") {
+    data = "\n";
+  } else if (data === "Backspace") {
+    data = "\b";
+  } else if (data.length !== 1 || event.ctrlKey || event.metaKey) {
+    return;
+  }
+  event.preventDefault();
+  send("input", { data });
+};
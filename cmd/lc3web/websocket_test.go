@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient is a WebSocket client writing hand-built frames.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newServer starts a server upgrading /ws connections and passing them to
+// handle.
+func newServer(t *testing.T, handle func(*wsConn)) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrade(w, r, srv.Listener.Addr().String())
+		if err != nil {
+			return
+		}
+		handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// handshake sends an opening handshake to srv with the given headers, and
+// returns the response.
+func handshake(t *testing.T, srv *httptest.Server, header map[string]string) (*http.Response, *testClient) {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	h := map[string]string{
+		"Host":                  srv.Listener.Addr().String(),
+		"Connection":            "keep-alive, Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+		"Origin":                srv.URL,
+	}
+	for name, value := range header {
+		h[name] = value
+	}
+	var req strings.Builder
+	req.WriteString("GET /ws HTTP/1.1\r\n")
+	for name, value := range h {
+		if value != "" {
+			fmt.Fprintf(&req, "%s: %s\r\n", name, value)
+		}
+	}
+	req.WriteString("\r\n")
+	_, err = conn.Write([]byte(req.String()))
+	require.NoError(t, err)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	return resp, &testClient{t: t, conn: conn, r: r}
+}
+
+// dial opens a WebSocket connection to srv.
+func dial(t *testing.T, srv *httptest.Server) *testClient {
+	resp, c := handshake(t, srv, nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	return c
+}
+
+// writeFrame sends a frame, masked as browsers do unless masked is false.
+func (c *testClient) writeFrame(fin bool, op byte, payload []byte, masked bool) {
+	header := []byte{op, 0}
+	if fin {
+		header[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		header[1] |= 0x80
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		header = append(header, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	_, err := c.conn.Write(append(header, data...))
+	require.NoError(c.t, err)
+}
+
+// readFrame reads an unmasked frame from the server.
+func (c *testClient) readFrame() (op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		return 0, nil, fmt.Errorf("unexpected frame header % x", header)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(c.r, payload)
+	return header[0] & 0x0f, payload, err
+}
+
+func TestHandshake(t *testing.T) {
+	srv := newServer(t, func(conn *wsConn) { conn.Close() })
+
+	t.Run("accept", func(t *testing.T) {
+		// The example of RFC 6455 section 1.3.
+		resp, _ := handshake(t, srv, nil)
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+		assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+	})
+
+	t.Run("accept without origin", func(t *testing.T) {
+		resp, _ := handshake(t, srv, map[string]string{"Origin": ""})
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	})
+
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	testCases := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"not an upgrade", map[string]string{"Upgrade": ""}, http.StatusBadRequest},
+		{"old version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"no key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest},
+		{"cross-origin", map[string]string{"Origin": "http://example.com"}, http.StatusForbidden},
+		{"DNS rebinding", map[string]string{
+			"Host":   fmt.Sprintf("rebind.example.com:%d", port),
+			"Origin": fmt.Sprintf("http://rebind.example.com:%d", port),
+		}, http.StatusForbidden},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := handshake(t, srv, test.header)
+			assert.Equal(t, test.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestLocalHost(t *testing.T) {
+	testCases := []struct {
+		host, addr string
+		local      bool
+	}{
+		{"localhost:8080", "localhost:8080", true},
+		{"127.0.0.1:8080", "localhost:8080", true},
+		{"[::1]:8080", ":8080", true},
+		{"lc3.lan:8080", "lc3.lan:8080", true},
+		{"LC3.lan", "lc3.lan:8080", true},
+		{"evil.example.com:8080", "localhost:8080", false},
+		{"evil.example.com:8080", ":8080", false},
+	}
+	for _, test := range testCases {
+		assert.Equal(t, test.local, localHost(test.host, test.addr), "%s on %s", test.host, test.addr)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	// echo returns each message read, and the final error.
+	errs := make(chan error, 1)
+	srv := newServer(t, func(conn *wsConn) {
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := conn.WriteText(message); err != nil {
+				errs <- err
+				return
+			}
+		}
+	})
+
+	t.Run("payload lengths", func(t *testing.T) {
+		c := dial(t, srv)
+		for _, n := range []int{0, 125, 126, 300, 0xffff, 0x10000, 70000} {
+			payload := bytes.Repeat([]byte{'a' + byte(n%26)}, n)
+			c.writeFrame(true, opText, payload, true)
+			op, echo, err := c.readFrame()
+			require.NoError(t, err)
+			assert.Equal(t, byte(opText), op)
+			assert.Equal(t, payload, echo, "length %d", n)
+		}
+		c.writeFrame(true, opClose, []byte{0x03, 0xe8}, true)
+		op, payload, err := c.readFrame()
+		require.NoError(t, err)
+		assert.Equal(t, byte(opClose), op)
+		assert.Equal(t, []byte{0x03, 0xe8}, payload)
+		assert.Equal(t, io.EOF, <-errs)
+	})
+
+	t.Run("fragments and control frames", func(t *testing.T) {
+		c := dial(t, srv)
+		c.writeFrame(false, opText, []byte("hel"), true)
+		c.writeFrame(true, opPing, []byte("ping"), true)
+		c.writeFrame(true, opPong, nil, true)
+		c.writeFrame(false, opContinuation, []byte("lo "), true)
+		c.writeFrame(true, opContinuation, []byte("world"), true)
+
+		op, payload, err := c.readFrame()
+		require.NoError(t, err)
+		assert.Equal(t, byte(opPong), op)
+		assert.Equal(t, "ping", string(payload))
+		op, payload, err = c.readFrame()
+		require.NoError(t, err)
+		assert.Equal(t, byte(opText), op)
+		assert.Equal(t, "hello world", string(payload))
+		c.conn.Close()
+		<-errs
+	})
+
+	t.Run("invalid frames", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			write func(c *testClient)
+		}{
+			{"unmasked", func(c *testClient) { c.writeFrame(true, opText, []byte("hi"), false) }},
+			{"fragmented control frame", func(c *testClient) { c.writeFrame(false, opPing, nil, true) }},
+			{"long control frame", func(c *testClient) { c.writeFrame(true, opPing, make([]byte, 126), true) }},
+			{"unknown opcode", func(c *testClient) { c.writeFrame(true, 0x3, nil, true) }},
+			{"too large", func(c *testClient) {
+				c.writeFrame(false, opBinary, make([]byte, maxMessage), true)
+				c.writeFrame(true, opContinuation, []byte("x"), true)
+			}},
+		}
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				c := dial(t, srv)
+				test.write(c)
+				err := <-errs
+				assert.Error(t, err)
+				assert.NotEqual(t, io.EOF, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package lc3
+
+import "fmt"
+
+// DataRegion is a range of memory holding data, e.g. strings or buffers.
+type DataRegion struct {
+	Origin uint16
+	Size   uint16
+}
+
+// CodeViolation is a fetch of a word that isn't code.
+type CodeViolation struct {
+	PC   uint16
+	Inst uint16
+	// Written tells whether the word was written at runtime, by the
+	// instruction at Writer; otherwise it lies in a data region.
+	Written bool
+	Writer  uint16
+	// From is the address of the last instruction transferring control
+	// elsewhere than the next instruction, if HasFrom.
+	From    uint16
+	HasFrom bool
+	// Count is the number of times the word was fetched.
+	Count uint64
+}
+
+func (c *CodeViolation) repeat() { c.Count++ }
+
+func (c CodeViolation) String() string {
+	s := fmt.Sprintf("execution of data at x%04X (%s)", c.PC, Disassemble(c.PC, c.Inst))
+	if c.Written {
+		s = fmt.Sprintf("execution of a word written by x%04X at x%04X (%s)", c.Writer, c.PC, Disassemble(c.PC, c.Inst))
+	}
+	if c.HasFrom {
+		s += fmt.Sprintf(", reached from x%04X", c.From)
+	}
+	return s
+}
+
+// CodeViolationError reports a code violation with CheckError.
+type CodeViolationError struct {
+	CodeViolation
+}
+
+func (e *CodeViolationError) Error() string {
+	return e.String()
+}
+
+// WithCodeGuard checks that instructions are neither fetched from the data
+// regions nor from words written since loading (self-modifying code).
+func WithCodeGuard(mode CheckMode, data ...DataRegion) Option {
+	return func(o *options) {
+		o.codeGuard = mode
+		o.dataRegions = append(o.dataRegions, data...)
+	}
+}
+
+// codeGuard tracks data regions and runtime writes.
+type codeGuard struct {
+	mode CheckMode
+	data [MemorySize / 64]uint64
+	// writers holds the address of the instruction which last wrote each
+	// word at runtime.
+	writers map[uint16]uint16
+	// current is the address of the instruction being executed.
+	current    uint16
+	from       uint16
+	hasFrom    bool
+	violations recorder[uint16, CodeViolation]
+}
+
+func newCodeGuard(mode CheckMode, regions []DataRegion) *codeGuard {
+	g := &codeGuard{mode: mode, writers: map[uint16]uint16{}}
+	for _, region := range regions {
+		for i := uint16(0); i < region.Size; i++ {
+			address := region.Origin + i
+			g.data[address/64] |= 1 << (address % 64)
+		}
+	}
+	return g
+}
+
+// CodeViolations returns the violations recorded with CheckReport.
+func (v *VM) CodeViolations() []CodeViolation {
+	if v.codeGuard == nil {
+		return nil
+	}
+	return v.codeGuard.violations.list()
+}
+
+// checkFetch checks the instruction about to execute at pc.
+func (v *VM) checkFetch(pc uint16, inst uint16) error {
+	g := v.codeGuard
+	g.current = pc
+	writer, written := g.writers[pc]
+	if !written && g.data[pc/64]&(1<<(pc%64)) == 0 {
+		return nil
+	}
+
+	violation := CodeViolation{PC: pc, Inst: inst, Written: written, Writer: writer, From: g.from, HasFrom: g.hasFrom, Count: 1}
+	if g.mode == CheckError {
+		return &CodeViolationError{violation}
+	}
+	record(&g.violations, pc, violation)
+	return nil
+}
+
+// trackTransfer remembers the instruction at pc if it didn't continue with
+// the next one.
+func (v *VM) trackTransfer(pc uint16) {
+	if v.registers[RegisterPC] != pc+1 {
+		v.codeGuard.from, v.codeGuard.hasFrom = pc, true
+	}
+}
@@ -0,0 +1,78 @@
+package lc3_test
+
+import (
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dataSource = `        .ORIG x3000
+        BR START
+        HALT
+START   LEA R0, MSG
+        PUTS        ; falls into the string
+MSG     .STRINGZ "a"
+BUF     .BLKW 2
+        .END
+`
+
+func TestCodeGuard(t *testing.T) {
+	m, err := lc3.ReadSourceMap(strings.NewReader(dataSource), "data.asm")
+	require.NoError(t, err)
+	assert.Equal(t, []lc3.DataRegion{{Origin: 0x3004, Size: 4}}, m.DataRegions())
+	program := []uint16{0x0e01, 0xf025, 0xe001, 0xf022, 0x0061, 0x0000}
+
+	t.Run("report execution of data", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithCodeGuard(lc3.CheckReport, m.DataRegions()...),
+			lc3.WithMemory(0x3000, program...),
+		)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, vm.Step())
+		}
+		violations := vm.CodeViolations()
+		assert.Equal(t, []lc3.CodeViolation{
+			{PC: 0x3004, Inst: 0x0061, From: 0x3000, HasFrom: true, Count: 1},
+			{PC: 0x3005, Inst: 0x0000, From: 0x3000, HasFrom: true, Count: 1},
+		}, violations)
+		assert.Equal(t, "execution of data at x3004 (NOP), reached from x3000", violations[0].String())
+	})
+
+	t.Run("fail on execution of data", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineJIT, lc3.EngineMicrocode} {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithCodeGuard(lc3.CheckError, m.DataRegions()...),
+				lc3.WithMemory(0x3000, program...),
+			)
+			require.NoError(t, err)
+			err = vm.Run()
+			var violation *lc3.CodeViolationError
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, uint16(0x3004), violation.PC)
+			assert.Equal(t, uint16(0x3004), vm.GetRegister(lc3.RegisterPC))
+		}
+	})
+
+	t.Run("report self-modifying code", func(t *testing.T) {
+		// LD R1, INST; ST R1, TARGET
+		// TARGET: .FILL 0
+		// INST: HALT
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineMicrocode} {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithCodeGuard(lc3.CheckReport),
+				lc3.WithMemory(0x3000, 0x2202, 0x3200, 0x0000, 0xf025),
+			)
+			require.NoError(t, err)
+			require.NoError(t, vm.Run())
+			violations := vm.CodeViolations()
+			assert.Equal(t, []lc3.CodeViolation{{PC: 0x3002, Inst: 0xf025, Written: true, Writer: 0x3001, Count: 1}}, violations)
+			assert.Equal(t, "execution of a word written by x3001 at x3002 (HALT)", violations[0].String())
+		}
+	})
+}
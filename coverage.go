@@ -0,0 +1,302 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageHeader starts coverage files.
+const coverageHeader = "lc3 coverage"
+
+// Coverage is a tracer recording which instructions were executed, and for
+// conditional branches how many times they were taken or not.
+type Coverage struct {
+	counts   map[uint16]uint64
+	branches map[uint16]*[2]uint64
+}
+
+// NewCoverage returns an empty coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{counts: map[uint16]uint64{}, branches: map[uint16]*[2]uint64{}}
+}
+
+func (c *Coverage) Trace(v *VM, pc uint16, inst uint16) {
+	c.counts[pc]++
+	nzp := (inst >> 9) & 0x7
+	if inst>>12 != OperationBR || nzp == 0 || nzp == 0x7 {
+		return
+	}
+
+	branch := c.branch(pc)
+	// BR doesn't change the condition codes it tested.
+	if v.GetRegister(RegisterCOND)&nzp != 0 {
+		branch[0]++
+	} else {
+		branch[1]++
+	}
+}
+
+func (c *Coverage) branch(pc uint16) *[2]uint64 {
+	branch := c.branches[pc]
+	if branch == nil {
+		branch = &[2]uint64{}
+		c.branches[pc] = branch
+	}
+	return branch
+}
+
+// Count returns the number of executions of the instruction at address.
+func (c *Coverage) Count(address uint16) uint64 {
+	return c.counts[address]
+}
+
+// Branch returns the number of times the conditional branch at address was
+// taken and not taken.
+func (c *Coverage) Branch(address uint16) (taken, notTaken uint64) {
+	if branch := c.branches[address]; branch != nil {
+		return branch[0], branch[1]
+	}
+	return 0, 0
+}
+
+// Merge adds the counts of other runs.
+func (c *Coverage) Merge(others ...*Coverage) {
+	for _, other := range others {
+		for pc, count := range other.counts {
+			c.counts[pc] += count
+		}
+		for pc, counts := range other.branches {
+			branch := c.branch(pc)
+			branch[0] += counts[0]
+			branch[1] += counts[1]
+		}
+	}
+}
+
+// WriteCoverage writes the raw coverage, to be merged or reported later: one
+// line per executed address with its count, followed by the taken and not
+// taken counts of conditional branches.
+func WriteCoverage(w io.Writer, c *Coverage) error {
+	pcs := make([]int, 0, len(c.counts))
+	for pc := range c.counts {
+		pcs = append(pcs, int(pc))
+	}
+	sort.Ints(pcs)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, coverageHeader)
+	for _, pc := range pcs {
+		fmt.Fprintf(bw, "x%04X %d", pc, c.counts[uint16(pc)])
+		if branch := c.branches[uint16(pc)]; branch != nil {
+			fmt.Fprintf(bw, " %d %d", branch[0], branch[1])
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// ReadCoverage reads coverage written by WriteCoverage.
+func ReadCoverage(r io.Reader) (*Coverage, error) {
+	c := NewCoverage()
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != coverageHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading coverage: %w", err)
+		}
+		return nil, &SyntaxError{Line: 1, Msg: "not a coverage file"}
+	}
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 && len(fields) != 4 {
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid coverage line %q", scanner.Text())}
+		}
+		address, err := parseAssemblyNumber(fields[0])
+		if err != nil || address < 0 || address >= int64(MemorySize) {
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid address %q", fields[0])}
+		}
+		var counts []uint64
+		for _, field := range fields[1:] {
+			count, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid count %q", field)}
+			}
+			counts = append(counts, count)
+		}
+		c.counts[uint16(address)] += counts[0]
+		if len(counts) == 3 {
+			branch := c.branch(uint16(address))
+			branch[0] += counts[1]
+			branch[1] += counts[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading coverage: %w", err)
+	}
+	return c, nil
+}
+
+// LineCoverage is the coverage of an instruction line of a source.
+type LineCoverage struct {
+	Line  int
+	Count uint64
+	// Branch tells whether the line is a conditional branch, taken and not
+	// taken the given number of times.
+	Branch          bool
+	Taken, NotTaken uint64
+}
+
+// Lines returns the coverage of the instruction lines of a source.
+func (c *Coverage) Lines(m *SourceMap) []LineCoverage {
+	var lines []LineCoverage
+	for _, span := range m.spans {
+		if !span.code {
+			continue
+		}
+		line := LineCoverage{Line: span.Line, Count: c.counts[span.Address]}
+		if flags := strings.TrimPrefix(span.op, "BR"); flags != span.op && flags != "" && len(flags) < 3 {
+			line.Branch = true
+			line.Taken, line.NotTaken = c.Branch(span.Address)
+		}
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+	return lines
+}
+
+// WriteLcov writes an lcov tracefile with the line and branch coverage of
+// each source.
+func (c *Coverage) WriteLcov(w io.Writer, sources ...*SourceMap) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range sources {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", m.File)
+		lines := c.Lines(m)
+		var hit, branches, branchesHit int
+		for _, line := range lines {
+			if !line.Branch {
+				continue
+			}
+			for i, count := range []uint64{line.Taken, line.NotTaken} {
+				taken := "-"
+				if line.Count > 0 {
+					taken = strconv.FormatUint(count, 10)
+				}
+				fmt.Fprintf(bw, "BRDA:%d,0,%d,%s\n", line.Line, i, taken)
+				branches++
+				if count > 0 {
+					branchesHit++
+				}
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line.Line, line.Count)
+			if line.Count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
+
+// WriteHTML writes an HTML page listing each source with its executed lines
+// in green, its missed lines in red and its partially taken branches in
+// yellow.
+func (c *Coverage) WriteHTML(w io.Writer, sources ...*SourceMap) error {
+	type row struct {
+		Line   int
+		Class  string
+		Count  string
+		Title  string
+		Source string
+	}
+	type file struct {
+		Name    string
+		Summary string
+		Rows    []row
+	}
+
+	var files []file
+	for _, m := range sources {
+		byLine := map[int]LineCoverage{}
+		var hit, branches, branchesHit int
+		lines := c.Lines(m)
+		for _, line := range lines {
+			byLine[line.Line] = line
+			if line.Count > 0 {
+				hit++
+			}
+			if line.Branch {
+				branches += 2
+				branchesHit += btoi(line.Taken > 0) + btoi(line.NotTaken > 0)
+			}
+		}
+
+		f := file{Name: m.File, Summary: fmt.Sprintf("lines %s, branches %s",
+			ratio(hit, len(lines)), ratio(branchesHit, branches))}
+		for i, text := range m.Source {
+			r := row{Line: i + 1, Source: text}
+			if line, ok := byLine[i+1]; ok {
+				r.Count = strconv.FormatUint(line.Count, 10)
+				switch {
+				case line.Count == 0:
+					r.Class = "miss"
+				case line.Branch && (line.Taken == 0 || line.NotTaken == 0):
+					r.Class = "partial"
+				default:
+					r.Class = "hit"
+				}
+				if line.Branch {
+					r.Title = fmt.Sprintf("taken %d, not taken %d", line.Taken, line.NotTaken)
+				}
+			}
+			f.Rows = append(f.Rows, r)
+		}
+		files = append(files, f)
+	}
+	return coverageTemplate.Execute(w, files)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func ratio(n, total int) string {
+	if total == 0 {
+		return "0/0"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", n, total, float64(n)*100/float64(total))
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LC-3 coverage</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; }
+td { padding: 0 0.5em; white-space: pre; }
+td.num { text-align: right; color: #888; }
+tr.hit { background: #dfd; }
+tr.miss { background: #fdd; }
+tr.partial { background: #ffd; }
+</style>
+</head>
+<body>
+{{range .}}<h2>{{.Name}}</h2>
+<p>{{.Summary}}</p>
+<table>
+{{range .Rows}}<tr class="{{.Class}}"{{if .Title}} title="{{.Title}}"{{end}}><td class="num">{{.Line}}</td><td class="num">{{.Count}}</td><td>{{.Source}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
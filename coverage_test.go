@@ -0,0 +1,124 @@
+package lc3_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const coverageSource = `; Count down from 2.
+        .ORIG x3000
+        AND R0, R0, #0
+        ADD R0, R0, #2
+LOOP    ADD R0, R0, #-1
+        BRp LOOP
+        BRn NEVER
+        HALT
+NEVER   HALT
+DATA    .FILL x1234
+MSG     .STRINGZ "a\"b"
+        .END
+`
+
+func TestCoverage(t *testing.T) {
+	m, err := lc3.ReadSourceMap(strings.NewReader(coverageSource), "count.asm")
+	require.NoError(t, err)
+
+	run := func(t *testing.T) *lc3.Coverage {
+		coverage := lc3.NewCoverage()
+		vm, err := lc3.New(
+			lc3.WithTracer(coverage),
+			lc3.WithMemory(0x3000, 0x5020, 0x1022, 0x103f, 0x03fe, 0x0801, 0xf025, 0xf025, 0x1234),
+		)
+		require.NoError(t, err)
+		require.NoError(t, vm.Run())
+		return coverage
+	}
+
+	t.Run("map addresses to source lines", func(t *testing.T) {
+		line, ok := m.Line(0x3002)
+		require.True(t, ok)
+		assert.Equal(t, lc3.LineInfo{Address: 0x3002, File: "count.asm", Line: 5}, line)
+		assert.True(t, m.IsCode(0x3006))
+		assert.False(t, m.IsCode(0x3007))
+		line, ok = m.Line(0x300a)
+		require.True(t, ok)
+		assert.Equal(t, 11, line.Line)
+		_, ok = m.Line(0x300c)
+		assert.False(t, ok)
+		assert.Contains(t, m.Symbols, lc3.Symbol{Name: "NEVER", Address: 0x3006, Kind: lc3.SymbolLocal})
+	})
+
+	t.Run("map testdata sources", func(t *testing.T) {
+		for _, name := range []string{"2048", "rogue"} {
+			f, err := os.Open("testdata/" + name + ".asm")
+			require.NoError(t, err)
+			m, err := lc3.ReadSourceMap(f, name+".asm")
+			f.Close()
+			require.NoError(t, err)
+			assert.NotEmpty(t, m.Lines, name)
+		}
+	})
+
+	t.Run("count instructions and branches", func(t *testing.T) {
+		coverage := run(t)
+		assert.Equal(t, uint64(2), coverage.Count(0x3002))
+		assert.Equal(t, uint64(0), coverage.Count(0x3006))
+		taken, notTaken := coverage.Branch(0x3003)
+		assert.Equal(t, [2]uint64{1, 1}, [2]uint64{taken, notTaken})
+		taken, notTaken = coverage.Branch(0x3004)
+		assert.Equal(t, [2]uint64{0, 1}, [2]uint64{taken, notTaken})
+
+		assert.Equal(t, []lc3.LineCoverage{
+			{Line: 3, Count: 1},
+			{Line: 4, Count: 1},
+			{Line: 5, Count: 2},
+			{Line: 6, Count: 2, Branch: true, Taken: 1, NotTaken: 1},
+			{Line: 7, Count: 1, Branch: true, Taken: 0, NotTaken: 1},
+			{Line: 8, Count: 1},
+			{Line: 9, Count: 0},
+		}, coverage.Lines(m))
+	})
+
+	t.Run("write, read and merge coverage", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, lc3.WriteCoverage(&out, run(t)))
+		assert.Contains(t, out.String(), "x3003 2 1 1\n")
+
+		read, err := lc3.ReadCoverage(&out)
+		require.NoError(t, err)
+		read.Merge(run(t))
+		assert.Equal(t, uint64(4), read.Count(0x3002))
+		taken, notTaken := read.Branch(0x3004)
+		assert.Equal(t, [2]uint64{0, 2}, [2]uint64{taken, notTaken})
+	})
+
+	t.Run("reject invalid coverage files", func(t *testing.T) {
+		var syntax *lc3.SyntaxError
+		_, err := lc3.ReadCoverage(strings.NewReader("x3000 1\n"))
+		assert.ErrorAs(t, err, &syntax)
+		_, err = lc3.ReadCoverage(strings.NewReader("lc3 coverage\nx3000 1 2\n"))
+		assert.ErrorAs(t, err, &syntax)
+	})
+
+	t.Run("write lcov and HTML reports", func(t *testing.T) {
+		coverage := run(t)
+		var lcov bytes.Buffer
+		require.NoError(t, coverage.WriteLcov(&lcov, m))
+		assert.Contains(t, lcov.String(), "SF:count.asm\n")
+		assert.Contains(t, lcov.String(), "BRDA:7,0,0,0\nBRDA:7,0,1,1\nBRF:4\nBRH:3\n")
+		assert.Contains(t, lcov.String(), "DA:9,0\nLF:7\nLH:6\nend_of_record\n")
+
+		var html bytes.Buffer
+		require.NoError(t, coverage.WriteHTML(&html, m))
+		assert.Contains(t, html.String(), `<tr class="hit" title="taken 1, not taken 1">`)
+		assert.Contains(t, html.String(), `<tr class="partial" title="taken 0, not taken 1">`)
+		assert.Contains(t, html.String(), `<tr class="miss">`)
+		assert.Contains(t, html.String(), "lines 6/7 (85.7%), branches 3/4 (75.0%)")
+	})
+}
@@ -0,0 +1,47 @@
+package lc3
+
+import (
+	"fmt"
+)
+
+// Device handles the memory-mapped registers it is attached to. Reads and
+// writes to these addresses, whether by instructions or through GetMemory,
+// are forwarded to the device instead of memory.
+type Device interface {
+	Read(address uint16) (uint16, error)
+	Write(address uint16, value uint16) error
+}
+
+// keyboard implements KBSR and KBDR on top of the VM input: reading KBSR
+// polls the input, latching an available character into KBDR.
+type keyboard struct {
+	vm     *VM
+	status uint16
+	data   uint16
+}
+
+func (k *keyboard) Read(address uint16) (uint16, error) {
+	if address == MemoryKBDR {
+		return k.data, nil
+	}
+
+	k.status &= 1 << 14
+	if k.vm.peekChar() {
+		char, err := k.vm.getChar()
+		if err != nil {
+			return 0, fmt.Errorf("peeked char, but couldn't read it: %v", err)
+		}
+
+		k.status |= (1 << 15)
+		k.data = uint16(char)
+	}
+	return k.status, nil
+}
+
+func (k *keyboard) Write(address uint16, value uint16) error {
+	if address == MemoryKBSR {
+		// Only the interrupt enable bit is writable.
+		k.status = k.status&^(1<<14) | value&(1<<14)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package lc3
+
+import (
+	"fmt"
+)
+
+var trapNames = map[uint8]string{
+	TrapGETC:  "GETC",
+	TrapOUT:   "OUT",
+	TrapPUTS:  "PUTS",
+	TrapIN:    "IN",
+	TrapPUTSP: "PUTSP",
+	TrapHALT:  "HALT",
+}
+
+// Disassemble returns the assembly text of inst, located at pc. PC-relative
+// operands are shown as absolute addresses. Words that aren't valid
+// instructions are shown as .FILL directives.
+func Disassemble(pc uint16, inst uint16) string {
+	dr := Register((inst >> 9) & 0x7)
+	sr1 := Register((inst >> 6) & 0x7)
+	target9 := pc + 1 + signExtend(inst, 9)
+	if !wellFormed(inst) {
+		return fmt.Sprintf(".FILL x%04X", inst)
+	}
+
+	switch op := uint8(inst >> 12); op {
+	case OperationBR:
+		flags := ""
+		for i, flag := range "nzp" {
+			if inst&(0x800>>i) != 0 {
+				flags += string(flag)
+			}
+		}
+		if flags == "" {
+			return "NOP"
+		}
+		return fmt.Sprintf("BR%s x%04X", flags, target9)
+	case OperationADD, OperationAND:
+		if inst&0x20 != 0 {
+			return fmt.Sprintf("%s %s, %s, #%d", opNames[op], dr, sr1, int16(signExtend(inst, 5)))
+		}
+		return fmt.Sprintf("%s %s, %s, %s", opNames[op], dr, sr1, Register(inst&0x7))
+	case OperationLD, OperationLDI, OperationLEA, OperationST, OperationSTI:
+		return fmt.Sprintf("%s %s, x%04X", opNames[op], dr, target9)
+	case OperationLDR, OperationSTR:
+		return fmt.Sprintf("%s %s, %s, #%d", opNames[op], dr, sr1, int16(signExtend(inst, 6)))
+	case OperationNOT:
+		return fmt.Sprintf("NOT %s, %s", dr, sr1)
+	case OperationJMP:
+		if sr1 == RegisterR7 {
+			return "RET"
+		}
+		return fmt.Sprintf("JMP %s", sr1)
+	case OperationJSR:
+		if inst&0x800 != 0 {
+			return fmt.Sprintf("JSR x%04X", pc+1+signExtend(inst, 11))
+		}
+		return fmt.Sprintf("JSRR %s", sr1)
+	case OperationTRAP:
+		if name, ok := trapNames[uint8(inst)]; ok {
+			return name
+		}
+		return fmt.Sprintf("TRAP x%02X", uint8(inst))
+	default:
+		// RTI is the only well-formed instruction left.
+		return "RTI"
+	}
+}
+
+// wellFormed tells whether inst is a valid instruction: its opcode isn't
+// reserved and the bits the ISA requires to be zero or one are.
+func wellFormed(inst uint16) bool {
+	switch uint8(inst >> 12) {
+	case OperationADD, OperationAND:
+		return inst&0x20 != 0 || inst&0x18 == 0
+	case OperationNOT:
+		return inst&0x3f == 0x3f
+	case OperationJMP:
+		return inst&0xe3f == 0
+	case OperationJSR:
+		return inst&0x800 != 0 || inst&0x63f == 0
+	case OperationTRAP:
+		return inst&0xf00 == 0
+	case OperationRTI:
+		return inst&0xfff == 0
+	case OperationRES:
+		return false
+	}
+	return true
+}
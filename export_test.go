@@ -0,0 +1,99 @@
+package lc3
+
+import "fmt"
+
+// StepBlock runs the JIT on a single block and returns the number of
+// instructions executed.
+func (v *VM) StepBlock() (int, error) {
+	return v.runBlock(maxBlockLength)
+}
+
+// RawMemory returns the memory content, bypassing devices.
+func (v *VM) RawMemory() [MemorySize]uint16 {
+	return v.memory
+}
+
+// Uncache drops the decoded instruction at address, so that the next fetch
+// decodes it again.
+func (v *VM) Uncache(address uint16) {
+	if v.decoded != nil {
+		v.decoded[address].valid = false
+	}
+}
+
+// legacyInstruction executes an instruction the way the VM did before
+// instructions were predecoded.
+type legacyInstruction func(v *VM, inst uint16) error
+
+// legacyInstructions dispatches instructions as the VM did before
+// predecoding: through a map of closures decoding their operands and
+// accessing registers through methods. The instructions loop.obj doesn't run
+// only fill the map.
+var legacyInstructions = map[uint8]legacyInstruction{
+	OperationJMP:  legacyExec,
+	OperationJSR:  legacyExec,
+	OperationLD:   legacyExec,
+	OperationLDI:  legacyExec,
+	OperationLDR:  legacyExec,
+	OperationLEA:  legacyExec,
+	OperationNOT:  legacyExec,
+	OperationST:   legacyExec,
+	OperationSTI:  legacyExec,
+	OperationSTR:  legacyExec,
+	OperationTRAP: legacyExec,
+	OperationADD: func(v *VM, inst uint16) error {
+		value := signExtend(inst, 5)
+		if inst&0x20 == 0 {
+			value = v.GetRegister(Register(inst & 0x7))
+		}
+		dr := Register(inst >> 9 & 0x7)
+		v.SetRegister(dr, v.GetRegister(Register(inst>>6&0x7))+value)
+		v.updateFlags(dr)
+		return nil
+	},
+	OperationAND: func(v *VM, inst uint16) error {
+		value := signExtend(inst, 5)
+		if inst&0x20 == 0 {
+			value = v.GetRegister(Register(inst & 0x7))
+		}
+		dr := Register(inst >> 9 & 0x7)
+		v.SetRegister(dr, v.GetRegister(Register(inst>>6&0x7))&value)
+		v.updateFlags(dr)
+		return nil
+	},
+	OperationBR: func(v *VM, inst uint16) error {
+		if v.GetRegister(RegisterCOND)&(inst>>9&0x7) != 0 {
+			v.SetRegister(RegisterPC, v.GetRegister(RegisterPC)+signExtend(inst, 9))
+		}
+		return nil
+	},
+}
+
+func legacyExec(v *VM, inst uint16) error {
+	d := decode(inst)
+	return v.exec(&d)
+}
+
+// LegacyStep executes an instruction with the dispatch loop of the VM before
+// instructions were predecoded, for benchmarks.
+func (v *VM) LegacyStep() error {
+	if v.state != StateRunning {
+		return fmt.Errorf("VM State: %s", stateNames[v.state])
+	}
+	inst, err := v.GetMemory(v.GetRegister(RegisterPC))
+	if err != nil {
+		return err
+	}
+	op := uint8(inst >> 12)
+	exec, ok := legacyInstructions[op]
+	if !ok {
+		return fmt.Errorf("Operation %q not implemented", opNames[op])
+	}
+	if err := exec(v, inst); err != nil {
+		return err
+	}
+	if doIncrementPC(op) {
+		v.SetRegister(RegisterPC, v.GetRegister(RegisterPC)+1)
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package lc3
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// Default limits of the fuzzer.
+const (
+	DefaultFuzzLimit  = 100000
+	DefaultFuzzMaxLen = 256
+)
+
+// CrashKind is a kind of crash found by fuzzing.
+type CrashKind uint8
+
+const (
+	// CrashIllegal is the execution of an invalid instruction.
+	CrashIllegal CrashKind = iota
+	// CrashCharacter is a PUTS string holding a word that isn't a
+	// character.
+	CrashCharacter
+	// CrashHang is the instruction limit reached with input left.
+	CrashHang
+	// CrashError is any other error, e.g. an access control violation.
+	CrashError
+)
+
+var crashNames = [...]string{
+	CrashIllegal:   "illegal",
+	CrashCharacter: "character",
+	CrashHang:      "hang",
+	CrashError:     "error",
+}
+
+func (k CrashKind) String() string {
+	if int(k) < len(crashNames) {
+		return crashNames[k]
+	}
+	return fmt.Sprintf("CrashKind(%d)", k)
+}
+
+// Crash is an input making a program crash or hang.
+type Crash struct {
+	Kind CrashKind
+	// PC is the address of the instruction failing, or where the program
+	// was stopped for hangs.
+	PC    uint16
+	Err   error
+	Input []byte
+}
+
+func (c Crash) String() string {
+	return fmt.Sprintf("%s at x%04X: %v (input %q)", c.Kind, c.PC, c.Err, c.Input)
+}
+
+// same tells whether two crashes are the same bug: hangs are told apart
+// only by kind, the PC where they're stopped being arbitrary.
+func (c *Crash) same(other *Crash) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	return c.Kind == other.Kind && (c.Kind == CrashHang || c.PC == other.PC)
+}
+
+// FuzzConfig configures a Fuzzer.
+type FuzzConfig struct {
+	Program *Object
+	// Options configure the VM, e.g. its engine. Input is set by the
+	// fuzzer and output discarded.
+	Options []Option
+	// Seeds are the initial inputs, an empty one if none.
+	Seeds [][]byte
+	// Limit is the number of instructions of a run after which the program
+	// is considered hung, MaxLen the length of the inputs generated. Zero
+	// means the default.
+	Limit  uint64
+	MaxLen int
+	// RandSeed seeds the mutations.
+	RandSeed int64
+}
+
+// Fuzzer feeds generated inputs to a program, keeping those reaching new
+// control-flow edges to mutate them further, and collecting those making it
+// crash or hang, minimized.
+type Fuzzer struct {
+	cfg    FuzzConfig
+	rand   *rand.Rand
+	corpus [][]byte
+	// edges holds the hit count buckets seen for each edge.
+	edges map[uint32]uint8
+	// dictionary holds the bytes mutations favor.
+	dictionary []byte
+	crashes    []*Crash
+	runs       uint64
+	seeded     bool
+}
+
+// NewFuzzer returns a fuzzer for cfg.Program.
+func NewFuzzer(cfg FuzzConfig) (*Fuzzer, error) {
+	if cfg.Program == nil {
+		return nil, errors.New("no program to fuzz")
+	}
+	if cfg.Limit == 0 {
+		cfg.Limit = DefaultFuzzLimit
+	}
+	if cfg.MaxLen == 0 {
+		cfg.MaxLen = DefaultFuzzMaxLen
+	}
+	f := &Fuzzer{cfg: cfg, rand: rand.New(rand.NewSource(cfg.RandSeed)), edges: map[uint32]uint8{}}
+
+	// Programs compare characters by adding their negation, usually loaded
+	// from a .FILL: those constants are worth trying as input.
+	seen := map[byte]bool{}
+	f.dictionary = append(f.dictionary, interesting...)
+	for _, section := range cfg.Program.Sections {
+		for _, word := range section.Words {
+			if neg := -word; neg > 0 && neg <= 0xff && !seen[byte(neg)] {
+				seen[byte(neg)] = true
+				f.dictionary = append(f.dictionary, byte(neg))
+			}
+		}
+	}
+	return f, nil
+}
+
+// edgeTracer counts the control-flow edges taken by a run, from an
+// instruction to the next one executed.
+type edgeTracer struct {
+	prev  uint16
+	edges map[uint32]uint64
+}
+
+func (t *edgeTracer) Trace(v *VM, pc uint16, inst uint16) {
+	t.edges[uint32(t.prev)<<16|uint32(pc)]++
+	t.prev = pc
+}
+
+// fuzzInput is the input of a run, telling whether the program wanted more.
+type fuzzInput struct {
+	data      []byte
+	exhausted bool
+}
+
+func (r *fuzzInput) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		r.exhausted = true
+		return 0, io.EOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Exec runs the program on input, returning the crash it causes if any.
+// Running out of input isn't a crash.
+func (f *Fuzzer) Exec(input []byte) (*Crash, error) {
+	crash, _, err := f.exec(input)
+	return crash, err
+}
+
+func (f *Fuzzer) exec(input []byte) (*Crash, map[uint32]uint64, error) {
+	in := &fuzzInput{data: input}
+	tracer := &edgeTracer{prev: 0xffff, edges: map[uint32]uint64{}}
+	opts := append(slices.Clip(f.cfg.Options), WithInput(in), WithOutput(io.Discard), WithObject(f.cfg.Program), WithTracer(tracer))
+	v, err := New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.runs++
+
+	var instructions uint64
+	for v.State() == StateRunning {
+		if instructions == f.cfg.Limit {
+			if in.exhausted {
+				return nil, tracer.edges, nil
+			}
+			return &Crash{Kind: CrashHang, PC: v.GetRegister(RegisterPC), Input: input,
+				Err: fmt.Errorf("no HALT within %d instructions", f.cfg.Limit)}, tracer.edges, nil
+		}
+		if err := v.Step(); err != nil {
+			crash := &Crash{Kind: CrashError, PC: v.GetRegister(RegisterPC), Err: err, Input: input}
+			var illegal *illegalOpcodeError
+			var character *invalidCharacterError
+			switch {
+			case errors.As(err, &illegal), errors.Is(err, errInvalidNot):
+				crash.Kind = CrashIllegal
+			case errors.As(err, &character):
+				crash.Kind = CrashCharacter
+			case in.exhausted:
+				return nil, tracer.edges, nil
+			}
+			return crash, tracer.edges, nil
+		}
+		instructions++
+	}
+	return nil, tracer.edges, nil
+}
+
+// bucket maps a hit count to a bit, so that loops running notably more
+// times count as new coverage.
+func bucket(count uint64) uint8 {
+	switch {
+	case count <= 3:
+		return 1 << (count - 1)
+	case count <= 7:
+		return 1 << 3
+	case count <= 15:
+		return 1 << 4
+	case count <= 31:
+		return 1 << 5
+	case count <= 127:
+		return 1 << 6
+	}
+	return 1 << 7
+}
+
+// run executes input, keeping it in the corpus if it covers new edges and
+// recording its crash.
+func (f *Fuzzer) run(input []byte) error {
+	crash, edges, err := f.exec(input)
+	if err != nil {
+		return err
+	}
+
+	novel := false
+	for edge, count := range edges {
+		if b := bucket(count); f.edges[edge]&b == 0 {
+			f.edges[edge] |= b
+			novel = true
+		}
+	}
+	if crash != nil {
+		for _, known := range f.crashes {
+			if known.same(crash) {
+				return nil
+			}
+		}
+		if crash.Input, err = f.minimize(crash); err != nil {
+			return err
+		}
+		f.crashes = append(f.crashes, crash)
+		return nil
+	}
+	if novel {
+		f.corpus = append(f.corpus, input)
+	}
+	return nil
+}
+
+// Fuzz runs the program on runs mutated inputs, after the seeds on the
+// first call.
+func (f *Fuzzer) Fuzz(runs int) error {
+	if !f.seeded {
+		f.seeded = true
+		seeds := f.cfg.Seeds
+		if len(seeds) == 0 {
+			seeds = [][]byte{{}}
+		}
+		for _, seed := range seeds {
+			if err := f.run(seed); err != nil {
+				return err
+			}
+		}
+		if len(f.corpus) == 0 {
+			f.corpus = append(f.corpus, []byte{})
+		}
+	}
+
+	for i := 0; i < runs; i++ {
+		input := f.mutate(f.corpus[f.rand.Intn(len(f.corpus))])
+		if err := f.run(input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interesting are bytes programs often compare input with.
+var interesting = []byte("\n\r\x00\xff 09AZaz+-qy")
+
+// mutate returns a copy of input with a few random changes.
+func (f *Fuzzer) mutate(input []byte) []byte {
+	out := slices.Clone(input)
+	for n := 1 + f.rand.Intn(4); n > 0; n-- {
+		if len(out) == 0 {
+			out = append(out, byte(f.rand.Intn(256)))
+			continue
+		}
+		i := f.rand.Intn(len(out))
+		switch f.rand.Intn(7) {
+		case 0:
+			out[i] ^= 1 << f.rand.Intn(8)
+		case 1:
+			out[i] = byte(f.rand.Intn(256))
+		case 2:
+			out[i] = f.dictionary[f.rand.Intn(len(f.dictionary))]
+		case 3:
+			out = slices.Insert(out, i, byte(f.rand.Intn(256)))
+		case 4:
+			out = append(out, f.dictionary[f.rand.Intn(len(f.dictionary))])
+		case 5:
+			out = slices.Delete(out, i, i+1+f.rand.Intn(len(out)-i))
+		case 6:
+			other := f.corpus[f.rand.Intn(len(f.corpus))]
+			out = append(out[:i:i], other[min(i, len(other)):]...)
+		}
+	}
+	if len(out) > f.cfg.MaxLen {
+		out = out[:f.cfg.MaxLen]
+	}
+	return out
+}
+
+// minimize removes chunks of the input of crash, halving them down to single
+// bytes, as long as it still causes the same crash.
+func (f *Fuzzer) minimize(crash *Crash) ([]byte, error) {
+	input := crash.Input
+	for chunk := max(len(input)/2, 1); chunk > 0 && len(input) > 0; chunk /= 2 {
+		for i := 0; i < len(input); {
+			candidate := slices.Delete(slices.Clone(input), i, min(i+chunk, len(input)))
+			again, err := f.Exec(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if crash.same(again) {
+				input = candidate
+			} else {
+				i += chunk
+			}
+		}
+	}
+	return input, nil
+}
+
+// Corpus returns the inputs kept for reaching new edges.
+func (f *Fuzzer) Corpus() [][]byte {
+	return f.corpus
+}
+
+// Crashes returns the crashes found, by kind and address.
+func (f *Fuzzer) Crashes() []Crash {
+	crashes := make([]Crash, 0, len(f.crashes))
+	for _, crash := range f.crashes {
+		crashes = append(crashes, *crash)
+	}
+	sort.Slice(crashes, func(i, j int) bool {
+		if crashes[i].Kind != crashes[j].Kind {
+			return crashes[i].Kind < crashes[j].Kind
+		}
+		return crashes[i].PC < crashes[j].PC
+	})
+	return crashes
+}
+
+// Edges returns the number of control-flow edges covered so far.
+func (f *Fuzzer) Edges() int {
+	return len(f.edges)
+}
+
+// Runs returns the number of runs of the program so far, minimization
+// included.
+func (f *Fuzzer) Runs() uint64 {
+	return f.runs
+}
+
+// WriteCrashes saves the input of each crash to dir, in a file named after
+// its kind and address, e.g. illegal-x3008.
+func WriteCrashes(dir string, crashes []Crash) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, crash := range crashes {
+		name := fmt.Sprintf("%s-x%04X", crash.Kind, crash.PC)
+		if crash.Kind == CrashHang {
+			name = crash.Kind.String()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), crash.Input, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCorpus saves inputs to dir, in files named after their SHA-1.
+func WriteCorpus(dir string, inputs [][]byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		name := fmt.Sprintf("%x", sha1.Sum(input))
+		if err := os.WriteFile(filepath.Join(dir, name), input, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
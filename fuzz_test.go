@@ -0,0 +1,110 @@
+package lc3_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuzzer(t *testing.T) {
+	// Executes a reserved opcode after reading "ko".
+	password := &lc3.Object{Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{
+		0xf020, 0x2208, 0x1201, 0x0a05, // GETC, compare with 'k'
+		0xf020, 0x2205, 0x1201, 0x0a01, // GETC, compare with 'o'
+		0xd000, // reserved opcode
+		0xf025, // HALT
+		0xff95, // #-107
+		0xff91, // #-111
+	}}}}
+	// Loops forever after reading "h".
+	hang := &lc3.Object{Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{
+		0xf020, // GETC
+		0x2203, // LD R1, NEGH
+		0x1201, // ADD R1, R0, R1
+		0x05ff, // LOOP BRz LOOP
+		0xf025, // HALT
+		0xff98, // NEGH .FILL #-104
+	}}}}
+
+	t.Run("execute inputs", func(t *testing.T) {
+		f, err := lc3.NewFuzzer(lc3.FuzzConfig{Program: password})
+		require.NoError(t, err)
+		crash, err := f.Exec([]byte("ka"))
+		require.NoError(t, err)
+		assert.Nil(t, crash, "running out of input isn't a crash")
+		crash, err = f.Exec([]byte("k"))
+		require.NoError(t, err)
+		assert.Nil(t, crash)
+		crash, err = f.Exec([]byte("ko"))
+		require.NoError(t, err)
+		require.NotNil(t, crash)
+		assert.Equal(t, lc3.CrashIllegal, crash.Kind)
+		assert.Equal(t, uint16(0x3008), crash.PC)
+		assert.Equal(t, `illegal at x3008: Operation "RES" not implemented (input "ko")`, crash.String())
+	})
+
+	t.Run("find and minimize crashes", func(t *testing.T) {
+		f, err := lc3.NewFuzzer(lc3.FuzzConfig{Program: password, Seeds: [][]byte{[]byte("hello")}, RandSeed: 1})
+		require.NoError(t, err)
+		for i := 0; i < 100 && len(f.Crashes()) == 0; i++ {
+			require.NoError(t, f.Fuzz(1000))
+		}
+		require.Len(t, f.Crashes(), 1)
+		crash := f.Crashes()[0]
+		assert.Equal(t, lc3.CrashIllegal, crash.Kind)
+		assert.Equal(t, []byte("ko"), crash.Input)
+		assert.GreaterOrEqual(t, len(f.Corpus()), 2)
+		assert.Greater(t, f.Edges(), 0)
+	})
+
+	t.Run("find hangs", func(t *testing.T) {
+		f, err := lc3.NewFuzzer(lc3.FuzzConfig{Program: hang, Limit: 1000, Seeds: [][]byte{[]byte("x\nyz")}})
+		require.NoError(t, err)
+		for i := 0; i < 100 && len(f.Crashes()) == 0; i++ {
+			require.NoError(t, f.Fuzz(1000))
+		}
+		require.Len(t, f.Crashes(), 1)
+		assert.Equal(t, lc3.CrashHang, f.Crashes()[0].Kind)
+		assert.Equal(t, []byte("h"), f.Crashes()[0].Input[:1])
+	})
+
+	t.Run("detect bad PUTS characters", func(t *testing.T) {
+		f, err := lc3.NewFuzzer(lc3.FuzzConfig{Program: &lc3.Object{Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{
+			0xe002, // LEA R0, STRING
+			0xf022, // PUTS
+			0xf025, // HALT
+			0x0041, // STRING .FILL x41
+			0x1234, // .FILL x1234
+			0x0000,
+		}}}}})
+		require.NoError(t, err)
+		crash, err := f.Exec(nil)
+		require.NoError(t, err)
+		require.NotNil(t, crash)
+		assert.Equal(t, lc3.CrashCharacter, crash.Kind)
+		assert.Equal(t, uint16(0x3001), crash.PC)
+	})
+
+	t.Run("save crashes and corpus", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, lc3.WriteCrashes(dir, []lc3.Crash{
+			{Kind: lc3.CrashIllegal, PC: 0x3008, Input: []byte("ko")},
+			{Kind: lc3.CrashHang, PC: 0x3003, Input: []byte("h")},
+		}))
+		data, err := os.ReadFile(filepath.Join(dir, "illegal-x3008"))
+		require.NoError(t, err)
+		assert.Equal(t, "ko", string(data))
+		data, err = os.ReadFile(filepath.Join(dir, "hang"))
+		require.NoError(t, err)
+		assert.Equal(t, "h", string(data))
+
+		require.NoError(t, lc3.WriteCorpus(dir, [][]byte{[]byte("abc")}))
+		data, err = os.ReadFile(filepath.Join(dir, "a9993e364706816aba3e25717850c26c9cd0d89d"))
+		require.NoError(t, err)
+		assert.Equal(t, "abc", string(data))
+	})
+}
@@ -1,20 +1,115 @@
 package lc3
 
-type instruction func(v *VM, inst uint16) error
+// decoded is an instruction with its operands extracted.
+type decoded struct {
+	inst uint16
+	op   uint8
+	// dr is DR, or SR for stores.
+	dr Register
+	// sr1 is SR1, SR of NOT, or BaseR.
+	sr1 Register
+	sr2 Register
+	// imm tells ADD and AND use an immediate operand, and JSR a PC offset
+	// rather than a base register.
+	imm bool
+	// offset is the sign-extended immediate or offset, or the trap vector.
+	offset uint16
+	// nzp are the condition codes BR tests, as COND flags.
+	nzp   uint16
+	valid bool
+}
+
+func decode(inst uint16) decoded {
+	d := decoded{
+		inst:  inst,
+		op:    uint8(inst >> 12),
+		dr:    Register((inst >> 9) & 0x7),
+		sr1:   Register((inst >> 6) & 0x7),
+		sr2:   Register(inst & 0x7),
+		valid: true,
+	}
+
+	switch d.op {
+	case OperationBR:
+		d.nzp = (inst >> 9) & 0x7
+		d.offset = signExtend(inst, 9)
+	case OperationADD, OperationAND:
+		d.imm = inst&0x0020 != 0
+		d.offset = signExtend(inst, 5)
+	case OperationLD, OperationLDI, OperationLEA, OperationST, OperationSTI:
+		d.offset = signExtend(inst, 9)
+	case OperationLDR, OperationSTR:
+		d.offset = signExtend(inst, 6)
+	case OperationJSR:
+		d.imm = inst&0x800 != 0
+		d.offset = signExtend(inst, 11)
+	case OperationTRAP:
+		d.offset = inst & 0x00ff
+	}
+	return d
+}
+
+// fetch returns the decoded instruction at pc. Instructions of memory are
+// decoded once and cached until overwritten; those of device registers are
+// decoded on every fetch.
+func (v *VM) fetch(pc uint16) (*decoded, error) {
+	if err := v.checkAccess(pc, false); err != nil {
+		return nil, err
+	}
+
+	if pc > UserMemoryLimit {
+		inst, err := v.GetMemory(pc)
+		if err != nil {
+			return nil, err
+		}
+		v.scratch = decode(inst)
+		return &v.scratch, nil
+	}
+
+	if v.decoded == nil {
+		v.decoded = new([MemorySize]decoded)
+	}
+	d := &v.decoded[pc]
+	if !d.valid {
+		*d = decode(v.memory[pc])
+	}
+	return d, nil
+}
 
-var instructions = map[uint8]instruction{
-	OperationADD:  func(v *VM, inst uint16) error { v.execAdd(inst); return nil },
-	OperationAND:  func(v *VM, inst uint16) error { v.execAnd(inst); return nil },
-	OperationBR:   func(v *VM, inst uint16) error { v.execBreak(inst); return nil },
-	OperationJMP:  func(v *VM, inst uint16) error { v.execJump(inst); return nil },
-	OperationJSR:  func(v *VM, inst uint16) error { v.execJumpSubroutine(inst); return nil },
-	OperationLD:   func(v *VM, inst uint16) error { return v.execLoad(inst, false) },
-	OperationLDI:  func(v *VM, inst uint16) error { return v.execLoad(inst, true) },
-	OperationLDR:  (*VM).execLoadRegister,
-	OperationLEA:  func(v *VM, inst uint16) error { v.execLoadEffectiveAddress(inst); return nil },
-	OperationNOT:  (*VM).execNot,
-	OperationST:   func(v *VM, inst uint16) error { return v.execStore(inst, false) },
-	OperationSTI:  func(v *VM, inst uint16) error { return v.execStore(inst, true) },
-	OperationSTR:  (*VM).execStoreRegister,
-	OperationTRAP: (*VM).execTrap,
+func (v *VM) exec(d *decoded) error {
+	switch d.op {
+	case OperationADD:
+		v.execAdd(d)
+	case OperationAND:
+		v.execAnd(d)
+	case OperationBR:
+		v.execBreak(d)
+	case OperationJMP:
+		v.execJump(d)
+	case OperationJSR:
+		v.execJumpSubroutine(d)
+	case OperationLD:
+		return v.execLoad(d, false)
+	case OperationLDI:
+		return v.execLoad(d, true)
+	case OperationLDR:
+		return v.execLoadRegister(d)
+	case OperationLEA:
+		v.execLoadEffectiveAddress(d)
+	case OperationNOT:
+		return v.execNot(d)
+	case OperationRTI:
+		return v.execReturnFromInterrupt(d)
+	case OperationST:
+		return v.execStore(d, false)
+	case OperationSTI:
+		return v.execStore(d, true)
+	case OperationSTR:
+		return v.execStoreRegister(d)
+	case OperationTRAP:
+		return v.execTrap(d)
+	default:
+		return &illegalOpcodeError{op: d.op}
+	}
+	return nil
 }
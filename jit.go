@@ -0,0 +1,218 @@
+package lc3
+
+// Engine selects how Run executes instructions.
+type Engine uint8
+
+const (
+	// EngineInterpreter decodes and executes one instruction at a time.
+	EngineInterpreter Engine = iota
+	// EngineJIT compiles basic blocks into chains of Go closures, cached
+	// until their memory is overwritten. It produces the same architectural
+	// state as the interpreter. It falls back to the interpreter when
+	// tracers are attached, with a timing model, to service interrupts and
+	// for code outside of user memory in user mode with memory protection.
+	EngineJIT
+	// EngineMicrocode executes instructions cycle by cycle through the
+	// control store of the LC-3 state machine, driving the datapath with
+	// its control signals. Step and Run use it, and Cycle executes a single
+	// cycle.
+	EngineMicrocode
+)
+
+// maxBlockLength bounds the number of instructions compiled in one block.
+const maxBlockLength = 256
+
+// WithEngine selects the execution engine. Step executes a single instruction
+// with the interpreter, except with EngineMicrocode.
+func WithEngine(engine Engine) Option {
+	return func(o *options) { o.engine = engine }
+}
+
+// compiledOp executes an instruction, including updating PC.
+type compiledOp func(v *VM) error
+
+// block is a compiled sequence of instructions at consecutive addresses,
+// ending with a control flow instruction, or where compilation stopped.
+type block struct {
+	start, end uint16
+	ops        []compiledOp
+	valid      bool
+}
+
+// jit holds the compiled blocks of a VM, by start address.
+type jit struct {
+	blocks [MemorySize]*block
+	// compiled tells which addresses belong to a valid block.
+	compiled [MemorySize]bool
+}
+
+// invalidate drops the blocks covering address, after it was written.
+func (j *jit) invalidate(address uint16) {
+	for start := int(address); start >= 0 && start > int(address)-maxBlockLength; start-- {
+		if b := j.blocks[start]; b != nil && address <= b.end {
+			b.valid = false
+			j.blocks[start] = nil
+		}
+	}
+	j.compiled[address] = false
+}
+
+// updateSlow updates slow, after the features of the slow path changed.
+// Compiled blocks don't implement them either.
+func (v *VM) updateSlow() {
+	v.slow = len(v.tracers) > 0 || v.timing != nil || v.interruptible ||
+		v.shadow != nil || v.codeGuard != nil || v.stackGuard != nil
+}
+
+// runBlock executes the block at PC, compiling it if needed, and returns the
+// number of instructions executed. Blocks longer than limit instructions are
+// left to the interpreter, one instruction at a time.
+func (v *VM) runBlock(limit int) (int, error) {
+	pc := v.registers[RegisterPC]
+	if v.slow || pc > UserMemoryLimit {
+		return 1, v.execInstruction()
+	}
+
+	if v.jit == nil {
+		v.jit = &jit{}
+	}
+	b := v.jit.blocks[pc]
+	if b == nil {
+		b = v.compile(pc)
+	}
+	if len(b.ops) > limit || v.protection != ProtectionOff && (!v.canFetch(b.start) || !v.canFetch(b.end)) {
+		return 1, v.execInstruction()
+	}
+
+	for i, op := range b.ops {
+		if err := op(v); err != nil {
+			_, err = v.handleException(b.start+uint16(i), err)
+			return i + 1, err
+		}
+		if !b.valid {
+			// The block overwrote its own code.
+			return i + 1, nil
+		}
+	}
+	return len(b.ops), nil
+}
+
+// canFetch tells whether fetching from address is allowed in the current
+// privilege mode.
+func (v *VM) canFetch(address uint16) bool {
+	return v.checkAccess(address, false) == nil
+}
+
+func (v *VM) compile(start uint16) *block {
+	b := &block{start: start, valid: true}
+	for pc := start; ; pc++ {
+		d := decode(v.memory[pc])
+		b.ops = append(b.ops, compileInstruction(pc, d))
+		v.jit.compiled[pc] = true
+		b.end = pc
+
+		if endsBlock(d.op) || pc == UserMemoryLimit || len(b.ops) == maxBlockLength {
+			break
+		}
+	}
+
+	v.jit.blocks[start] = b
+	return b
+}
+
+func endsBlock(op uint8) bool {
+	switch op {
+	case OperationBR, OperationJMP, OperationJSR, OperationTRAP, OperationRTI, OperationRES:
+		return true
+	}
+	return false
+}
+
+// compileInstruction returns a closure executing d, located at pc, with its
+// operands resolved. Instructions touching memory or devices go through the
+// interpreter's implementation.
+func compileInstruction(pc uint16, d decoded) compiledOp {
+	next := pc + 1
+	dr, sr1, sr2, offset := d.dr, d.sr1, d.sr2, d.offset
+
+	switch d.op {
+	case OperationADD:
+		if d.imm {
+			return func(v *VM) error {
+				v.registers[dr] = v.registers[sr1] + offset
+				v.updateFlags(dr)
+				v.registers[RegisterPC] = next
+				return nil
+			}
+		}
+		return func(v *VM) error {
+			v.registers[dr] = v.registers[sr1] + v.registers[sr2]
+			v.updateFlags(dr)
+			v.registers[RegisterPC] = next
+			return nil
+		}
+	case OperationAND:
+		if d.imm {
+			return func(v *VM) error {
+				v.registers[dr] = v.registers[sr1] & offset
+				v.updateFlags(dr)
+				v.registers[RegisterPC] = next
+				return nil
+			}
+		}
+		return func(v *VM) error {
+			v.registers[dr] = v.registers[sr1] & v.registers[sr2]
+			v.updateFlags(dr)
+			v.registers[RegisterPC] = next
+			return nil
+		}
+	case OperationLEA:
+		address := next + offset
+		return func(v *VM) error {
+			v.registers[dr] = address
+			v.updateFlags(dr)
+			v.registers[RegisterPC] = next
+			return nil
+		}
+	case OperationBR:
+		nzp, target := d.nzp, next+offset
+		return func(v *VM) error {
+			if v.registers[RegisterCOND]&nzp != 0 {
+				v.registers[RegisterPC] = target
+			} else {
+				v.registers[RegisterPC] = next
+			}
+			return nil
+		}
+	case OperationJMP:
+		return func(v *VM) error {
+			v.registers[RegisterPC] = v.registers[sr1]
+			return nil
+		}
+	case OperationJSR:
+		if d.imm {
+			target := next + offset
+			return func(v *VM) error {
+				v.registers[RegisterR7] = next
+				v.registers[RegisterPC] = target
+				return nil
+			}
+		}
+		return func(v *VM) error {
+			target := v.registers[sr1]
+			v.registers[RegisterR7] = next
+			v.registers[RegisterPC] = target
+			return nil
+		}
+	}
+
+	return func(v *VM) error {
+		if err := v.exec(&d); err != nil {
+			return err
+		}
+		if doIncrementPC(d.op) {
+			v.registers[RegisterPC]++
+		}
+		return nil
+	}
+}
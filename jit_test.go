@@ -0,0 +1,158 @@
+package lc3_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJIT(t *testing.T) {
+	t.Run("run in lockstep with the interpreter", func(t *testing.T) {
+		testCases := []struct {
+			program string
+			input   string
+		}{
+			{"testdata/hello-world.obj", ""},
+			{"testdata/loop.obj", ""},
+			{"testdata/reverse-string.obj", ""},
+			{"testdata/2048.obj", "n" + strings.Repeat("wasd", 50)},
+			{"testdata/rogue.obj", strings.Repeat("sdsdwawa", 20)},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.program, func(t *testing.T) {
+				image, err := os.ReadFile(test.program)
+				require.NoError(t, err)
+
+				refOutput, jitOutput := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+				ref, err := lc3.New(lc3.WithProgram(bytes.NewReader(image)),
+					lc3.WithInput(strings.NewReader(test.input)), lc3.WithOutput(refOutput))
+				require.NoError(t, err)
+				jit, err := lc3.New(lc3.WithProgram(bytes.NewReader(image)),
+					lc3.WithInput(strings.NewReader(test.input)), lc3.WithOutput(jitOutput),
+					lc3.WithEngine(lc3.EngineJIT))
+				require.NoError(t, err)
+
+				// 2048 polls KBSR forever once input is exhausted.
+				for blocks := 0; jit.State() == lc3.StateRunning && blocks < 100000; blocks++ {
+					n, jitErr := jit.StepBlock()
+					var refErr error
+					for i := 0; i < n && refErr == nil; i++ {
+						refErr = ref.Step()
+					}
+
+					require.Equal(t, fmt.Sprint(refErr), fmt.Sprint(jitErr))
+					require.Equal(t, registers(ref), registers(jit), "block %d", blocks)
+					if jitErr != nil {
+						break
+					}
+					if blocks%1000 == 0 {
+						require.Equal(t, ref.RawMemory(), jit.RawMemory(), "block %d", blocks)
+					}
+				}
+
+				assert.Equal(t, ref.RawMemory(), jit.RawMemory())
+				assert.Equal(t, ref.State(), jit.State())
+				assert.Equal(t, refOutput.String(), jitOutput.String())
+			})
+		}
+	})
+
+	t.Run("run self-modifying code", func(t *testing.T) {
+		// ADD R0, R0, #1; LD R1, x3005; ST R1, x3000; BRnzp x3000; HALT; .FILL xF025 (HALT)
+		vm, err := lc3.New(
+			lc3.WithMemory(0x3000, 0x1021, 0x2203, 0x33fd, 0x0ffc, 0xf025, 0xf025),
+			lc3.WithEngine(lc3.EngineJIT),
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+	})
+
+	t.Run("invalidate blocks overwritten by the host", func(t *testing.T) {
+		// ADD R0, R0, #1; BRnzp x3000
+		vm, err := lc3.New(lc3.WithMemory(0x3000, 0x1021, 0x0ffe), lc3.WithEngine(lc3.EngineJIT))
+		assert.NoError(t, err)
+		_, err = vm.StepBlock()
+		assert.NoError(t, err)
+
+		vm.SetMemory(0x3001, 0xf025) // HALT
+		_, err = vm.StepBlock()
+		assert.NoError(t, err)
+		assert.Equal(t, lc3.StateHalted, vm.State())
+		assert.Equal(t, uint16(2), vm.GetRegister(lc3.RegisterR0))
+	})
+
+	t.Run("run blocks while interrupts are held by the priority level", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithEngine(lc3.EngineJIT),
+			lc3.WithRegister(lc3.RegisterR6, 0x4000),
+			// ADD R0, R0, #1; ADD R0, R0, #1; BRnzp x3000
+			lc3.WithMemory(0x3000, 0x1021, 0x1021, 0x0ffd),
+			lc3.WithMemory(0x0180, 0x1000, 0x1100),
+			// ADD R1, R1, #1; ADD R1, R1, #1; RTI
+			lc3.WithMemory(0x1000, 0x1261, 0x1261, 0x8000),
+			lc3.WithMemory(0x1100, 0xf025), // HALT
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, vm.RequestInterrupt(0x81, 0))
+		n, err := vm.StepBlock()
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		// The interrupt is taken before the first instruction of its handler.
+		require.NoError(t, vm.RequestInterrupt(0x80, 4))
+		n, err = vm.StepBlock()
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, uint16(0x1001), vm.GetRegister(lc3.RegisterPC))
+
+		require.NoError(t, vm.RequestInterrupt(0x81, 2))
+		n, err = vm.StepBlock()
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, uint16(0x3000), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, uint16(2), vm.GetRegister(lc3.RegisterR1))
+
+		// RTI lowered the priority level below the second interrupt.
+		n, err = vm.StepBlock()
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, lc3.StateHalted, vm.State())
+		assert.Equal(t, uint16(2<<8), vm.PSR()&0x0700)
+	})
+
+	t.Run("raise exceptions at the faulting instruction", func(t *testing.T) {
+		// ADD R0, R0, #1; LDR R0, R1, #0; HALT
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineJIT} {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithMemoryProtection(lc3.ProtectionError),
+				lc3.WithMemory(0x3000, 0x1021, 0x6040, 0xf025),
+			)
+			assert.NoError(t, err)
+
+			var acv *lc3.AccessViolationError
+			assert.ErrorAs(t, vm.Run(), &acv)
+			assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+			assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR0))
+		}
+	})
+}
+
+func registers(vm *lc3.VM) []uint16 {
+	values := []uint16{vm.PSR()}
+	for reg := lc3.RegisterR0; reg < lc3.RegisterCOUNT; reg++ {
+		values = append(values, vm.GetRegister(reg))
+	}
+	return values
+}
@@ -0,0 +1,326 @@
+package lc3ref
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// DefaultSteps is the number of instructions a generated case runs at most.
+const DefaultSteps = 200
+
+// MinSize and MaxSize bound the number of instructions of a generated case.
+const (
+	MinSize = 4
+	MaxSize = 0x8000
+)
+
+// Case is an initial state to run on both the VM and the model.
+type Case struct {
+	PC        uint16
+	Registers [8]uint16
+	// COND holds the N, Z and P flags as in the VM, x4, x2 and x1.
+	COND uint16
+	// Memory is a block of words starting at Origin, the rest being zero.
+	Origin uint16
+	Memory []uint16
+	Steps  int
+}
+
+func (c *Case) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PC=x%04X COND=%s", c.PC, flags(c.COND))
+	for i, value := range c.Registers {
+		fmt.Fprintf(&b, " R%d=x%04X", i, value)
+	}
+	fmt.Fprintf(&b, " steps=%d\n", c.Steps)
+	for i, word := range c.Memory {
+		address := c.Origin + uint16(i)
+		fmt.Fprintf(&b, "x%04X x%04X  %s\n", address, word, lc3.Disassemble(address, word))
+	}
+	return b.String()
+}
+
+func flags(cond uint16) string {
+	s := ""
+	for i, flag := range "nzp" {
+		if cond&(4>>i) != 0 {
+			s += string(flag)
+		}
+	}
+	return s
+}
+
+// Generate returns a random case: random registers and flags, and size
+// random valid instructions, most of them within reach of PC-relative
+// offsets of the others, which also serve as data. Size is clamped to
+// MinSize and MaxSize.
+func Generate(r *rand.Rand, size int) *Case {
+	size = min(max(size, MinSize), MaxSize)
+	c := &Case{
+		COND:   []uint16{lc3.FlagN, lc3.FlagZ, lc3.FlagP}[r.Intn(3)],
+		Origin: uint16(0x3000 + r.Intn(0xc000-size)),
+		Memory: make([]uint16, size),
+		Steps:  DefaultSteps,
+	}
+	for i := range c.Registers {
+		c.Registers[i] = uint16(r.Intn(1 << 16))
+		// Keep some registers pointing into the block, for LDR, STR,
+		// JMP and JSRR.
+		if r.Intn(2) == 0 {
+			c.Registers[i] = c.Origin + uint16(r.Intn(size))
+		}
+	}
+	for i := range c.Memory {
+		c.Memory[i] = instruction(r)
+	}
+	c.PC = c.Origin + uint16(size/4+r.Intn(size/2))
+	return c
+}
+
+// instruction returns a random valid instruction of the model.
+func instruction(r *rand.Rand) uint16 {
+	field := func(n uint) uint16 { return uint16(r.Intn(1 << n)) }
+	switch r.Intn(14) {
+	case 0, 1:
+		op := []uint16{0x1000, 0x5000}[r.Intn(2)] // ADD, AND
+		if r.Intn(2) == 0 {
+			return op | field(6)<<6 | 0x20 | field(5)
+		}
+		return op | field(6)<<6 | field(3)
+	case 2:
+		return 0x903f | field(6)<<6 // NOT
+	case 3:
+		return field(12) // BR
+	case 4:
+		return 0xc000 | field(3)<<6 // JMP
+	case 5:
+		if r.Intn(2) == 0 {
+			return 0x4800 | field(11) // JSR
+		}
+		return 0x4000 | field(3)<<6 // JSRR
+	case 6:
+		return 0x2000 | field(12) // LD
+	case 7:
+		return 0xa000 | field(12) // LDI
+	case 8:
+		return 0x6000 | field(12) // LDR
+	case 9:
+		return 0xe000 | field(12) // LEA
+	case 10:
+		return 0x3000 | field(12) // ST
+	case 11:
+		return 0xb000 | field(12) // STI
+	case 12:
+		return 0x7000 | field(12) // STR
+	default:
+		if r.Intn(4) == 0 {
+			return 0xf025 // HALT
+		}
+		return 0x1000 | field(6)<<6 | 0x20 | field(5) // ADD immediate
+	}
+}
+
+// Divergence is a difference between the VM and the model.
+type Divergence struct {
+	// Step is the number of instructions executed, the last one at PC.
+	Step int
+	PC   uint16
+	Inst uint16
+	// Location is the register, flag or memory word differing, e.g. R3,
+	// PC, COND or x4000, or "error" if only the VM failed.
+	Location string
+	// VM and Model are the values found, or the flags for COND.
+	VM, Model uint16
+	Err       error
+	Case      *Case
+}
+
+func (d *Divergence) String() string {
+	at := fmt.Sprintf("step %d, x%04X %s", d.Step, d.PC, lc3.Disassemble(d.PC, d.Inst))
+	switch d.Location {
+	case "error":
+		return fmt.Sprintf("%s: VM failed: %v", at, d.Err)
+	case "COND":
+		return fmt.Sprintf("%s: COND is %s, model %s", at, flags(d.VM), flags(d.Model))
+	}
+	return fmt.Sprintf("%s: %s is x%04X, model x%04X", at, d.Location, d.VM, d.Model)
+}
+
+// Check runs c on a VM configured with opts and on the model, comparing the
+// registers, flags and written words after each transfer of control, and all
+// memory at the end. The VM runs each stretch of instructions up to a
+// transfer of control with RunFor, so that the JIT executes whole blocks. A
+// case ends after c.Steps instructions, on HALT, or before an instruction
+// the model doesn't support or accessing device registers, which it lacks.
+func Check(c *Case, opts ...lc3.Option) (*Divergence, error) {
+	opts = append(opts, lc3.WithPC(c.PC), lc3.WithRegister(lc3.RegisterCOND, c.COND), lc3.WithMemory(c.Origin, c.Memory...))
+	for i, value := range c.Registers {
+		opts = append(opts, lc3.WithRegister(lc3.Register(i), value))
+	}
+	vm, err := lc3.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Machine{PC: c.PC}
+	m.R = c.Registers
+	m.N, m.Z, m.P = c.COND&lc3.FlagN != 0, c.COND&lc3.FlagZ != 0, c.COND&lc3.FlagP != 0
+	copy(m.Memory[c.Origin:], c.Memory)
+
+	step := 0
+	var pc, inst uint16
+	diverge := func(location string, vmValue, model uint16) *Divergence {
+		return &Divergence{Step: step, PC: pc, Inst: inst, Location: location, VM: vmValue, Model: model, Case: c}
+	}
+	for end := false; !end && step < c.Steps && !m.Halted; {
+		// The instructions of the stretch, and the words they wrote.
+		var pcs, insts, written []uint16
+		for step < c.Steps && !m.Halted {
+			pc, inst = m.PC, m.Memory[m.PC]
+			if err := m.Step(); err != nil {
+				if errors.Is(err, ErrDevice) || errors.Is(err, ErrUnsupported) {
+					end = true
+					break
+				}
+				return nil, fmt.Errorf("model failed at x%04X: %v", pc, err)
+			}
+			step++
+			pcs, insts = append(pcs, pc), append(insts, inst)
+			if m.Wrote {
+				written = append(written, m.Written)
+			}
+			if m.PC != pc+1 {
+				break
+			}
+		}
+		if len(pcs) == 0 {
+			break
+		}
+		pc, inst = pcs[len(pcs)-1], insts[len(insts)-1]
+
+		if executed, err := vm.RunFor(len(pcs)); err != nil {
+			step += executed + 1 - len(pcs)
+			pc, inst = pcs[executed], insts[executed]
+			d := diverge("error", 0, 0)
+			d.Err = err
+			return d, nil
+		}
+		for i, value := range m.R {
+			if got := vm.GetRegister(lc3.Register(i)); got != value {
+				return diverge(fmt.Sprintf("R%d", i), got, value), nil
+			}
+		}
+		if got := vm.GetRegister(lc3.RegisterPC); got != m.PC {
+			return diverge("PC", got, m.PC), nil
+		}
+		if got, want := vm.GetRegister(lc3.RegisterCOND), m.cond(); got != want {
+			return diverge("COND", got, want), nil
+		}
+		for _, address := range written {
+			if got, _ := vm.GetMemory(address); got != m.Memory[address] {
+				return diverge(fmt.Sprintf("x%04X", address), got, m.Memory[address]), nil
+			}
+		}
+	}
+
+	for address := 0; address < DeviceBase; address++ {
+		if got, _ := vm.GetMemory(uint16(address)); got != m.Memory[address] {
+			return diverge(fmt.Sprintf("x%04X", address), got, m.Memory[address]), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Machine) cond() uint16 {
+	var cond uint16
+	if m.N {
+		cond |= lc3.FlagN
+	}
+	if m.Z {
+		cond |= lc3.FlagZ
+	}
+	if m.P {
+		cond |= lc3.FlagP
+	}
+	return cond
+}
+
+// Minimize shrinks the case of d while it diverges at the same location:
+// it runs only up to the divergence, then clears memory words and registers
+// one at a time, and trims the zero words around the memory block.
+func Minimize(d *Divergence, opts ...lc3.Option) (*Divergence, error) {
+	best := d
+	// try checks c, keeping it if it still diverges.
+	try := func(c Case) (bool, error) {
+		again, err := Check(&c, opts...)
+		if err != nil || again == nil || again.Location != d.Location {
+			return false, err
+		}
+		best = again
+		return true, nil
+	}
+
+	c := *d.Case
+	c.Steps = d.Step
+	if ok, err := try(c); err != nil || !ok {
+		return d, err
+	}
+	for i := range best.Case.Memory {
+		c := *best.Case
+		if c.Memory[i] == 0 {
+			continue
+		}
+		c.Memory = append([]uint16(nil), c.Memory...)
+		c.Memory[i] = 0
+		if _, err := try(c); err != nil {
+			return nil, err
+		}
+	}
+	for i := range best.Case.Registers {
+		c := *best.Case
+		if c.Registers[i] == 0 {
+			continue
+		}
+		c.Registers[i] = 0
+		if _, err := try(c); err != nil {
+			return nil, err
+		}
+	}
+
+	c = *best.Case
+	for len(c.Memory) > 0 && c.Memory[0] == 0 {
+		c.Memory = c.Memory[1:]
+		c.Origin++
+	}
+	for len(c.Memory) > 0 && c.Memory[len(c.Memory)-1] == 0 {
+		c.Memory = c.Memory[:len(c.Memory)-1]
+	}
+	if _, err := try(c); err != nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// Run checks n random cases of size instructions, generated from seed, and
+// returns the first divergence, minimized.
+func Run(n, size int, seed int64, opts ...lc3.Option) (*Divergence, error) {
+	if size < MinSize || size > MaxSize {
+		return nil, fmt.Errorf("case size %d out of range %d to %d", size, MinSize, MaxSize)
+	}
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		c := Generate(r, size)
+		d, err := Check(c, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return Minimize(d, opts...)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,104 @@
+package lc3ref_test
+
+import (
+	"math/rand"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/kroosec/lc3vm-go/lc3ref"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDifferential(t *testing.T) {
+	for name, opts := range map[string][]lc3.Option{
+		"interpreter": nil,
+		"jit":         {lc3.WithEngine(lc3.EngineJIT)},
+		"microcode":   {lc3.WithEngine(lc3.EngineMicrocode)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, err := lc3ref.Run(300, 512, 1, opts...)
+			require.NoError(t, err)
+			if d != nil {
+				t.Fatalf("%v\n%v", d, d.Case)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{-1, 0, 1, lc3ref.MinSize, lc3ref.MaxSize + 1} {
+		c := lc3ref.Generate(r, size)
+		assert.GreaterOrEqual(t, len(c.Memory), lc3ref.MinSize)
+		assert.LessOrEqual(t, len(c.Memory), lc3ref.MaxSize)
+		assert.GreaterOrEqual(t, c.PC, c.Origin)
+		assert.Less(t, int(c.PC), int(c.Origin)+len(c.Memory))
+	}
+
+	_, err := lc3ref.Run(1, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestMachine(t *testing.T) {
+	m := &lc3ref.Machine{PC: 0x3000}
+	copy(m.Memory[0x3000:], []uint16{
+		0x5020, // AND R0, R0, #0
+		0x1025, // ADD R0, R0, #5
+		0x903f, // NOT R0, R0
+		0x3202, // ST R1, #2
+		0xf025, // HALT
+	})
+	m.R[1] = 0x1234
+	for !m.Halted {
+		require.NoError(t, m.Step())
+	}
+	assert.Equal(t, uint16(0xfffa), m.R[0])
+	assert.True(t, m.N)
+	assert.Equal(t, uint16(0x1234), m.Memory[0x3006])
+	assert.Equal(t, uint16(0x3005), m.PC)
+
+	t.Run("device registers", func(t *testing.T) {
+		m := &lc3ref.Machine{PC: 0x3000}
+		m.Memory[0x3000] = 0x7040 // STR R0, R1, #0
+		m.R[1] = 0xfe06
+		require.ErrorIs(t, m.Step(), lc3ref.ErrDevice)
+		assert.Equal(t, uint16(0x3000), m.PC)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		m := &lc3ref.Machine{PC: 0x3000}
+		m.Memory[0x3000] = 0xf020 // GETC
+		require.ErrorIs(t, m.Step(), lc3ref.ErrUnsupported)
+	})
+}
+
+func TestMinimize(t *testing.T) {
+	// A VM with a word the model lacks diverges at the end of any case.
+	opts := []lc3.Option{lc3.WithMemory(0x5000, 1)}
+	c := &lc3ref.Case{
+		PC:        0x3001,
+		Registers: [8]uint16{1, 2, 3},
+		COND:      lc3.FlagZ,
+		Origin:    0x3000,
+		Memory:    []uint16{0x1021, 0x1021, 0x1021, 0xf025, 0x1021},
+		Steps:     lc3ref.DefaultSteps,
+	}
+	d, err := lc3ref.Check(c, opts...)
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "x5000", d.Location)
+	assert.Equal(t, uint16(1), d.VM)
+	assert.Equal(t, uint16(0), d.Model)
+	assert.Equal(t, 3, d.Step)
+
+	d, err = lc3ref.Minimize(d, opts...)
+	require.NoError(t, err)
+	assert.Equal(t, "x5000", d.Location)
+	assert.Empty(t, d.Case.Memory)
+	assert.Equal(t, [8]uint16{}, d.Case.Registers)
+
+	d, err = lc3ref.Check(c)
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
@@ -0,0 +1,193 @@
+// Package lc3ref is a reference model of the LC-3 written from the ISA
+// specification, independently of the VM, and a harness checking the VM
+// against it on random programs.
+package lc3ref
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DeviceBase is the first address of the device register page, which the
+// model doesn't implement.
+const DeviceBase = 0xfe00
+
+// ErrDevice is an access to the device register page.
+var ErrDevice = errors.New("device register access")
+
+// ErrUnsupported is an instruction the model doesn't implement: RTI, the
+// reserved opcode, traps other than HALT, and encodings with reserved bits
+// the ISA requires to be zero or one.
+var ErrUnsupported = errors.New("unsupported instruction")
+
+// Machine is the state of the model. It implements the operate, data
+// movement and control instructions of the ISA as specified in its
+// appendix A, in user mode, and TRAP x25 as halting.
+type Machine struct {
+	Memory  [1 << 16]uint16
+	R       [8]uint16
+	PC      uint16
+	N, Z, P bool
+	Halted  bool
+	// Written is the address written by the last instruction, if Wrote.
+	Written uint16
+	Wrote   bool
+}
+
+// sext sign-extends the low bits of x.
+func sext(x uint16, bits uint) uint16 {
+	x &= 1<<bits - 1
+	if x&(1<<(bits-1)) != 0 {
+		x |= 0xffff << bits
+	}
+	return x
+}
+
+// bits returns bits hi down to lo of x.
+func bits(x uint16, hi, lo uint) uint16 {
+	return x >> lo & (1<<(hi-lo+1) - 1)
+}
+
+func (m *Machine) setcc(value uint16) {
+	m.N = value&0x8000 != 0
+	m.Z = value == 0
+	m.P = !m.N && !m.Z
+}
+
+func (m *Machine) read(address uint16) (uint16, error) {
+	if address >= DeviceBase {
+		return 0, ErrDevice
+	}
+	return m.Memory[address], nil
+}
+
+func (m *Machine) write(address uint16, value uint16) error {
+	if address >= DeviceBase {
+		return ErrDevice
+	}
+	m.Memory[address] = value
+	m.Written, m.Wrote = address, true
+	return nil
+}
+
+// Step executes the instruction at PC. On error, the state is left as it
+// was before the instruction.
+func (m *Machine) Step() error {
+	if m.Halted {
+		return errors.New("halted")
+	}
+	ir, err := m.read(m.PC)
+	if err != nil {
+		return err
+	}
+	saved := *m
+	m.Wrote = false
+	if err := m.execute(ir); err != nil {
+		*m = saved
+		return err
+	}
+	return nil
+}
+
+func (m *Machine) execute(ir uint16) error {
+	// PC is incremented in the FETCH phase, before the instruction
+	// executes.
+	m.PC++
+	dr := bits(ir, 11, 9)
+	sr1 := bits(ir, 8, 6)
+
+	switch bits(ir, 15, 12) {
+	case 0x1: // ADD
+		if bits(ir, 5, 5) == 0 {
+			if bits(ir, 4, 3) != 0 {
+				return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+			}
+			m.R[dr] = m.R[sr1] + m.R[bits(ir, 2, 0)]
+		} else {
+			m.R[dr] = m.R[sr1] + sext(ir, 5)
+		}
+		m.setcc(m.R[dr])
+	case 0x5: // AND
+		if bits(ir, 5, 5) == 0 {
+			if bits(ir, 4, 3) != 0 {
+				return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+			}
+			m.R[dr] = m.R[sr1] & m.R[bits(ir, 2, 0)]
+		} else {
+			m.R[dr] = m.R[sr1] & sext(ir, 5)
+		}
+		m.setcc(m.R[dr])
+	case 0x9: // NOT
+		if bits(ir, 5, 0) != 0x3f {
+			return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+		}
+		m.R[dr] = ^m.R[sr1]
+		m.setcc(m.R[dr])
+	case 0x0: // BR
+		if bits(ir, 11, 11) == 1 && m.N || bits(ir, 10, 10) == 1 && m.Z || bits(ir, 9, 9) == 1 && m.P {
+			m.PC += sext(ir, 9)
+		}
+	case 0xc: // JMP, RET
+		if bits(ir, 11, 9) != 0 || bits(ir, 5, 0) != 0 {
+			return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+		}
+		m.PC = m.R[sr1]
+	case 0x4: // JSR, JSRR
+		temp := m.PC
+		if bits(ir, 11, 11) == 0 {
+			if bits(ir, 10, 9) != 0 || bits(ir, 5, 0) != 0 {
+				return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+			}
+			m.PC = m.R[sr1]
+		} else {
+			m.PC += sext(ir, 11)
+		}
+		m.R[7] = temp
+	case 0x2: // LD
+		value, err := m.read(m.PC + sext(ir, 9))
+		if err != nil {
+			return err
+		}
+		m.R[dr] = value
+		m.setcc(value)
+	case 0xa: // LDI
+		pointer, err := m.read(m.PC + sext(ir, 9))
+		if err != nil {
+			return err
+		}
+		value, err := m.read(pointer)
+		if err != nil {
+			return err
+		}
+		m.R[dr] = value
+		m.setcc(value)
+	case 0x6: // LDR
+		value, err := m.read(m.R[sr1] + sext(ir, 6))
+		if err != nil {
+			return err
+		}
+		m.R[dr] = value
+		m.setcc(value)
+	case 0xe: // LEA
+		m.R[dr] = m.PC + sext(ir, 9)
+		m.setcc(m.R[dr])
+	case 0x3: // ST
+		return m.write(m.PC+sext(ir, 9), m.R[dr])
+	case 0xb: // STI
+		pointer, err := m.read(m.PC + sext(ir, 9))
+		if err != nil {
+			return err
+		}
+		return m.write(pointer, m.R[dr])
+	case 0x7: // STR
+		return m.write(m.R[sr1]+sext(ir, 6), m.R[dr])
+	case 0xf: // TRAP
+		if bits(ir, 11, 8) != 0 || bits(ir, 7, 0) != 0x25 {
+			return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+		}
+		m.Halted = true
+	default: // RTI, reserved
+		return fmt.Errorf("%w x%04X", ErrUnsupported, ir)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package lc3test
+
+import "strings"
+
+// Diff compares two outputs line by line: lines only expected are prefixed
+// with "-", lines only in the actual output with "+".
+func Diff(expected, actual string) string {
+	a, b := splitLines(expected), splitLines(actual)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	diff.WriteString("--- expected\n+++ actual\n")
+	write := func(prefix, line string) {
+		diff.WriteString(prefix)
+		diff.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			diff.WriteString("\n\\ No newline at end of output\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			write(" ", a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			write("-", a[i])
+			i++
+		default:
+			write("+", b[j])
+			j++
+		}
+	}
+	return diff.String()
+}
+
+// splitLines splits text after each newline.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,37 @@
+package lc3test
+
+import (
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// Fuzz runs program on the inputs of Go's fuzzing engine, failing on crashes
+// and hangs as found by lc3.Fuzzer, so that go test -fuzz works on a program:
+//
+//	func FuzzGame(f *testing.F) {
+//		program, err := lc3.ReadProgramFile("game.obj")
+//		if err != nil {
+//			f.Fatal(err)
+//		}
+//		f.Add([]byte("wasd"))
+//		lc3test.Fuzz(f, program)
+//	}
+//
+// Go's engine is guided by the coverage of the VM rather than of the
+// program, which lc3.Fuzzer follows more closely.
+func Fuzz(f *testing.F, program *lc3.Object, opts ...lc3.Option) {
+	fuzzer, err := lc3.NewFuzzer(lc3.FuzzConfig{Program: program, Options: opts})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		crash, err := fuzzer.Exec(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crash != nil {
+			t.Fatal(crash)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package lc3test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML test suite named suite, e.g. the
+// graded program. Failed expectations are failures and runs not reaching
+// HALT are errors; the output of the program is kept in system-out.
+func WriteJUnit(w io.Writer, suite string, results []*Result) error {
+	s := junitSuite{Name: suite, Tests: len(results)}
+	var total time.Duration
+	for _, r := range results {
+		c := junitCase{Name: r.Name, Classname: suite, Time: seconds(r.Duration), SystemOut: r.Output}
+		if r.Err != nil {
+			c.Error = &junitMessage{Message: r.Err.Error(), Text: r.Diff}
+			s.Errors++
+		} else if len(r.Failures) > 0 {
+			c.Failure = &junitMessage{Message: strings.Join(r.Failures, "; "), Text: r.Diff}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, c)
+		total += r.Duration
+	}
+	s.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitSuites{Suites: []junitSuite{s}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
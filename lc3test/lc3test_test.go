@@ -0,0 +1,145 @@
+package lc3test_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/kroosec/lc3vm-go/lc3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSpec(t *testing.T, text string) *lc3test.Spec {
+	spec, err := lc3test.ReadSpec(strings.NewReader(text))
+	require.NoError(t, err)
+	return spec
+}
+
+func TestRun(t *testing.T) {
+	program, err := lc3.ReadProgramFile("../testdata/reverse-string.obj")
+	require.NoError(t, err)
+
+	t.Run("pass a spec", func(t *testing.T) {
+		r := lc3test.Run(program, readSpec(t, `{
+			"name": "reverse",
+			"expect": {
+				"output": "4321DCBA",
+				"registers": {"r0": "x3015", "COND": 1},
+				"memory": {"x3015": "x0034", "#12310": 51}
+			}
+		}`))
+		assert.True(t, r.Passed(), "%v %v", r.Err, r.Failures)
+		assert.Equal(t, "reverse", r.Name)
+		assert.Equal(t, "4321DCBA", r.Output)
+		assert.Equal(t, uint64(83), r.Instructions)
+	})
+
+	t.Run("preset memory and registers", func(t *testing.T) {
+		r := lc3test.Run(program, readSpec(t, `{
+			"memory": {"x3015": ["x79", 120, 0]},
+			"registers": {"R5": -1},
+			"expect": {"output": "xy", "registers": {"R5": "xFFFF"}}
+		}`))
+		assert.True(t, r.Passed(), "%v %v", r.Err, r.Failures)
+	})
+
+	t.Run("report failed expectations with a diff", func(t *testing.T) {
+		r := lc3test.Run(program, readSpec(t, `{
+			"expect": {
+				"output": "4321DCBA\n",
+				"registers": {"R1": 0},
+				"memory": {"x3015": 52}
+			}
+		}`))
+		assert.False(t, r.Passed())
+		assert.NoError(t, r.Err)
+		assert.Equal(t, []string{"output differs", "R1 = x3018, want x0000"}, r.Failures)
+		assert.Equal(t, "--- expected\n+++ actual\n-4321DCBA\n+4321DCBA\n\\ No newline at end of output\n", r.Diff)
+	})
+
+	t.Run("stop at the instruction limit", func(t *testing.T) {
+		r := lc3test.Run(program, readSpec(t, `{"limit": 10, "expect": {"output": ""}}`))
+		assert.False(t, r.Passed())
+		assert.EqualError(t, r.Err, "instruction limit of 10 reached at x3002")
+		assert.Equal(t, uint64(10), r.Instructions)
+		assert.Empty(t, r.Failures)
+	})
+
+	t.Run("resolve symbols", func(t *testing.T) {
+		// AND R0, R0, #0; ADD R0, R0, #7; ST R0, RESULT; HALT
+		obj := &lc3.Object{
+			Entry: 0x3000, HasEntry: true,
+			Sections: []lc3.Section{{Name: ".text", Origin: 0x3000, Words: []uint16{0x5020, 0x1027, 0x3001, 0xf025, 0}}},
+			Symbols:  []lc3.Symbol{{Name: "RESULT", Address: 0x3004, Kind: lc3.SymbolLocal}},
+		}
+		r := lc3test.Run(obj, readSpec(t, `{"expect": {"memory": {"RESULT": 7}}}`),
+			lc3.WithEngine(lc3.EngineMicrocode))
+		assert.True(t, r.Passed(), "%v %v", r.Err, r.Failures)
+
+		r = lc3test.Run(obj, readSpec(t, `{"expect": {"memory": {"MISSING": 7}}}`))
+		assert.EqualError(t, r.Err, `undefined symbol "MISSING"`)
+	})
+
+	t.Run("reject invalid specs", func(t *testing.T) {
+		for _, text := range []string{
+			`{"expect": {"registers": {"R8": 0}}}`,
+			`{"expect": {"memory": {"x3000": 65536}}}`,
+			`{"expect": {"memory": {"x3000": "yes"}}}`,
+			`{"outptu": ""}`,
+		} {
+			_, err := lc3test.ReadSpec(strings.NewReader(text))
+			assert.Error(t, err, text)
+		}
+	})
+}
+
+func TestReadSpecDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"name": "named"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"input": "x"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(`not a spec`), 0o644))
+
+	specs, err := lc3test.ReadSpecDir(dir)
+	require.NoError(t, err)
+	require.Len(t, specs, 2)
+	assert.Equal(t, "a", specs[0].Name)
+	assert.Equal(t, "x", specs[0].Input)
+	assert.Equal(t, "named", specs[1].Name)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "--- expected\n+++ actual\n a\n-b\n+B\n c\n+d\n", lc3test.Diff("a\nb\nc\n", "a\nB\nc\nd\n"))
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []*lc3test.Result{
+		{Name: "ok", Output: "done"},
+		{Name: "wrong", Failures: []string{"R0 = x0001, want x0002"}},
+		{Name: "loops", Err: errors.New("instruction limit of 10 reached at x3000")},
+	}
+	var out bytes.Buffer
+	require.NoError(t, lc3test.WriteJUnit(&out, "student.obj", results))
+	assert.Contains(t, out.String(), `<testsuite name="student.obj" tests="3" failures="1" errors="1" time="0.000">`)
+	assert.Contains(t, out.String(), "<system-out>done</system-out>")
+	assert.Contains(t, out.String(), `<failure message="R0 = x0001, want x0002"></failure>`)
+	assert.Contains(t, out.String(), `<error message="instruction limit of 10 reached at x3000"></error>`)
+}
+
+func FuzzEcho(f *testing.F) {
+	// Echoes its input up to a newline.
+	program := &lc3.Object{Sections: []lc3.Section{{Origin: 0x3000, Words: []uint16{
+		0xf020, // LOOP GETC
+		0xf021, // OUT
+		0x1236, // ADD R1, R0, #-10
+		0x0bfc, // BRnp LOOP
+		0xf025, // HALT
+	}}}}
+	f.Add([]byte("abc\n"))
+	f.Add([]byte{})
+	lc3test.Fuzz(f, program)
+}
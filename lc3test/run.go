@@ -0,0 +1,135 @@
+package lc3test
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// Result is the outcome of running a spec.
+type Result struct {
+	Name string
+	// Err is set when the program could not run to HALT: a VM error, an
+	// invalid spec or the instruction limit.
+	Err error
+	// Failures describe the expectations not met.
+	Failures []string
+	// Diff compares the expected and actual output, if they differ.
+	Diff         string
+	Output       string
+	Instructions uint64
+	Duration     time.Duration
+}
+
+// Passed tells whether the program halted and met all expectations.
+func (r *Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run runs a program against a spec. opts may e.g. select the engine, but
+// input and output are set by the spec.
+//
+// Output is checked even if the program doesn't halt, registers and memory
+// only once it does.
+func Run(program *lc3.Object, spec *Spec, opts ...lc3.Option) *Result {
+	start := time.Now()
+	r := &Result{Name: spec.Name}
+	defer func() { r.Duration = time.Since(start) }()
+
+	var output bytes.Buffer
+	opts = append(slices.Clip(opts), lc3.WithInput(strings.NewReader(spec.Input)), lc3.WithOutput(&output), lc3.WithObject(program))
+	for _, key := range sortedKeys(spec.Memory) {
+		address, err := address(program, key)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		opts = append(opts, lc3.WithMemory(address, words(spec.Memory[key])...))
+	}
+	for _, name := range sortedKeys(spec.Registers) {
+		reg, err := register(name)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		opts = append(opts, lc3.WithRegister(reg, uint16(spec.Registers[name])))
+	}
+	vm, err := lc3.New(opts...)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+
+	limit := spec.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	for vm.State() == lc3.StateRunning {
+		if r.Instructions == limit {
+			r.Err = fmt.Errorf("instruction limit of %d reached at x%04X", limit, vm.GetRegister(lc3.RegisterPC))
+			break
+		}
+		if err := vm.Step(); err != nil {
+			r.Err = err
+			break
+		}
+		r.Instructions++
+	}
+
+	r.Output = output.String()
+	if want := spec.Expect.Output; want != nil && *want != r.Output {
+		r.Failures = append(r.Failures, "output differs")
+		r.Diff = Diff(*want, r.Output)
+	}
+	if r.Err != nil {
+		return r
+	}
+	for _, name := range sortedKeys(spec.Expect.Registers) {
+		reg, err := register(name)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		if got, want := Word(vm.GetRegister(reg)), spec.Expect.Registers[name]; got != want {
+			r.Failures = append(r.Failures, fmt.Sprintf("%s = %v, want %v", reg, got, want))
+		}
+	}
+	for _, key := range sortedKeys(spec.Expect.Memory) {
+		address, err := address(program, key)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		value, err := vm.GetMemory(address)
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		if got, want := Word(value), spec.Expect.Memory[key]; got != want {
+			r.Failures = append(r.Failures, fmt.Sprintf("memory %s = %v, want %v", key, got, want))
+		}
+	}
+	return r
+}
+
+func words(values []Word) []uint16 {
+	words := make([]uint16, len(values))
+	for i, value := range values {
+		words[i] = uint16(value)
+	}
+	return words
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
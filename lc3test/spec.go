@@ -0,0 +1,174 @@
+// Package lc3test runs LC-3 programs against declarative test specs, e.g. to
+// grade student submissions.
+//
+// A spec is a JSON document giving the program input, preset memory and
+// registers, and the output, registers and memory expected once the program
+// halts:
+//
+//	{
+//		"name": "adds two digits",
+//		"input": "12",
+//		"memory": {"x4000": [1, "x0002"]},
+//		"limit": 10000,
+//		"expect": {
+//			"output": "3\n",
+//			"registers": {"R0": 3},
+//			"memory": {"RESULT": 3}
+//		}
+//	}
+//
+// Addresses are xNNNN, #NNN or decimal numbers, or symbols of the program.
+// Words are JSON numbers or strings in the same formats; negative values are
+// stored in two's complement.
+package lc3test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+)
+
+// DefaultLimit is the number of instructions a program may execute when a
+// spec sets no limit.
+const DefaultLimit = 1000000
+
+// Spec describes a test case.
+type Spec struct {
+	Name  string `json:"name"`
+	Input string `json:"input"`
+	// Memory and Registers are set before the program starts. Memory maps
+	// addresses to the words stored from there.
+	Memory    map[string][]Word `json:"memory"`
+	Registers map[string]Word   `json:"registers"`
+	// Limit is the maximum number of instructions executed, DefaultLimit
+	// if 0.
+	Limit  uint64      `json:"limit"`
+	Expect Expectation `json:"expect"`
+}
+
+// Expectation is the state expected once the program halts. Output is not
+// checked if nil.
+type Expectation struct {
+	Output    *string         `json:"output"`
+	Registers map[string]Word `json:"registers"`
+	Memory    map[string]Word `json:"memory"`
+}
+
+// Word is a memory or register value.
+type Word uint16
+
+// UnmarshalJSON accepts numbers and strings such as "x3000" or "#-1".
+func (w *Word) UnmarshalJSON(data []byte) error {
+	var value int64
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if value, err = parseNumber(s); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid word %s", data)
+	}
+	if value < -0x8000 || value > 0xffff {
+		return fmt.Errorf("word %s out of range", data)
+	}
+	*w = Word(value)
+	return nil
+}
+
+func (w Word) String() string {
+	return fmt.Sprintf("x%04X", uint16(w))
+}
+
+func parseNumber(s string) (int64, error) {
+	var value int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "x") || strings.HasPrefix(s, "X"):
+		value, err = strconv.ParseInt(s[1:], 16, 32)
+	case strings.HasPrefix(s, "#"):
+		value, err = strconv.ParseInt(s[1:], 10, 32)
+	default:
+		value, err = strconv.ParseInt(s, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return value, nil
+}
+
+// ReadSpec reads a JSON spec, rejecting unknown fields and register names.
+func ReadSpec(r io.Reader) (*Spec, error) {
+	var spec Spec
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, err
+	}
+	for _, registers := range []map[string]Word{spec.Registers, spec.Expect.Registers} {
+		for name := range registers {
+			if _, err := register(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &spec, nil
+}
+
+// ReadSpecDir reads the *.json specs of a directory, in file name order.
+// Specs without a name are named after their file.
+func ReadSpecDir(dir string) ([]*Spec, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var specs []*Spec
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		spec, err := ReadSpec(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if spec.Name == "" {
+			spec.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// register returns the register named R0-R7, PC or COND.
+func register(name string) (lc3.Register, error) {
+	for reg := lc3.RegisterR0; reg < lc3.RegisterCOUNT; reg++ {
+		if strings.EqualFold(reg.String(), name) {
+			return reg, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid register %q", name)
+}
+
+// address resolves a number or a symbol of the program.
+func address(program *lc3.Object, s string) (uint16, error) {
+	if value, err := parseNumber(s); err == nil {
+		if value < 0 || value > 0xffff {
+			return 0, fmt.Errorf("address %q out of range", s)
+		}
+		return uint16(value), nil
+	}
+	if address, ok := program.Lookup(s); ok {
+		return address, nil
+	}
+	return 0, fmt.Errorf("undefined symbol %q", s)
+}
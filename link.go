@@ -0,0 +1,126 @@
+package lc3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UndefinedSymbolsError lists the external symbols no object defines.
+type UndefinedSymbolsError struct {
+	Names []string
+}
+
+func (e *UndefinedSymbolsError) Error() string {
+	return fmt.Sprintf("undefined symbols: %s", strings.Join(e.Names, ", "))
+}
+
+// Link combines objects into a single object with no relocations left. Global
+// symbols of every object are visible to the others; an object's own symbols
+// take precedence. The entry point is that of the first object having one.
+func Link(objects ...*Object) (*Object, error) {
+	globals := map[string]uint16{}
+	for _, obj := range objects {
+		for _, sym := range obj.Symbols {
+			if sym.Kind != SymbolGlobal {
+				continue
+			}
+			if _, ok := globals[sym.Name]; ok {
+				return nil, fmt.Errorf("symbol %q defined more than once", sym.Name)
+			}
+			globals[sym.Name] = sym.Address
+		}
+	}
+
+	linked := &Object{}
+	undefined := map[string]bool{}
+	for _, obj := range objects {
+		if obj.HasEntry && !linked.HasEntry {
+			linked.Entry, linked.HasEntry = obj.Entry, true
+		}
+
+		sections := make([]Section, len(obj.Sections))
+		for i, section := range obj.Sections {
+			sections[i] = section
+			sections[i].Words = append([]uint16{}, section.Words...)
+		}
+
+		for _, reloc := range obj.Relocations {
+			address, ok := obj.Lookup(reloc.Symbol)
+			if !ok {
+				address, ok = globals[reloc.Symbol]
+			}
+			if !ok {
+				undefined[reloc.Symbol] = true
+				continue
+			}
+			if err := relocate(sections, reloc, address); err != nil {
+				return nil, err
+			}
+		}
+
+		linked.Sections = append(linked.Sections, sections...)
+		linked.Lines = append(linked.Lines, obj.Lines...)
+		for _, sym := range obj.Symbols {
+			if sym.Kind != SymbolExternal {
+				linked.Symbols = append(linked.Symbols, sym)
+			}
+		}
+	}
+
+	if len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &UndefinedSymbolsError{Names: names}
+	}
+
+	segments := linked.Segments()
+	for i := range segments {
+		for j := 0; j < i; j++ {
+			if segments[j].overlaps(segments[i]) {
+				return nil, &OverlapError{First: segments[j], Second: segments[i]}
+			}
+		}
+	}
+
+	return linked, nil
+}
+
+func relocate(sections []Section, reloc Relocation, address uint16) error {
+	if reloc.Section < 0 || reloc.Section >= len(sections) {
+		return fmt.Errorf("relocation of %q: invalid section %d", reloc.Symbol, reloc.Section)
+	}
+	section := sections[reloc.Section]
+	if int(reloc.Offset) >= len(section.Words) {
+		return fmt.Errorf("relocation of %q: offset %d out of section %q", reloc.Symbol, reloc.Offset, section.Name)
+	}
+
+	word := &section.Words[reloc.Offset]
+	var bits uint8
+	switch reloc.Type {
+	case RelocationAbsolute:
+		*word += address
+		return nil
+	case RelocationPCOffset9:
+		bits = 9
+	case RelocationPCOffset11:
+		bits = 11
+	default:
+		return fmt.Errorf("relocation of %q: unknown type %d", reloc.Symbol, reloc.Type)
+	}
+
+	pc := section.Origin + reloc.Offset + 1
+	offset := int16(address-pc) + int16(signExtend(*word, bits))
+	limit := int16(1) << (bits - 1)
+	if offset < -limit || offset >= limit {
+		return fmt.Errorf("relocation of %q at x%04X: offset %d does not fit in %d bits",
+			reloc.Symbol, pc-1, offset, bits)
+	}
+
+	mask := uint16(1)<<bits - 1
+	*word = *word&^mask | uint16(offset)&mask
+	return nil
+}
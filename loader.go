@@ -0,0 +1,172 @@
+package lc3
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Segment is a contiguous block of words placed in memory at Origin.
+type Segment struct {
+	Origin uint16
+	Words  []uint16
+}
+
+// End returns the address of the last word of the segment. It is only
+// meaningful for non-empty segments.
+func (s Segment) End() uint16 {
+	return s.Origin + uint16(len(s.Words)) - 1
+}
+
+func (s Segment) overlaps(other Segment) bool {
+	if len(s.Words) == 0 || len(other.Words) == 0 {
+		return false
+	}
+	return int(s.Origin) <= int(other.End()) && int(other.Origin) <= int(s.End())
+}
+
+// OverlapError is returned when two segments claim the same memory words.
+type OverlapError struct {
+	First, Second Segment
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("segment x%04X-x%04X overlaps segment x%04X-x%04X",
+		e.First.Origin, e.First.End(), e.Second.Origin, e.Second.End())
+}
+
+// TrailingByteError reports a program image with an odd number of bytes.
+type TrailingByteError struct {
+	Offset int64
+}
+
+func (e *TrailingByteError) Error() string {
+	return fmt.Sprintf("odd trailing byte at offset %d", e.Offset)
+}
+
+// OverflowError reports a segment extending past UserMemoryLimit, into the
+// device registers space or beyond the end of memory.
+type OverflowError struct {
+	Segment Segment
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("segment at x%04X of %d words overflows user memory (x%04X) by %d words",
+		e.Segment.Origin, len(e.Segment.Words), UserMemoryLimit, e.Segment.overflow())
+}
+
+// overflow returns how many words of the segment are past UserMemoryLimit.
+func (s Segment) overflow() int {
+	if n := int(s.Origin) + len(s.Words) - int(UserMemoryLimit) - 1; n > 0 {
+		return min(n, len(s.Words))
+	}
+	return 0
+}
+
+// OverflowPolicy tells how loading handles segments overflowing user memory.
+type OverflowPolicy uint8
+
+const (
+	// OverflowReject fails loading with an OverflowError.
+	OverflowReject OverflowPolicy = iota
+	// OverflowTruncate drops the overflowing words, which are reported in
+	// LoadSummary.Truncated.
+	OverflowTruncate
+)
+
+// LoadSummary describes where a segment was loaded.
+type LoadSummary struct {
+	Origin uint16
+	Length int
+	// End is the address of the last loaded word, or Origin if none were.
+	End uint16
+	// Truncated counts the words dropped by OverflowTruncate.
+	Truncated int
+}
+
+// ReadSegment reads a program in the legacy .obj format: a big-endian origin
+// word followed by the words to place from that origin.
+func ReadSegment(program io.Reader) (Segment, error) {
+	origin, err := readValue(program)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = &TrailingByteError{Offset: 0}
+		}
+		return Segment{}, fmt.Errorf("Failed to read orig value from program: %w", err)
+	}
+
+	seg := Segment{Origin: origin}
+	for {
+		value, err := readValue(program)
+		if err != nil {
+			if err == io.EOF {
+				return seg, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = &TrailingByteError{Offset: int64(2 * (len(seg.Words) + 1))}
+			}
+			return Segment{}, fmt.Errorf("Error reading the program: %w", err)
+		}
+
+		if int(origin)+len(seg.Words) >= MemorySize {
+			return Segment{}, &OverflowError{Segment: Segment{Origin: origin, Words: append(seg.Words, value)}}
+		}
+		seg.Words = append(seg.Words, value)
+	}
+}
+
+// NewVMWithSegments creates a VM with several segments loaded, e.g. an
+// operating system, library routines and a user program, and PC set to entry.
+// Like NewVM, a nil input or output falls back to os.Stdin or os.Stdout.
+func NewVMWithSegments(segments []Segment, entry uint16, input io.Reader, output io.Writer) (*VM, error) {
+	return New(withStdio(input, output), WithSegments(segments...), WithPC(entry))
+}
+
+// LoadSegments places segments in memory. It fails without modifying memory if
+// any two segments overlap, including segments loaded by earlier calls, or if
+// a segment overflows user memory and the policy is OverflowReject.
+func (v *VM) LoadSegments(segments ...Segment) ([]LoadSummary, error) {
+	summaries := make([]LoadSummary, len(segments))
+	loaded := make([]Segment, len(segments))
+	for i, seg := range segments {
+		summaries[i] = LoadSummary{Origin: seg.Origin, Length: len(seg.Words)}
+		if n := seg.overflow(); n > 0 {
+			if v.overflow == OverflowReject {
+				return nil, &OverflowError{Segment: seg}
+			}
+			seg.Words = seg.Words[:len(seg.Words)-n]
+			summaries[i].Length, summaries[i].Truncated = len(seg.Words), n
+		}
+		summaries[i].End = seg.Origin + uint16(max(len(seg.Words), 1)) - 1
+		loaded[i] = seg
+	}
+
+	all := append(append([]Segment{}, v.segments...), loaded...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Origin < all[j].Origin })
+	for i := 1; i < len(all); i++ {
+		for j := i - 1; j >= 0; j-- {
+			if all[j].overlaps(all[i]) {
+				return nil, &OverlapError{First: all[j], Second: all[i]}
+			}
+		}
+	}
+
+	for _, seg := range loaded {
+		for i, word := range seg.Words {
+			v.SetMemory(seg.Origin+uint16(i), word)
+		}
+		v.segments = append(v.segments, seg)
+	}
+	return summaries, nil
+}
+
+// SetOverflowPolicy sets how LoadSegments handles segments overflowing user
+// memory.
+func (v *VM) SetOverflowPolicy(policy OverflowPolicy) {
+	v.overflow = policy
+}
+
+// Segments returns the segments loaded into the VM, in load order.
+func (v *VM) Segments() []Segment {
+	return append([]Segment{}, v.segments...)
+}
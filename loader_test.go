@@ -0,0 +1,198 @@
+package lc3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	t.Run("load several segments and start at the entry point", func(t *testing.T) {
+		// OUT; RET
+		library := lc3.Segment{Origin: 0x4000, Words: []uint16{0xf021, 0xc1c0}}
+		// LD R1, x3003; JSRR R1; HALT; .FILL x4000
+		program := lc3.Segment{Origin: 0x3000, Words: []uint16{0x2202, 0x4040, 0xf025, 0x4000}}
+		output := bytes.NewBuffer([]byte{})
+
+		vm, err := lc3.NewVMWithSegments([]lc3.Segment{library, program}, 0x3000, nil, output)
+		assert.NoError(t, err)
+		vm.SetRegister(lc3.RegisterR0, 'Z')
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, "Z", output.String())
+		assert.Len(t, vm.Segments(), 2)
+	})
+
+	t.Run("reject overlapping segments", func(t *testing.T) {
+		first := lc3.Segment{Origin: 0x3000, Words: make([]uint16, 16)}
+		second := lc3.Segment{Origin: 0x300f, Words: []uint16{0x1234}}
+
+		_, err := lc3.NewVMWithSegments([]lc3.Segment{second, first}, 0x3000, nil, nil)
+		var overlap *lc3.OverlapError
+		assert.ErrorAs(t, err, &overlap)
+		assert.Equal(t, uint16(0x3000), overlap.First.Origin)
+
+		vm, err := lc3.NewVMWithSegments([]lc3.Segment{first}, 0x3000, nil, nil)
+		assert.NoError(t, err)
+		_, err = vm.LoadSegments(second)
+		assert.Error(t, err)
+		val, err := vm.GetMemory(0x300f)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0), val)
+	})
+
+	t.Run("link modules with external symbols", func(t *testing.T) {
+		main := &lc3.Object{
+			Entry: 0x3000, HasEntry: true,
+			// JSR PRINT; HALT; .FILL MESSAGE
+			Sections: []lc3.Section{{Name: ".text", Origin: 0x3000, Words: []uint16{0x4800, 0xf025, 0x0000}}},
+			Symbols: []lc3.Symbol{
+				{Name: "PRINT", Kind: lc3.SymbolExternal},
+				{Name: "MESSAGE", Kind: lc3.SymbolExternal},
+			},
+			Relocations: []lc3.Relocation{
+				{Section: 0, Offset: 0, Type: lc3.RelocationPCOffset11, Symbol: "PRINT"},
+				{Section: 0, Offset: 2, Type: lc3.RelocationAbsolute, Symbol: "MESSAGE"},
+			},
+		}
+		library := &lc3.Object{
+			// PRINT: LEA R0, MESSAGE; PUTS; RET; MESSAGE: .STRINGZ "ok"
+			Sections: []lc3.Section{{Name: ".text", Origin: 0x3100, Words: []uint16{0xe002, 0xf022, 0xc1c0, 'o', 'k', 0}}},
+			Symbols: []lc3.Symbol{
+				{Name: "PRINT", Address: 0x3100, Kind: lc3.SymbolGlobal},
+				{Name: "MESSAGE", Address: 0x3103, Kind: lc3.SymbolGlobal},
+			},
+		}
+
+		linked, err := lc3.Link(main, library)
+		assert.NoError(t, err)
+		assert.Empty(t, linked.Relocations)
+		assert.Equal(t, uint16(0x48ff), linked.Sections[0].Words[0])
+		assert.Equal(t, uint16(0x3103), linked.Sections[0].Words[2])
+		// Inputs are left untouched.
+		assert.Equal(t, uint16(0x4800), main.Sections[0].Words[0])
+
+		output := bytes.NewBuffer([]byte{})
+		vm, err := lc3.NewVMWithSegments(linked.Segments(), linked.Entry, nil, output)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, "ok", output.String())
+	})
+
+	t.Run("add the word of absolute relocations to the address", func(t *testing.T) {
+		obj := &lc3.Object{
+			// .FILL TABLE+2; .FILL TABLE-1; TABLE: .BLKW 4
+			Sections:    []lc3.Section{{Origin: 0x3000, Words: []uint16{2, 0xffff, 0, 0, 0, 0}}},
+			Symbols:     []lc3.Symbol{{Name: "TABLE", Address: 0x3002}},
+			Relocations: []lc3.Relocation{{Offset: 0, Symbol: "TABLE"}, {Offset: 1, Symbol: "TABLE"}},
+		}
+
+		linked, err := lc3.Link(obj)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint16{0x3004, 0x3001}, linked.Sections[0].Words[:2])
+	})
+
+	t.Run("report undefined symbols", func(t *testing.T) {
+		obj := &lc3.Object{
+			Sections:    []lc3.Section{{Origin: 0x3000, Words: []uint16{0x0000, 0x0000}}},
+			Relocations: []lc3.Relocation{{Offset: 0, Symbol: "B"}, {Offset: 1, Symbol: "A"}},
+		}
+
+		_, err := lc3.Link(obj)
+		var undefined *lc3.UndefinedSymbolsError
+		assert.ErrorAs(t, err, &undefined)
+		assert.Equal(t, []string{"A", "B"}, undefined.Names)
+	})
+	t.Run("load from a reader returning one byte at a time", func(t *testing.T) {
+		f, closer := openTestfile(t, "testdata/hello-world.obj")
+		defer closer()
+
+		output := bytes.NewBuffer([]byte{})
+		vm, err := lc3.NewVM(iotest.OneByteReader(f), nil, output)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, "Hello World!", output.String())
+	})
+
+	t.Run("report odd trailing bytes with their offset", func(t *testing.T) {
+		testCases := []struct {
+			program string
+			offset  int64
+		}{
+			{"\x30", 0},
+			{"\x30\x00\x08", 2},
+			{"\x30\x00\x12\x34\x56", 4},
+		}
+
+		for _, test := range testCases {
+			_, err := lc3.ReadSegment(strings.NewReader(test.program))
+			var trailing *lc3.TrailingByteError
+			if assert.ErrorAs(t, err, &trailing) {
+				assert.Equal(t, test.offset, trailing.Offset)
+			}
+		}
+	})
+
+	t.Run("reject or truncate segments overflowing user memory", func(t *testing.T) {
+		seg := lc3.Segment{Origin: 0xfdfe, Words: []uint16{1, 2, 3, 4}}
+
+		vm, err := lc3.NewVMWithSegments(nil, 0x3000, nil, nil)
+		assert.NoError(t, err)
+		_, err = vm.LoadSegments(seg)
+		var overflow *lc3.OverflowError
+		assert.ErrorAs(t, err, &overflow)
+
+		vm.SetOverflowPolicy(lc3.OverflowTruncate)
+		summaries, err := vm.LoadSegments(seg)
+		assert.NoError(t, err)
+		assert.Equal(t, []lc3.LoadSummary{{Origin: 0xfdfe, Length: 2, End: 0xfdff, Truncated: 2}}, summaries)
+		val, err := vm.GetMemory(0xfdff)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(2), val)
+
+		_, err = lc3.ReadSegment(bytes.NewReader(make([]byte, 2*lc3.MemorySize+4)))
+		assert.ErrorAs(t, err, &overflow)
+	})
+
+	t.Run("summarize loaded segments", func(t *testing.T) {
+		vm, err := lc3.NewVMWithSegments(nil, 0x3000, nil, nil)
+		assert.NoError(t, err)
+
+		summaries, err := vm.LoadSegments(
+			lc3.Segment{Origin: 0x3000, Words: make([]uint16, 16)},
+			lc3.Segment{Origin: 0x4000},
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, []lc3.LoadSummary{
+			{Origin: 0x3000, Length: 16, End: 0x300f},
+			{Origin: 0x4000, Length: 0, End: 0x4000},
+		}, summaries)
+	})
+
+	t.Run("find the entry point of an object", func(t *testing.T) {
+		sections := []lc3.Section{{Origin: 0x3000}, {Origin: 0x4000}}
+		entry, ok := (&lc3.Object{Entry: 0x4000, HasEntry: true, Sections: sections}).EntryPoint()
+		assert.True(t, ok)
+		assert.Equal(t, uint16(0x4000), entry)
+		entry, ok = (&lc3.Object{Sections: sections}).EntryPoint()
+		assert.True(t, ok)
+		assert.Equal(t, uint16(0x3000), entry)
+		_, ok = (&lc3.Object{}).EntryPoint()
+		assert.False(t, ok)
+	})
+
+	t.Run("parse addresses", func(t *testing.T) {
+		for _, s := range []string{"x3000", "X3000", "0x3000", "12288"} {
+			address, err := lc3.ParseAddress(s)
+			assert.NoError(t, err, s)
+			assert.Equal(t, uint16(0x3000), address, s)
+		}
+		for _, s := range []string{"", "x", "x10000", "3000h", "-1"} {
+			_, err := lc3.ParseAddress(s)
+			assert.Error(t, err, s)
+		}
+	})
+}
@@ -0,0 +1,644 @@
+package lc3
+
+// Datapath multiplexer selections and ALU operations, named after the control
+// signals of the LC-3 microarchitecture.
+type (
+	PCMux     uint8
+	DRMux     uint8
+	SR1Mux    uint8
+	Addr1Mux  uint8
+	Addr2Mux  uint8
+	MARMux    uint8
+	ALUK      uint8
+	SPMux     uint8
+	VectorMux uint8
+	Cond      uint8
+)
+
+const (
+	PCMuxIncrement PCMux = iota // PC+1
+	PCMuxBus
+	PCMuxAdder
+)
+
+const (
+	DRMuxIR11 DRMux = iota // IR[11:9]
+	DRMuxR7
+	DRMuxSP // R6
+)
+
+const (
+	SR1MuxIR11 SR1Mux = iota // IR[11:9]
+	SR1MuxIR8                // IR[8:6]
+	SR1MuxSP                 // R6
+)
+
+const (
+	Addr1MuxPC    Addr1Mux = iota
+	Addr1MuxBaseR          // SR1 output
+)
+
+const (
+	Addr2MuxZero Addr2Mux = iota
+	Addr2MuxOffset6
+	Addr2MuxPCOffset9
+	Addr2MuxPCOffset11
+)
+
+const (
+	MARMuxTrapVector MARMux = iota // ZEXT(IR[7:0])
+	MARMuxAdder
+)
+
+const (
+	ALUAdd ALUK = iota
+	ALUAnd
+	ALUNot
+	ALUPassA
+)
+
+const (
+	SPMuxIncrement SPMux = iota // SR1 output + 1
+	SPMuxDecrement              // SR1 output - 1
+	SPMuxSavedSSP
+	SPMuxSavedUSP
+)
+
+const (
+	VectorMuxINTV VectorMux = iota // vector of the interrupting device
+	VectorMuxPrivilege
+	VectorMuxIllegalOpcode
+	VectorMuxACV
+)
+
+// Microsequencer branch conditions. When true, they set a bit of J.
+const (
+	CondNone      Cond = iota
+	CondAddrMode       // IR[11], bit 0
+	CondReady          // memory ready R, bit 1
+	CondBEN            // branch enable, bit 2
+	CondPrivilege      // PSR[15], bit 3
+	CondINT            // interrupt request, bit 4
+)
+
+// Microinstruction is a control store entry: the control signals asserted
+// during a state, and how the microsequencer selects the next state.
+type Microinstruction struct {
+	// Registers loaded at the end of the cycle. LDPriv enters supervisor
+	// mode, LDPriority sets the priority level of the interrupt being
+	// initiated and LDACV checks the address loaded in MAR.
+	LDMAR, LDMDR, LDIR, LDBEN, LDREG, LDCC, LDPC      bool
+	LDPriv, LDPriority, LDPSR, LDSavedSSP, LDSavedUSP bool
+	LDVector, LDACV                                   bool
+
+	// Gates driving the bus; at most one is asserted.
+	GatePC, GateMDR, GateALU, GateMARMUX, GateVector, GatePSR, GateSP bool
+
+	PCMUX     PCMux
+	DRMUX     DRMux
+	SR1MUX    SR1Mux
+	ADDR1MUX  Addr1Mux
+	ADDR2MUX  Addr2Mux
+	MARMUX    MARMux
+	ALUK      ALUK
+	SPMUX     SPMux
+	VectorMUX VectorMux
+
+	// MIOEN enables memory: MDR is loaded from M[MAR], or written to it with
+	// RW, once the ready bit is set.
+	MIOEN, RW bool
+
+	// IRD selects the next state from the opcode in IR[15:12]. Otherwise it
+	// is J, with a bit set when Cond is true.
+	IRD  bool
+	Cond Cond
+	J    uint8
+}
+
+// States of the control store with a special role.
+const (
+	stateFetch     = 18
+	stateDecode    = 32
+	stateIllegal   = 13
+	stateTrapRead  = 28
+	stateTrapJump  = 30
+	stateStoreMDR  = 23
+	statePrivilege = 44
+	stateInterrupt = 49
+	stateACV       = 60
+)
+
+// controlStore holds the microcode of the LC-3 state machine (Patt & Patel,
+// appendix C). Unused states are zero.
+var controlStore = [64]Microinstruction{
+	// Fetch: MAR<-PC, PC<-PC+1, unless an interrupt is taken.
+	18: {LDMAR: true, GatePC: true, LDPC: true, PCMUX: PCMuxIncrement, LDACV: true, Cond: CondINT, J: 33},
+	// MDR<-M[MAR]
+	33: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 33},
+	// IR<-MDR
+	35: {GateMDR: true, LDIR: true, J: 32},
+	// Decode: BEN<-IR[11]&N + IR[10]&Z + IR[9]&P
+	32: {LDBEN: true, IRD: true},
+
+	// BR
+	0:  {Cond: CondBEN, J: 18},
+	22: {LDPC: true, PCMUX: PCMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9, J: 18},
+
+	// ADD, AND, NOT: DR<-SR1 op OP2, set CC
+	1: {LDREG: true, DRMUX: DRMuxIR11, SR1MUX: SR1MuxIR8, ALUK: ALUAdd, GateALU: true, LDCC: true, J: 18},
+	5: {LDREG: true, DRMUX: DRMuxIR11, SR1MUX: SR1MuxIR8, ALUK: ALUAnd, GateALU: true, LDCC: true, J: 18},
+	9: {LDREG: true, DRMUX: DRMuxIR11, SR1MUX: SR1MuxIR8, ALUK: ALUNot, GateALU: true, LDCC: true, J: 18},
+
+	// LEA: DR<-PC+off9, set CC
+	14: {LDREG: true, DRMUX: DRMuxIR11, LDCC: true, GateMARMUX: true, MARMUX: MARMuxAdder,
+		ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9, J: 18},
+
+	// LD, LDR, LDI: MAR<-address
+	2: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9,
+		LDACV: true, J: 25},
+	6: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxBaseR, SR1MUX: SR1MuxIR8,
+		ADDR2MUX: Addr2MuxOffset6, LDACV: true, J: 25},
+	10: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9,
+		LDACV: true, J: 24},
+	// MDR<-M[MAR], MAR<-MDR
+	24: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 24},
+	26: {LDMAR: true, GateMDR: true, LDACV: true, J: 25},
+	// MDR<-M[MAR], DR<-MDR, set CC
+	25: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 25},
+	27: {LDREG: true, DRMUX: DRMuxIR11, GateMDR: true, LDCC: true, J: 18},
+
+	// ST, STR, STI: MAR<-address
+	3: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9,
+		LDACV: true, J: 23},
+	7: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxBaseR, SR1MUX: SR1MuxIR8,
+		ADDR2MUX: Addr2MuxOffset6, LDACV: true, J: 23},
+	11: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset9,
+		LDACV: true, J: 29},
+	// MDR<-M[MAR], MAR<-MDR
+	29: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 29},
+	31: {LDMAR: true, GateMDR: true, LDACV: true, J: 23},
+	// MDR<-SR, M[MAR]<-MDR
+	23: {LDMDR: true, SR1MUX: SR1MuxIR11, ALUK: ALUPassA, GateALU: true, J: 16},
+	16: {MIOEN: true, RW: true, Cond: CondReady, J: 16},
+
+	// JSR, JSRR: R7<-PC, PC<-target
+	4:  {Cond: CondAddrMode, J: 20},
+	20: {LDREG: true, DRMUX: DRMuxR7, GatePC: true, LDPC: true, PCMUX: PCMuxAdder, ADDR1MUX: Addr1MuxBaseR, SR1MUX: SR1MuxIR8, ADDR2MUX: Addr2MuxZero, J: 18},
+	21: {LDREG: true, DRMUX: DRMuxR7, GatePC: true, LDPC: true, PCMUX: PCMuxAdder, ADDR1MUX: Addr1MuxPC, ADDR2MUX: Addr2MuxPCOffset11, J: 18},
+
+	// JMP: PC<-BaseR
+	12: {LDPC: true, PCMUX: PCMuxAdder, ADDR1MUX: Addr1MuxBaseR, SR1MUX: SR1MuxIR8, ADDR2MUX: Addr2MuxZero, J: 18},
+
+	// TRAP: MAR<-ZEXT(trapvect8), MDR<-M[MAR], R7<-PC, PC<-MDR
+	15: {LDMAR: true, GateMARMUX: true, MARMUX: MARMuxTrapVector, J: 28},
+	28: {MIOEN: true, LDMDR: true, LDREG: true, DRMUX: DRMuxR7, GatePC: true, Cond: CondReady, J: 28},
+	30: {LDPC: true, PCMUX: PCMuxBus, GateMDR: true, J: 18},
+
+	// RTI: MAR<-R6, privilege exception in user mode
+	8: {LDMAR: true, SR1MUX: SR1MuxSP, ALUK: ALUPassA, GateALU: true, Cond: CondPrivilege, J: 36},
+	// PC<-M[R6], MAR, R6<-R6+1
+	36: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 36},
+	38: {LDPC: true, PCMUX: PCMuxBus, GateMDR: true, J: 39},
+	39: {LDMAR: true, LDREG: true, DRMUX: DRMuxSP, SR1MUX: SR1MuxSP, SPMUX: SPMuxIncrement, GateSP: true, J: 40},
+	// PSR<-M[R6], R6<-R6+1
+	40: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 40},
+	42: {LDPSR: true, GateMDR: true, J: 34},
+	34: {LDREG: true, DRMUX: DRMuxSP, SR1MUX: SR1MuxSP, SPMUX: SPMuxIncrement, GateSP: true, Cond: CondPrivilege, J: 51},
+	51: {J: 18},
+	// Back to user mode: Saved.SSP<-R6, R6<-Saved.USP
+	59: {LDSavedSSP: true, SR1MUX: SR1MuxSP, LDREG: true, DRMUX: DRMuxSP, SPMUX: SPMuxSavedUSP, GateSP: true, J: 18},
+
+	// Interrupt and exceptions: Vector<-..., MDR<-PSR, enter supervisor mode
+	49: {LDVector: true, VectorMUX: VectorMuxINTV, LDMDR: true, GatePSR: true, LDPriv: true, LDPriority: true,
+		Cond: CondPrivilege, J: 37},
+	44: {LDVector: true, VectorMUX: VectorMuxPrivilege, LDMDR: true, GatePSR: true, LDPriv: true,
+		Cond: CondPrivilege, J: 37},
+	13: {LDVector: true, VectorMUX: VectorMuxIllegalOpcode, LDMDR: true, GatePSR: true, LDPriv: true,
+		Cond: CondPrivilege, J: 37},
+	60: {LDVector: true, VectorMUX: VectorMuxACV, LDMDR: true, GatePSR: true, LDPriv: true,
+		Cond: CondPrivilege, J: 37},
+	// From user mode: Saved.USP<-R6, R6<-Saved.SSP
+	45: {LDSavedUSP: true, SR1MUX: SR1MuxSP, LDREG: true, DRMUX: DRMuxSP, SPMUX: SPMuxSavedSSP, GateSP: true, J: 37},
+	// Push PSR
+	37: {LDMAR: true, LDREG: true, DRMUX: DRMuxSP, SR1MUX: SR1MuxSP, SPMUX: SPMuxDecrement, GateSP: true, J: 41},
+	41: {MIOEN: true, RW: true, Cond: CondReady, J: 41},
+	// Push PC
+	43: {LDMDR: true, GatePC: true, J: 47},
+	47: {LDMAR: true, LDREG: true, DRMUX: DRMuxSP, SR1MUX: SR1MuxSP, SPMUX: SPMuxDecrement, GateSP: true, J: 48},
+	48: {MIOEN: true, RW: true, Cond: CondReady, J: 48},
+	// PC<-M[x01'Vector]
+	50: {LDMAR: true, GateVector: true, J: 52},
+	52: {MIOEN: true, LDMDR: true, Cond: CondReady, J: 52},
+	54: {LDPC: true, PCMUX: PCMuxBus, GateMDR: true, J: 18},
+}
+
+// Microstate is the state of the datapath between two cycles.
+type Microstate struct {
+	// State is the next state to execute, and Control its microinstruction.
+	State   uint8
+	Control Microinstruction
+
+	MAR, MDR, IR uint16
+	BEN          bool
+	// Ready is the memory ready bit and Bus the value driven on the bus,
+	// during the last cycle.
+	Ready bool
+	Bus   uint16
+}
+
+// MicroTracer is called after each cycle of the microcode engine.
+type MicroTracer func(v *VM, m Microstate)
+
+// WithMicroTracer adds a tracer called after each cycle of the microcode
+// engine.
+func WithMicroTracer(tracer MicroTracer) Option {
+	return func(o *options) { o.microTracers = append(o.microTracers, tracer) }
+}
+
+type microMachine struct {
+	state        uint8
+	mar, mdr, ir uint16
+	ben, ready   bool
+	bus          uint16
+	vector       uint8
+
+	// wait counts the cycles of the current memory access.
+	wait int
+	// pc is the address of the instruction being executed.
+	pc uint16
+	// decoded and exception tell whether the current sequence executed an
+	// instruction, or initiated an exception.
+	decoded, exception bool
+	irq                interruptRequest
+	trap               TrapHandler
+	// acvWrite tells whether the access rejected by ACV was a write.
+	acvWrite bool
+}
+
+// Microstate returns the state of the microcode engine.
+func (v *VM) Microstate() Microstate {
+	m := v.microMachine()
+	return Microstate{
+		State:   m.state,
+		Control: controlStore[m.state],
+		MAR:     m.mar,
+		MDR:     m.mdr,
+		IR:      m.ir,
+		BEN:     m.ben,
+		Ready:   m.ready,
+		Bus:     m.bus,
+	}
+}
+
+// Cycle executes a single clock cycle of the microcode engine.
+func (v *VM) Cycle() error {
+	if err := v.checkRunning(); err != nil {
+		return err
+	}
+	_, err := v.microCycle()
+	return err
+}
+
+func (v *VM) microMachine() *microMachine {
+	if v.micro == nil {
+		v.micro = &microMachine{state: stateFetch}
+	}
+	return v.micro
+}
+
+// stepMicro runs cycles up to the next instruction boundary, including the
+// instruction following an interrupt initiation.
+func (v *VM) stepMicro() error {
+	m := v.microMachine()
+	for {
+		interrupt := false
+		for {
+			if m.state == stateInterrupt {
+				interrupt = true
+			}
+			done, err := v.microCycle()
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+		}
+		if !interrupt {
+			return nil
+		}
+	}
+}
+
+// microCycle executes a cycle and tells whether it completed an instruction
+// or an interrupt initiation.
+func (v *VM) microCycle() (bool, error) {
+	m := v.microMachine()
+	c := &controlStore[m.state]
+	ir := m.ir
+
+	switch m.state {
+	case stateFetch:
+		m.pc = v.registers[RegisterPC]
+		m.decoded, m.exception, m.trap = false, false, nil
+	case stateDecode:
+		m.decoded = true
+		if v.codeGuard != nil {
+			if err := v.checkFetch(m.pc, ir); err != nil {
+				return false, v.microFault(err)
+			}
+		}
+		if v.shadow != nil || v.stackGuard != nil {
+			d := decode(ir)
+			if v.shadow != nil {
+				if err := v.checkInitialized(m.pc, &d); err != nil {
+					return false, v.microFault(err)
+				}
+			}
+			if v.stackGuard != nil {
+				if err := v.checkStack(m.pc, &d); err != nil {
+					return false, v.microFault(err)
+				}
+			}
+		}
+	case OperationNOT:
+		if ir&0x3f != 0x3f {
+			return false, v.microFault(errInvalidNot)
+		}
+	case OperationTRAP:
+		m.trap = v.traps[uint8(ir)]
+	case stateIllegal, statePrivilege, stateACV:
+		if v.protection != ProtectionException {
+			var err error = &illegalOpcodeError{OperationRES}
+			if m.state == statePrivilege {
+				err = ErrPrivilegeViolation
+			} else if m.state == stateACV {
+				err = &AccessViolationError{PC: m.pc, Address: m.mar, Write: m.acvWrite}
+			}
+			return false, v.microFault(err)
+		}
+		m.exception = true
+	case stateTrapJump:
+		if m.trap != nil {
+			// Go handlers replace the service routine, and leave R7 alone
+			// like the interpreter. They see PC on the TRAP, as documented
+			// for TrapHandler, rather than incremented by FETCH.
+			v.registers[RegisterPC] = m.pc
+			if err := m.trap(v); err != nil {
+				return false, v.microFault(err)
+			}
+			v.registers[RegisterPC]++
+			return v.microCommit(c, stateFetch, m.bus, false), nil
+		}
+	}
+
+	// Combinational logic.
+	sr1 := v.registers[v.microRegister(c.SR1MUX, ir)]
+	sr2 := v.registers[ir&0x7]
+	if ir&0x20 != 0 {
+		sr2 = signExtend(ir, 5)
+	}
+	var alu uint16
+	switch c.ALUK {
+	case ALUAdd:
+		alu = sr1 + sr2
+	case ALUAnd:
+		alu = sr1 & sr2
+	case ALUNot:
+		alu = ^sr1
+	case ALUPassA:
+		alu = sr1
+	}
+
+	addr1 := v.registers[RegisterPC]
+	if c.ADDR1MUX == Addr1MuxBaseR {
+		addr1 = sr1
+	}
+	var addr2 uint16
+	switch c.ADDR2MUX {
+	case Addr2MuxOffset6:
+		addr2 = signExtend(ir, 6)
+	case Addr2MuxPCOffset9:
+		addr2 = signExtend(ir, 9)
+	case Addr2MuxPCOffset11:
+		addr2 = signExtend(ir, 11)
+	}
+	adder := addr1 + addr2
+
+	marmux := ir & 0xff
+	if c.MARMUX == MARMuxAdder {
+		marmux = adder
+	}
+
+	var sp uint16
+	switch c.SPMUX {
+	case SPMuxIncrement:
+		sp = sr1 + 1
+	case SPMuxDecrement:
+		sp = sr1 - 1
+	case SPMuxSavedSSP:
+		sp = v.savedSSP
+	case SPMuxSavedUSP:
+		sp = v.savedUSP
+	}
+
+	var bus uint16
+	switch {
+	case c.GatePC:
+		bus = v.registers[RegisterPC]
+	case c.GateMDR:
+		bus = m.mdr
+	case c.GateALU:
+		bus = alu
+	case c.GateMARMUX:
+		bus = marmux
+	case c.GateVector:
+		bus = MemoryInterruptVectors + uint16(m.vector)
+	case c.GatePSR:
+		bus = v.PSR()
+	case c.GateSP:
+		bus = sp
+	}
+
+	// Memory.
+	ready := false
+	var memory uint16
+	if c.MIOEN {
+		m.wait++
+		if ready = m.wait >= v.microLatency(m.mar); ready {
+			m.wait = 0
+			var err error
+			if c.RW {
+				err = v.store(m.mar, m.mdr)
+			} else {
+				memory, err = v.GetMemory(m.mar)
+			}
+			if err != nil {
+				return false, v.microFault(err)
+			}
+		}
+	}
+
+	// Microsequencer.
+	interrupt := false
+	if m.state == stateFetch {
+		m.irq, interrupt = v.takeInterrupt()
+	}
+	next := c.J
+	if c.IRD {
+		next = uint8(ir >> 12)
+	}
+	switch {
+	case c.Cond == CondAddrMode && ir&0x800 != 0:
+		next |= 1 << 0
+	case c.Cond == CondReady && ready:
+		next |= 1 << 1
+	case c.Cond == CondBEN && m.ben:
+		next |= 1 << 2
+	case c.Cond == CondPrivilege && !v.Privileged():
+		next |= 1 << 3
+	case c.Cond == CondINT && interrupt:
+		next |= 1 << 4
+	}
+	if c.LDACV && !interrupt && v.checkAccess(bus, false) != nil {
+		next, m.acvWrite = stateACV, c.J == stateStoreMDR
+	}
+
+	// Registers are loaded at the end of the cycle.
+	if c.LDMDR {
+		if !c.MIOEN {
+			m.mdr = bus
+		} else if ready {
+			m.mdr = memory
+		}
+	}
+	if c.LDIR {
+		m.ir = bus
+	}
+	if c.LDBEN {
+		m.ben = (ir>>9)&v.registers[RegisterCOND]&0x7 != 0
+	}
+	if c.LDVector {
+		m.vector = [...]uint8{m.irq.vector, ExceptionPrivilege, ExceptionIllegalOpcode, ExceptionACV}[c.VectorMUX]
+	}
+	if c.LDSavedSSP {
+		v.savedSSP = sr1
+	}
+	if c.LDSavedUSP {
+		v.savedUSP = sr1
+	}
+	if c.LDPSR {
+		v.setPSR(bus)
+	}
+	if c.LDPriv {
+		v.psr &^= PSRUser
+	}
+	if c.LDPriority {
+		v.setPriority(m.irq.priority)
+	}
+	if c.LDREG && (m.state != stateTrapRead || m.trap == nil) {
+		dr := v.microDestination(c.DRMUX, ir)
+		v.registers[dr] = bus
+		if v.shadow != nil {
+			v.shadow.setRegister(dr)
+		}
+	}
+	if c.LDCC {
+		v.registers[RegisterCOND] = conditionCodes(bus)
+	}
+	if c.LDPC && !interrupt {
+		switch c.PCMUX {
+		case PCMuxIncrement:
+			v.registers[RegisterPC]++
+		case PCMuxBus:
+			v.registers[RegisterPC] = bus
+		case PCMuxAdder:
+			v.registers[RegisterPC] = adder
+		}
+	}
+	if c.LDMAR {
+		m.mar = bus
+	}
+	return v.microCommit(c, next, bus, ready), nil
+}
+
+// microCommit moves to the next state, and completes the instruction when it
+// is the fetch state.
+func (v *VM) microCommit(c *Microinstruction, next uint8, bus uint16, ready bool) bool {
+	m := v.micro
+	m.state, m.bus, m.ready = next, bus, ready
+	if v.timing != nil {
+		v.timing.cycles++
+	}
+	for _, tracer := range v.microTracers {
+		tracer(v, v.Microstate())
+	}
+	if next != stateFetch {
+		return false
+	}
+
+	if m.decoded && !m.exception {
+		op := uint8(m.ir >> 12)
+		if v.codeGuard != nil {
+			v.trackTransfer(m.pc)
+		}
+		if v.stackGuard != nil {
+			v.trackFrames(m.pc, m.ir)
+		}
+		for _, tracer := range v.tracers {
+			tracer.Trace(v, m.pc, m.ir)
+		}
+		if v.timing != nil {
+			v.timing.stats[op].Count++
+			v.timing.stats[op].Cycles += v.timing.cycles - v.timing.start
+		}
+	}
+	if v.timing != nil {
+		v.timing.start = v.timing.cycles
+		v.advance(0)
+	}
+	return true
+}
+
+// microFault abandons the current instruction after an error, leaving PC at
+// its address.
+func (v *VM) microFault(err error) error {
+	m := v.micro
+	v.registers[RegisterPC] = m.pc
+	m.state, m.wait = stateFetch, 0
+	if v.timing != nil {
+		v.timing.start = v.timing.cycles
+	}
+	return err
+}
+
+func (v *VM) microRegister(mux SR1Mux, ir uint16) Register {
+	switch mux {
+	case SR1MuxIR11:
+		return Register((ir >> 9) & 0x7)
+	case SR1MuxIR8:
+		return Register((ir >> 6) & 0x7)
+	}
+	return RegisterR6
+}
+
+func (v *VM) microDestination(mux DRMux, ir uint16) Register {
+	switch mux {
+	case DRMuxIR11:
+		return Register((ir >> 9) & 0x7)
+	case DRMuxR7:
+		return RegisterR7
+	}
+	return RegisterR6
+}
+
+// microLatency returns the number of cycles of a memory access.
+func (v *VM) microLatency(address uint16) int {
+	if v.timing == nil {
+		return 1
+	}
+	if address > UserMemoryLimit {
+		return v.timing.model.DeviceLatency
+	}
+	return v.timing.model.MemoryLatency
+}
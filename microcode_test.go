@@ -0,0 +1,175 @@
+package lc3_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMicrocode(t *testing.T) {
+	t.Run("go through the states of an instruction", func(t *testing.T) {
+		var states []uint8
+		var buses []uint16
+		vm, err := lc3.New(
+			lc3.WithEngine(lc3.EngineMicrocode),
+			lc3.WithTiming(lc3.TimingModel{MemoryLatency: 3, DeviceLatency: 1}),
+			lc3.WithMemory(0x3000, 0x1021, 0x2201, 0x0000, 0x1234), // ADD R0, R0, #1; LD R1, #1
+			lc3.WithMicroTracer(func(v *lc3.VM, m lc3.Microstate) {
+				states = append(states, m.State)
+				buses = append(buses, m.Bus)
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, uint8(18), vm.Microstate().State)
+
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, []uint8{33, 33, 33, 35, 32, 1, 18}, states)
+		assert.Equal(t, uint16(0x3000), buses[0])
+		assert.Equal(t, uint16(0x1021), buses[4])
+		assert.Equal(t, uint16(1), buses[6])
+		assert.Equal(t, uint64(len(states)), vm.Cycles())
+
+		states = nil
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, []uint8{33, 33, 33, 35, 32, 2, 25, 25, 25, 27, 18}, states)
+		m := vm.Microstate()
+		assert.Equal(t, uint16(0x3003), m.MAR)
+		assert.Equal(t, uint16(0x1234), m.MDR)
+		assert.Equal(t, uint16(0x2201), m.IR)
+		assert.True(t, m.Control.LDMAR && m.Control.GatePC)
+	})
+
+	t.Run("execute single cycles", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithEngine(lc3.EngineMicrocode), lc3.WithMemory(0x3000, 0x1021))
+		require.NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, vm.Cycle())
+		}
+		assert.Equal(t, uint8(1), vm.Microstate().State)
+		assert.Equal(t, uint16(0), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, uint8(18), vm.Microstate().State)
+	})
+
+	t.Run("agree with the interpreter and the timing model", func(t *testing.T) {
+		testCases := []struct {
+			program string
+			input   string
+		}{
+			{"testdata/hello-world.obj", ""},
+			{"testdata/loop.obj", ""},
+			{"testdata/reverse-string.obj", ""},
+			{"testdata/2048.obj", "n" + strings.Repeat("wasd", 50)},
+			{"testdata/rogue.obj", strings.Repeat("sdsdwawa", 20)},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.program, func(t *testing.T) {
+				image, err := os.ReadFile(test.program)
+				require.NoError(t, err)
+
+				refOutput, microOutput := bytes.NewBuffer([]byte{}), bytes.NewBuffer([]byte{})
+				ref, err := lc3.New(lc3.WithProgram(bytes.NewReader(image)),
+					lc3.WithInput(strings.NewReader(test.input)), lc3.WithOutput(refOutput),
+					lc3.WithTiming(lc3.DefaultTimingModel))
+				require.NoError(t, err)
+				micro, err := lc3.New(lc3.WithProgram(bytes.NewReader(image)),
+					lc3.WithInput(strings.NewReader(test.input)), lc3.WithOutput(microOutput),
+					lc3.WithTiming(lc3.DefaultTimingModel), lc3.WithEngine(lc3.EngineMicrocode))
+				require.NoError(t, err)
+
+				// 2048 polls KBSR forever once input is exhausted.
+				for steps := 0; micro.State() == lc3.StateRunning && steps < 200000; steps++ {
+					microErr, refErr := micro.Step(), ref.Step()
+					require.Equal(t, fmt.Sprint(refErr), fmt.Sprint(microErr))
+					require.Equal(t, registers(ref), registers(micro), "step %d", steps)
+					require.Equal(t, ref.Cycles(), micro.Cycles(), "step %d", steps)
+					if microErr != nil {
+						break
+					}
+				}
+
+				assert.Equal(t, ref.RawMemory(), micro.RawMemory())
+				assert.Equal(t, ref.State(), micro.State())
+				assert.Equal(t, ref.CycleStats(), micro.CycleStats())
+				assert.Equal(t, refOutput.String(), microOutput.String())
+			})
+		}
+	})
+
+	t.Run("raise exceptions and interrupts like the interpreter", func(t *testing.T) {
+		program := []lc3.Option{
+			lc3.WithMemoryProtection(lc3.ProtectionException),
+			// LDR R0, R1, #0; RES; RTI; BRnzp #-1
+			lc3.WithMemory(0x3000, 0x6040, 0xd000, 0x8000, 0x0fff),
+			lc3.WithMemory(0x0100, 0x1000, 0x1000, 0x1000),
+			lc3.WithMemory(0x0180, 0x1000),
+			// Handler: ADD R2, R2, #1; RTI
+			lc3.WithMemory(0x1000, 0x14a1, 0x8000),
+			lc3.WithRegister(lc3.RegisterR1, 0x0010),
+			lc3.WithRegister(lc3.RegisterR6, 0x5000),
+		}
+		ref, err := lc3.New(program...)
+		require.NoError(t, err)
+		micro, err := lc3.New(append(program, lc3.WithEngine(lc3.EngineMicrocode))...)
+		require.NoError(t, err)
+
+		for step := 0; step < 12; step++ {
+			if step == 8 {
+				assert.NoError(t, ref.RequestInterrupt(0x80, 4))
+				assert.NoError(t, micro.RequestInterrupt(0x80, 4))
+			}
+			assert.NoError(t, ref.Step())
+			assert.NoError(t, micro.Step())
+			require.Equal(t, registers(ref), registers(micro), "step %d", step)
+			require.Equal(t, ref.PSR(), micro.PSR(), "step %d", step)
+		}
+		assert.Equal(t, uint16(4), micro.GetRegister(lc3.RegisterR2))
+		assert.Equal(t, ref.RawMemory(), micro.RawMemory())
+	})
+
+	t.Run("report errors like the interpreter", func(t *testing.T) {
+		testCases := []struct {
+			name    string
+			program []uint16
+		}{
+			{"LDR from system space", []uint16{0x6040}},
+			{"STI through user memory", []uint16{0xb000, 0xfe02}},
+			{"fetch from system space", []uint16{0xc040}},
+			{"RES", []uint16{0xd000}},
+			{"RTI in user mode", []uint16{0x8000}},
+			{"NOT with invalid trailing bits", []uint16{0x9000}},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				var errs []string
+				for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineMicrocode} {
+					vm, err := lc3.New(
+						lc3.WithEngine(engine),
+						lc3.WithMemoryProtection(lc3.ProtectionError),
+						lc3.WithMemory(0x3000, test.program...),
+						lc3.WithRegister(lc3.RegisterR1, 0x1000),
+					)
+					require.NoError(t, err)
+
+					err = vm.Run()
+					assert.Error(t, err)
+					errs = append(errs, fmt.Sprint(err))
+					assert.Equal(t, uint8(18), vm.Microstate().State)
+				}
+				assert.Equal(t, errs[0], errs[1])
+			})
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package lc3
+
+// Object is a separately assembled module: sections of code and data at
+// fixed origins, the symbols it defines or references, and the relocations
+// that must be patched once external symbols are resolved. Lines optionally
+// maps addresses back to the source they were assembled from.
+type Object struct {
+	Entry       uint16
+	HasEntry    bool
+	Sections    []Section
+	Symbols     []Symbol
+	Relocations []Relocation
+	Lines       []LineInfo
+}
+
+// EntryPoint returns where execution of the object starts: its entry point,
+// else the origin of its first section. ok is false when it has neither.
+func (o *Object) EntryPoint() (address uint16, ok bool) {
+	switch {
+	case o.HasEntry:
+		return o.Entry, true
+	case len(o.Sections) > 0:
+		return o.Sections[0].Origin, true
+	}
+	return 0, false
+}
+
+// Section is a named segment of an object.
+type Section struct {
+	Name   string
+	Origin uint16
+	Words  []uint16
+}
+
+// SymbolKind tells whether a symbol is private to its object, exported to
+// other objects, or expected to be defined by another object.
+type SymbolKind uint8
+
+const (
+	SymbolLocal SymbolKind = iota
+	SymbolGlobal
+	SymbolExternal
+)
+
+// Symbol names an address. External symbols have no meaningful address.
+type Symbol struct {
+	Name    string
+	Address uint16
+	Kind    SymbolKind
+}
+
+// RelocationType describes which bits of a word refer to a symbol.
+type RelocationType uint8
+
+const (
+	// RelocationAbsolute adds the symbol address to the whole word (e.g.
+	// `.FILL LABEL`, or `.FILL LABEL+2` with an addend of 2).
+	RelocationAbsolute RelocationType = iota
+	// RelocationPCOffset9 patches a PC-relative 9 bits offset (BR, LD, LDI,
+	// LEA, ST, STI).
+	RelocationPCOffset9
+	// RelocationPCOffset11 patches a PC-relative 11 bits offset (JSR).
+	RelocationPCOffset11
+)
+
+// Relocation asks the linker to patch the word at Offset within Section with
+// the address of Symbol. The bits already in the patched field are an addend.
+type Relocation struct {
+	Section int
+	Offset  uint16
+	Type    RelocationType
+	Symbol  string
+}
+
+// ObjectFromSegment wraps a segment, e.g. read from a legacy .obj file, as an
+// object with its origin as entry point.
+func ObjectFromSegment(seg Segment) *Object {
+	return &Object{
+		Entry:    seg.Origin,
+		HasEntry: true,
+		Sections: []Section{{Name: ".text", Origin: seg.Origin, Words: seg.Words}},
+	}
+}
+
+// Segments returns the sections of the object as segments to load.
+func (o *Object) Segments() []Segment {
+	segments := make([]Segment, 0, len(o.Sections))
+	for _, section := range o.Sections {
+		segments = append(segments, Segment{Origin: section.Origin, Words: section.Words})
+	}
+	return segments
+}
+
+// Lookup returns the address of a symbol defined by the object.
+func (o *Object) Lookup(name string) (uint16, bool) {
+	for _, sym := range o.Symbols {
+		if sym.Name == name && sym.Kind != SymbolExternal {
+			return sym.Address, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,287 @@
+package lc3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ObjectMagic starts every file in the relocatable object format. ReadProgram
+// reads any file starting with it as an object, so a legacy .obj with origin
+// x7F4C and x4333 as its first word, an unlikely start for a program, can't
+// be read by it.
+const ObjectMagic = "\x7fLC3"
+
+const objectVersion = 1
+
+const objectFlagEntry = uint16(1 << 0)
+
+// LineInfo maps the word at Address to the source line it was assembled from.
+type LineInfo struct {
+	Address uint16
+	File    string
+	Line    int
+}
+
+// The object file format is big-endian, like the legacy format:
+//
+//	header:      magic [4]byte, version, flags, entry,
+//	             #sections, #symbols, #relocations, #files, #lines
+//	section:     name, origin, length, words [length]uint16
+//	symbol:      name, kind uint8, address
+//	relocation:  section, offset, type uint8, symbol name
+//	file:        name
+//	line:        address, file index, line
+//
+// All unlabeled fields are uint16 and strings are a uint16 length followed by
+// that many bytes.
+
+type objectHeader struct {
+	Version     uint16
+	Flags       uint16
+	Entry       uint16
+	Sections    uint16
+	Symbols     uint16
+	Relocations uint16
+	Files       uint16
+	Lines       uint16
+}
+
+// WriteObject encodes obj in the relocatable object format.
+func WriteObject(w io.Writer, obj *Object) error {
+	var files []string
+	fileIndex := map[string]uint16{}
+	for _, line := range obj.Lines {
+		if _, ok := fileIndex[line.File]; !ok {
+			fileIndex[line.File] = uint16(len(files))
+			files = append(files, line.File)
+		}
+	}
+
+	if err := checkCounts(obj, len(files)); err != nil {
+		return err
+	}
+
+	header := objectHeader{
+		Version:     objectVersion,
+		Entry:       obj.Entry,
+		Sections:    uint16(len(obj.Sections)),
+		Symbols:     uint16(len(obj.Symbols)),
+		Relocations: uint16(len(obj.Relocations)),
+		Files:       uint16(len(files)),
+		Lines:       uint16(len(obj.Lines)),
+	}
+	if obj.HasEntry {
+		header.Flags |= objectFlagEntry
+	}
+
+	enc := &objectEncoder{w: bufio.NewWriter(w)}
+	enc.w.WriteString(ObjectMagic)
+	enc.put(header)
+	for _, section := range obj.Sections {
+		enc.putString(section.Name)
+		enc.put(section.Origin)
+		enc.put(uint16(len(section.Words)))
+		enc.put(section.Words)
+	}
+	for _, sym := range obj.Symbols {
+		enc.putString(sym.Name)
+		enc.put(uint8(sym.Kind))
+		enc.put(sym.Address)
+	}
+	for _, reloc := range obj.Relocations {
+		enc.put(uint16(reloc.Section))
+		enc.put(reloc.Offset)
+		enc.put(uint8(reloc.Type))
+		enc.putString(reloc.Symbol)
+	}
+	for _, file := range files {
+		enc.putString(file)
+	}
+	for _, line := range obj.Lines {
+		enc.put(line.Address)
+		enc.put(fileIndex[line.File])
+		enc.put(uint16(line.Line))
+	}
+
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+// checkCounts checks that the counts, section numbers and line numbers of
+// obj fit their uint16 fields rather than wrapping.
+func checkCounts(obj *Object, files int) error {
+	tooMany := func(what string, n int) error {
+		if n > 0xffff {
+			return fmt.Errorf("too many %s: %d", what, n)
+		}
+		return nil
+	}
+	err := errors.Join(
+		tooMany("sections", len(obj.Sections)),
+		tooMany("symbols", len(obj.Symbols)),
+		tooMany("relocations", len(obj.Relocations)),
+		tooMany("files", files),
+		tooMany("lines", len(obj.Lines)),
+	)
+	if err != nil {
+		return err
+	}
+	for _, section := range obj.Sections {
+		if err := tooMany(fmt.Sprintf("words in section %q", section.Name), len(section.Words)); err != nil {
+			return err
+		}
+	}
+	for _, reloc := range obj.Relocations {
+		if reloc.Section < 0 || reloc.Section > 0xffff {
+			return fmt.Errorf("relocation of %q: invalid section %d", reloc.Symbol, reloc.Section)
+		}
+	}
+	for _, line := range obj.Lines {
+		if line.Line < 0 || line.Line > 0xffff {
+			return fmt.Errorf("%s: line %d out of range", line.File, line.Line)
+		}
+	}
+	return nil
+}
+
+type objectEncoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *objectEncoder) put(data any) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, data)
+	}
+}
+
+func (e *objectEncoder) putString(s string) {
+	if len(s) > 0xffff && e.err == nil {
+		e.err = fmt.Errorf("string too long: %d bytes", len(s))
+	}
+	e.put(uint16(len(s)))
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+// ReadObject decodes an object in the relocatable object format.
+func ReadObject(r io.Reader) (*Object, error) {
+	var magic [len(ObjectMagic)]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("reading object magic: %v", err)
+	}
+	if string(magic[:]) != ObjectMagic {
+		return nil, errors.New("not an object file: bad magic")
+	}
+
+	dec := &objectDecoder{r: r}
+	var header objectHeader
+	dec.get("header", &header)
+	if dec.err == nil && header.Version != objectVersion {
+		return nil, fmt.Errorf("unsupported object version %d", header.Version)
+	}
+
+	obj := &Object{Entry: header.Entry, HasEntry: header.Flags&objectFlagEntry != 0}
+	for i := 0; i < int(header.Sections) && dec.err == nil; i++ {
+		var section Section
+		var length uint16
+		section.Name = dec.getString("section name")
+		dec.get("section origin", &section.Origin)
+		dec.get("section length", &length)
+		if dec.err == nil && int(section.Origin)+int(length) > MemorySize {
+			return nil, fmt.Errorf("section %q at x%04X: %d words overflow memory", section.Name, section.Origin, length)
+		}
+		section.Words = make([]uint16, length)
+		dec.get("section words", section.Words)
+		obj.Sections = append(obj.Sections, section)
+	}
+	for i := 0; i < int(header.Symbols) && dec.err == nil; i++ {
+		var sym Symbol
+		sym.Name = dec.getString("symbol name")
+		dec.get("symbol kind", &sym.Kind)
+		dec.get("symbol address", &sym.Address)
+		obj.Symbols = append(obj.Symbols, sym)
+	}
+	for i := 0; i < int(header.Relocations) && dec.err == nil; i++ {
+		var reloc Relocation
+		var section uint16
+		dec.get("relocation section", &section)
+		dec.get("relocation offset", &reloc.Offset)
+		dec.get("relocation type", &reloc.Type)
+		reloc.Symbol = dec.getString("relocation symbol")
+		reloc.Section = int(section)
+		obj.Relocations = append(obj.Relocations, reloc)
+	}
+	var files []string
+	for i := 0; i < int(header.Files) && dec.err == nil; i++ {
+		files = append(files, dec.getString("file name"))
+	}
+	for i := 0; i < int(header.Lines) && dec.err == nil; i++ {
+		var address, file, line uint16
+		dec.get("line address", &address)
+		dec.get("line file", &file)
+		dec.get("line number", &line)
+		if dec.err == nil && int(file) >= len(files) {
+			return nil, fmt.Errorf("line info for x%04X: invalid file index %d", address, file)
+		}
+		if dec.err == nil {
+			obj.Lines = append(obj.Lines, LineInfo{Address: address, File: files[file], Line: int(line)})
+		}
+	}
+
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	return obj, nil
+}
+
+type objectDecoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *objectDecoder) get(what string, data any) {
+	if d.err != nil {
+		return
+	}
+	if err := binary.Read(d.r, binary.BigEndian, data); err != nil {
+		d.err = fmt.Errorf("reading %s: %v", what, err)
+	}
+}
+
+func (d *objectDecoder) getString(what string) string {
+	var length uint16
+	d.get(what, &length)
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = fmt.Errorf("reading %s: %v", what, err)
+		return ""
+	}
+	return string(buf)
+}
+
+// ReadProgram reads a program in either the relocatable object format or the
+// legacy .obj format, telling them apart by ObjectMagic.
+func ReadProgram(program io.Reader) (*Object, error) {
+	reader := bufio.NewReader(program)
+	magic, err := reader.Peek(len(ObjectMagic))
+	if err == nil && bytes.Equal(magic, []byte(ObjectMagic)) {
+		return ReadObject(reader)
+	}
+
+	seg, err := ReadSegment(reader)
+	if err != nil {
+		return nil, err
+	}
+	return ObjectFromSegment(seg), nil
+}
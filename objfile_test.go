@@ -0,0 +1,97 @@
+package lc3_test
+
+import (
+	"bytes"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectFile(t *testing.T) {
+	hello := &lc3.Object{
+		Entry: 0x3000, HasEntry: true,
+		Sections: []lc3.Section{
+			// LEA R0, MESSAGE; PUTS; HALT
+			{Name: ".text", Origin: 0x3000, Words: []uint16{0xe000, 0xf022, 0xf025}},
+			{Name: ".data", Origin: 0x3010, Words: []uint16{'h', 'i', 0}},
+		},
+		Symbols:     []lc3.Symbol{{Name: "MESSAGE", Address: 0x3010, Kind: lc3.SymbolLocal}},
+		Relocations: []lc3.Relocation{{Section: 0, Offset: 0, Type: lc3.RelocationPCOffset9, Symbol: "MESSAGE"}},
+		Lines: []lc3.LineInfo{
+			{Address: 0x3000, File: "hello.asm", Line: 2},
+			{Address: 0x3001, File: "hello.asm", Line: 3},
+			{Address: 0x3010, File: "data.asm", Line: 1},
+		},
+	}
+
+	t.Run("encode and decode an object", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		assert.NoError(t, lc3.WriteObject(buf, hello))
+		assert.Equal(t, lc3.ObjectMagic, buf.String()[:4])
+
+		obj, err := lc3.ReadObject(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, hello, obj)
+	})
+
+	t.Run("run an object with local relocations", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		assert.NoError(t, lc3.WriteObject(buf, hello))
+
+		output := bytes.NewBuffer([]byte{})
+		vm, err := lc3.NewVM(buf, nil, output)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, "hi", output.String())
+	})
+
+	t.Run("refuse to run an object with external references", func(t *testing.T) {
+		obj := &lc3.Object{
+			Sections:    []lc3.Section{{Origin: 0x3000, Words: []uint16{0x4800}}},
+			Symbols:     []lc3.Symbol{{Name: "EXTERN", Kind: lc3.SymbolExternal}},
+			Relocations: []lc3.Relocation{{Type: lc3.RelocationPCOffset11, Symbol: "EXTERN"}},
+		}
+		buf := bytes.NewBuffer([]byte{})
+		assert.NoError(t, lc3.WriteObject(buf, obj))
+
+		_, err := lc3.NewVM(buf, nil, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("refuse to write counts that don't fit", func(t *testing.T) {
+		testCases := []*lc3.Object{
+			{Symbols: make([]lc3.Symbol, 0x10000)},
+			{Sections: []lc3.Section{{Name: ".text", Words: make([]uint16, 0x10000)}}},
+			{Relocations: []lc3.Relocation{{Section: 0x10000}}},
+			{Lines: []lc3.LineInfo{{File: "long.asm", Line: 0x10000}}},
+		}
+		for _, obj := range testCases {
+			assert.Error(t, lc3.WriteObject(bytes.NewBuffer([]byte{}), obj))
+		}
+
+		obj := &lc3.Object{Sections: []lc3.Section{{Name: ".text", Words: make([]uint16, 0xffff)}}}
+		assert.NoError(t, lc3.WriteObject(bytes.NewBuffer([]byte{}), obj))
+	})
+
+	t.Run("reject truncated objects", func(t *testing.T) {
+		buf := bytes.NewBuffer([]byte{})
+		assert.NoError(t, lc3.WriteObject(buf, hello))
+
+		for _, size := range []int{4, 10, buf.Len() - 1} {
+			_, err := lc3.ReadObject(bytes.NewReader(buf.Bytes()[:size]))
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("detect the legacy format", func(t *testing.T) {
+		f, closer := openTestfile(t, "testdata/loop.obj")
+		defer closer()
+
+		obj, err := lc3.ReadProgram(f)
+		assert.NoError(t, err)
+		assert.True(t, obj.HasEntry)
+		assert.Equal(t, uint16(0x3000), obj.Entry)
+		assert.Len(t, obj.Sections, 1)
+	})
+}
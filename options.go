@@ -0,0 +1,218 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultPC is where execution starts when nothing sets PC, the start of
+// user memory.
+const DefaultPC = uint16(0x3000)
+
+// Option configures a VM created by New.
+type Option func(o *options)
+
+type options struct {
+	input      io.Reader
+	output     io.Writer
+	overflow   OverflowPolicy
+	protection Protection
+	sanitizer  CheckMode
+	codeGuard  CheckMode
+	stackGuard CheckMode
+	stack      Stack
+	engine     Engine
+	traps      map[uint8]TrapHandler
+	devices    map[uint16]Device
+	tracers    []Tracer
+	// dataRegions must not be executed, with the code guard.
+	dataRegions []DataRegion
+	// microTracers are called after each cycle of the microcode engine.
+	microTracers []MicroTracer
+	// setup changes the VM state once it is configured, in the order the
+	// options were given.
+	setup []func(v *VM) error
+}
+
+// WithInput sets the reader used by GETC and the keyboard registers. By
+// default, there is no input.
+func WithInput(input io.Reader) Option {
+	return func(o *options) { o.input = input }
+}
+
+// WithOutput sets the writer used by OUT and PUTS. By default, output is
+// discarded.
+func WithOutput(output io.Writer) Option {
+	return func(o *options) { o.output = output }
+}
+
+// WithProgram loads a program, in any format ReadProgram understands, and
+// sets PC to its entry point.
+func WithProgram(program io.Reader) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error { return v.Load(program) })
+	}
+}
+
+// WithObject loads an object and sets PC to its entry point.
+func WithObject(obj *Object) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error { return v.LoadObject(obj) })
+	}
+}
+
+// WithSegments loads segments, without changing PC.
+func WithSegments(segments ...Segment) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			_, err := v.LoadSegments(segments...)
+			return err
+		})
+	}
+}
+
+// WithPC sets the initial PC, overriding the entry point of programs loaded
+// by earlier options.
+func WithPC(pc uint16) Option {
+	return WithRegister(RegisterPC, pc)
+}
+
+// WithRegister sets the initial value of a register.
+func WithRegister(reg Register, value uint16) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			if reg >= RegisterCOUNT {
+				return fmt.Errorf("invalid register %d", reg)
+			}
+			v.SetRegister(reg, value)
+			return nil
+		})
+	}
+}
+
+// WithMemory sets the initial content of memory starting at address.
+func WithMemory(address uint16, words ...uint16) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			for i, word := range words {
+				v.SetMemory(address+uint16(i), word)
+			}
+			return nil
+		})
+	}
+}
+
+// WithOverflowPolicy sets how loading handles programs overflowing user
+// memory.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) { o.overflow = policy }
+}
+
+// WithTrapHandler implements a trap vector in Go, replacing the built-in
+// handler if any.
+func WithTrapHandler(vector uint8, handler TrapHandler) Option {
+	return func(o *options) { o.traps[vector] = handler }
+}
+
+// WithDevice attaches a device to the given memory-mapped addresses, which
+// must be in the device registers space (xFE00-xFFFF), replacing the built-in
+// keyboard device if needed.
+func WithDevice(device Device, addresses ...uint16) Option {
+	return func(o *options) {
+		for _, address := range addresses {
+			o.devices[address] = device
+		}
+	}
+}
+
+// WithTracer adds a tracer called after each executed instruction.
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) { o.tracers = append(o.tracers, tracer) }
+}
+
+// New creates a VM configured by opts. Without any program option, memory is
+// empty and PC is DefaultPC, so code can be loaded later.
+func New(opts ...Option) (*VM, error) {
+	vm := &VM{state: StateRunning}
+	o := &options{
+		input:   strings.NewReader(""),
+		output:  io.Discard,
+		traps:   defaultTrapHandlers(),
+		devices: map[uint16]Device{},
+	}
+	keyboard := &keyboard{vm: vm}
+	o.devices[MemoryKBSR], o.devices[MemoryKBDR] = keyboard, keyboard
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	for address := range o.devices {
+		if address <= UserMemoryLimit {
+			return nil, fmt.Errorf("device at x%04X is outside of the device registers space", address)
+		}
+	}
+
+	vm.input = bufio.NewReader(o.input)
+	vm.output = o.output
+	vm.overflow = o.overflow
+	vm.traps = o.traps
+	vm.devices = o.devices
+	vm.tracers = o.tracers
+	vm.microTracers = o.microTracers
+	vm.protection = o.protection
+	vm.engine = o.engine
+	vm.psr = PSRUser
+	vm.savedSSP = DefaultSupervisorStack
+	vm.registers[RegisterPC] = DefaultPC
+	vm.registers[RegisterCOND] = FlagZ
+	if o.sanitizer != CheckOff {
+		vm.shadow = newShadow(o.sanitizer)
+	}
+	if o.codeGuard != CheckOff {
+		vm.codeGuard = newCodeGuard(o.codeGuard, o.dataRegions)
+	}
+	if o.stackGuard != CheckOff {
+		vm.stackGuard = &stackGuard{mode: o.stackGuard, stack: o.stack}
+	}
+
+	for _, setup := range o.setup {
+		if err := setup(vm); err != nil {
+			return nil, err
+		}
+	}
+	vm.updateSlow()
+	return vm, nil
+}
+
+// Load loads a program, in any format ReadProgram understands, and sets PC to
+// its entry point.
+func (v *VM) Load(program io.Reader) error {
+	obj, err := ReadProgram(program)
+	if err != nil {
+		return err
+	}
+	return v.LoadObject(obj)
+}
+
+// LoadObject loads an object and sets PC to its entry point, or to the origin
+// of its first section if it has none. Relocations are resolved against the
+// object's own symbols, which become labels for CallLabel.
+func (v *VM) LoadObject(obj *Object) error {
+	if len(obj.Relocations) > 0 {
+		var err error
+		if obj, err = Link(obj); err != nil {
+			return fmt.Errorf("program needs linking: %v", err)
+		}
+	}
+	if _, err := v.LoadSegments(obj.Segments()...); err != nil {
+		return err
+	}
+	v.AddSymbols(obj.Symbols...)
+
+	if entry, ok := obj.EntryPoint(); ok {
+		v.SetRegister(RegisterPC, entry)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package lc3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	t.Run("create a VM without a program and load it later", func(t *testing.T) {
+		vm, err := lc3.New()
+		assert.NoError(t, err)
+		assert.Equal(t, lc3.DefaultPC, vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, lc3.FlagZ, vm.GetRegister(lc3.RegisterCOND))
+
+		f, closer := openTestfile(t, "testdata/loop.obj")
+		defer closer()
+		assert.NoError(t, vm.Load(f))
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, uint16(10), vm.GetRegister(lc3.RegisterR0))
+	})
+
+	t.Run("set initial registers and memory", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithProgram(strings.NewReader("\x30\x00\xf0\x25")),
+			lc3.WithMemory(0x4000, 0x1021, 0xf025), // ADD R0, R0, #1; HALT
+			lc3.WithRegister(lc3.RegisterR0, 41),
+			lc3.WithPC(0x4000),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, uint16(42), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, uint16(0x4002), vm.GetRegister(lc3.RegisterPC))
+
+		_, err = lc3.New(lc3.WithRegister(lc3.RegisterCOUNT, 0))
+		assert.Error(t, err)
+	})
+
+	t.Run("default to no input and discarded output", func(t *testing.T) {
+		// OUT; GETC
+		vm, err := lc3.New(lc3.WithMemory(0x3000, 0xf021, 0xf020))
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Step())
+		assert.Error(t, vm.Step())
+	})
+
+	t.Run("replace and add trap handlers", func(t *testing.T) {
+		output := bytes.NewBuffer([]byte{})
+		vm, err := lc3.New(
+			lc3.WithOutput(output),
+			// TRAP x30; HALT
+			lc3.WithMemory(0x3000, 0xf030, 0xf025),
+			lc3.WithTrapHandler(0x30, func(v *lc3.VM) error {
+				v.SetRegister(lc3.RegisterR1, 0xbeef)
+				return nil
+			}),
+			lc3.WithTrapHandler(lc3.TrapHALT, func(v *lc3.VM) error {
+				output.WriteString("bye")
+				v.Halt()
+				return nil
+			}),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, uint16(0xbeef), vm.GetRegister(lc3.RegisterR1))
+		assert.Equal(t, "bye", output.String())
+		assert.Equal(t, lc3.StateHalted, vm.State())
+	})
+
+	t.Run("trap handlers see PC on the TRAP in every engine", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineJIT, lc3.EngineMicrocode} {
+			var pc uint16
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				// TRAP x30; HALT; HALT
+				lc3.WithMemory(0x3000, 0xf030, 0xf025, 0xf025),
+				lc3.WithTrapHandler(0x30, func(v *lc3.VM) error {
+					pc = v.GetRegister(lc3.RegisterPC)
+					// Skip the next instruction.
+					v.SetRegister(lc3.RegisterPC, pc+1)
+					return nil
+				}),
+			)
+			assert.NoError(t, err)
+			assert.NoError(t, vm.Step())
+			assert.Equal(t, uint16(0x3000), pc, "engine %v", engine)
+			assert.Equal(t, uint16(0x3002), vm.GetRegister(lc3.RegisterPC), "engine %v", engine)
+		}
+	})
+
+	t.Run("attach a device", func(t *testing.T) {
+		device := &counterDevice{}
+		vm, err := lc3.New(
+			// LDI R0, x3003; STI R0, x3004; HALT; .FILL xFE10; .FILL xFE12
+			lc3.WithMemory(0x3000, 0xa002, 0xb002, 0xf025, 0xfe10, 0xfe12),
+			lc3.WithDevice(device, 0xfe10, 0xfe12),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR0))
+		assert.Equal(t, []uint16{0xfe12, 1}, device.written)
+	})
+
+	t.Run("trace executed instructions", func(t *testing.T) {
+		f, closer := openTestfile(t, "testdata/loop.obj")
+		defer closer()
+
+		trace := bytes.NewBuffer([]byte{})
+		var pcs []uint16
+		vm, err := lc3.New(
+			lc3.WithProgram(f),
+			lc3.WithTracer(lc3.NewTextTracer(trace)),
+			lc3.WithTracer(lc3.TracerFunc(func(v *lc3.VM, pc uint16, inst uint16) {
+				pcs = append(pcs, pc)
+			})),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Run())
+
+		lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+		assert.Len(t, lines, len(pcs))
+		assert.Equal(t, uint16(0x3000), pcs[0])
+		assert.Equal(t, uint16(0x3004), pcs[len(pcs)-1])
+		assert.Contains(t, lines[0], "x3000  5020  AND R0, R0, #0")
+		assert.Contains(t, lines[3], "BRn x3001")
+		assert.Contains(t, lines[len(lines)-1], "HALT")
+	})
+}
+
+func TestDisassemble(t *testing.T) {
+	testCases := []struct {
+		inst uint16
+		want string
+	}{
+		{0x0000, "NOP"},
+		{0x0e02, "BRnzp x3003"},
+		{0x09fd, "BRn x2FFE"},
+		{0x1021, "ADD R0, R0, #1"},
+		{0x1b35, "ADD R5, R4, #-11"},
+		{0x5647, "AND R3, R1, R7"},
+		{0x5648, ".FILL x5648"},
+		{0xe002, "LEA R0, x3003"},
+		{0x6841, "LDR R4, R1, #1"},
+		{0x7e3f, "STR R7, R0, #-1"},
+		{0x903f, "NOT R0, R0"},
+		{0x9000, ".FILL x9000"},
+		{0xc1c0, "RET"},
+		{0xc080, "JMP R2"},
+		{0x4801, "JSR x3002"},
+		{0x4040, "JSRR R1"},
+		{0xf022, "PUTS"},
+		{0xf030, "TRAP x30"},
+		{0x8000, "RTI"},
+		{0xd000, ".FILL xD000"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.want, lc3.Disassemble(0x3000, test.inst))
+	}
+}
+
+// counterDevice returns how many times it was read, and records writes.
+type counterDevice struct {
+	reads   uint16
+	written []uint16
+}
+
+func (d *counterDevice) Read(address uint16) (uint16, error) {
+	d.reads++
+	return d.reads, nil
+}
+
+func (d *counterDevice) Write(address uint16, value uint16) error {
+	d.written = append(d.written, address, value)
+	return nil
+}
@@ -0,0 +1,177 @@
+package lc3
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read
+// by `go tool pprof`. Each sample is the calling context of an address, with
+// the number of instructions and cycles executed there. Functions are the
+// subroutines, named after symbols.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := &pprofBuilder{strings: map[string]int64{"": 0}, stringTable: []string{""},
+		locations: map[uint32]uint64{}, functions: map[uint16]uint64{}}
+
+	var profile protoBuffer
+	for _, sampleType := range [][2]string{{"instructions", "count"}, {"cycles", "count"}} {
+		var vt protoBuffer
+		vt.int64Field(1, b.str(sampleType[0]))
+		vt.int64Field(2, b.str(sampleType[1]))
+		profile.bytesField(1, vt.Bytes())
+	}
+
+	if p.root != nil {
+		var nodes []*callNode
+		p.root.walk(func(n *callNode) { nodes = append(nodes, n) })
+		for _, n := range nodes {
+			pcs := make([]uint16, 0, len(n.counts))
+			for pc := range n.counts {
+				pcs = append(pcs, pc)
+			}
+			sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+
+			for _, pc := range pcs {
+				// The leaf is the address, callers are the call sites.
+				ids := []uint64{b.location(p, pc, n.entry)}
+				for c := n; c.parent != nil; c = c.parent {
+					ids = append(ids, b.location(p, c.callSite, c.parent.entry))
+				}
+				count := n.counts[pc]
+
+				var sample protoBuffer
+				sample.packedField(1, ids)
+				sample.packedField(2, []uint64{count[0], count[1]})
+				profile.bytesField(2, sample.Bytes())
+			}
+		}
+	}
+
+	var period protoBuffer
+	period.int64Field(1, b.str("instructions"))
+	period.int64Field(2, b.str("count"))
+	profile.bytesField(11, period.Bytes())
+	profile.int64Field(12, 1)
+	profile.int64Field(14, b.str("instructions"))
+
+	// Locations, functions and strings come last, once interned.
+	profile.Write(b.locationBytes.Bytes())
+	profile.Write(b.functionBytes.Bytes())
+	for _, s := range b.stringTable {
+		profile.bytesField(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// pprofBuilder interns strings, locations and functions of a profile.
+type pprofBuilder struct {
+	strings     map[string]int64
+	stringTable []string
+	// locations are keyed by address and subroutine entry.
+	locations     map[uint32]uint64
+	functions     map[uint16]uint64
+	locationBytes protoBuffer
+	functionBytes protoBuffer
+}
+
+func (b *pprofBuilder) str(s string) int64 {
+	if id, ok := b.strings[s]; ok {
+		return id
+	}
+	id := int64(len(b.stringTable))
+	b.strings[s] = id
+	b.stringTable = append(b.stringTable, s)
+	return id
+}
+
+func (b *pprofBuilder) function(p *Profiler, entry uint16) uint64 {
+	if id, ok := b.functions[entry]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	b.functions[entry] = id
+
+	var fn protoBuffer
+	fn.uint64Field(1, id)
+	fn.int64Field(2, b.str(p.symbols.Name(entry)))
+	fn.int64Field(3, b.str(p.symbols.Name(entry)))
+	b.functionBytes.bytesField(5, fn.Bytes())
+	return id
+}
+
+func (b *pprofBuilder) location(p *Profiler, pc, entry uint16) uint64 {
+	key := uint32(pc)<<16 | uint32(entry)
+	if id, ok := b.locations[key]; ok {
+		return id
+	}
+	id := uint64(len(b.locations) + 1)
+	b.locations[key] = id
+
+	var line protoBuffer
+	line.uint64Field(1, b.function(p, entry))
+	// Lines are offsets from the entry. Addresses before it, reached by
+	// branching back, have none.
+	if offset := int(pc) - int(entry); offset > 0 {
+		line.int64Field(2, int64(offset))
+	}
+	var loc protoBuffer
+	loc.uint64Field(1, id)
+	loc.uint64Field(3, uint64(pc))
+	loc.bytesField(4, line.Bytes())
+	b.locationBytes.bytesField(4, loc.Bytes())
+	return id
+}
+
+// protoBuffer encodes protocol buffer fields.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) Bytes() []byte {
+	return b.buf
+}
+
+func (b *protoBuffer) Write(p []byte) {
+	b.buf = append(b.buf, p...)
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	b.buf = binary.AppendUvarint(b.buf, x)
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.tag(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+func (b *protoBuffer) bytesField(field int, p []byte) {
+	b.tag(field, 2)
+	b.varint(uint64(len(p)))
+	b.Write(p)
+}
+
+func (b *protoBuffer) packedField(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(field, packed.Bytes())
+}
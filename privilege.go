@@ -0,0 +1,291 @@
+package lc3
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// UserMemoryStart is the first address user mode code may access; below
+	// it is system space.
+	UserMemoryStart = uint16(0x3000)
+
+	// MemoryInterruptVectors is the table of exception and interrupt handler
+	// addresses.
+	MemoryInterruptVectors = uint16(0x0100)
+
+	// DefaultSupervisorStack is the initial supervisor stack pointer, growing
+	// down into system space.
+	DefaultSupervisorStack = uint16(0x3000)
+)
+
+const (
+	PSRUser = uint16(1 << 15)
+
+	psrPriorityShift = 8
+	psrPriorityMask  = uint16(0x7 << psrPriorityShift)
+)
+
+const (
+	ExceptionPrivilege     = uint8(0x00)
+	ExceptionIllegalOpcode = uint8(0x01)
+	ExceptionACV           = uint8(0x02)
+)
+
+// Protection tells how user mode accesses outside of user memory are handled.
+type Protection uint8
+
+const (
+	// ProtectionOff doesn't check memory accesses.
+	ProtectionOff Protection = iota
+	// ProtectionError makes Step return an AccessViolationError.
+	ProtectionError
+	// ProtectionException raises an ACV exception, handled by the operating
+	// system through interrupt vector x02. Privilege mode violations and
+	// illegal opcodes are raised as exceptions too.
+	ProtectionException
+)
+
+// AccessViolationError reports a user mode access to system space or device
+// registers.
+type AccessViolationError struct {
+	PC      uint16
+	Address uint16
+	Write   bool
+}
+
+func (e *AccessViolationError) Error() string {
+	access := "read"
+	if e.Write {
+		access = "write"
+	}
+	return fmt.Sprintf("access control violation at x%04X: user mode %s of x%04X", e.PC, access, e.Address)
+}
+
+// ErrPrivilegeViolation is returned when RTI is executed in user mode and
+// exceptions aren't enabled.
+var ErrPrivilegeViolation = errors.New("privilege mode violation: RTI in user mode")
+
+// WithMemoryProtection enables access control checks for user mode code.
+func WithMemoryProtection(protection Protection) Option {
+	return func(o *options) { o.protection = protection }
+}
+
+// WithSupervisorMode starts the VM in supervisor mode, e.g. to run operating
+// system code that later drops to user mode with RTI.
+func WithSupervisorMode() Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			v.psr &^= PSRUser
+			return nil
+		})
+	}
+}
+
+// WithSupervisorStack sets the supervisor stack pointer used when entering
+// supervisor mode from user mode.
+func WithSupervisorStack(sp uint16) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			v.savedSSP = sp
+			return nil
+		})
+	}
+}
+
+// PSR returns the processor status register: privilege mode, priority level
+// and condition codes.
+func (v *VM) PSR() uint16 {
+	return v.psr&(PSRUser|psrPriorityMask) | v.GetRegister(RegisterCOND)&0x7
+}
+
+// Privileged tells whether the VM is in supervisor mode.
+func (v *VM) Privileged() bool {
+	return v.psr&PSRUser == 0
+}
+
+func (v *VM) setPSR(psr uint16) {
+	v.psr = psr & (PSRUser | psrPriorityMask)
+	v.SetRegister(RegisterCOND, psr&0x7)
+	v.checkInterrupts()
+}
+
+// setPriority sets the priority level of the PSR.
+func (v *VM) setPriority(priority uint8) {
+	v.psr = v.psr&^psrPriorityMask | uint16(priority)<<psrPriorityShift
+	v.checkInterrupts()
+}
+
+func (v *VM) checkAccess(address uint16, write bool) error {
+	if v.protection == ProtectionOff || v.Privileged() {
+		return nil
+	}
+	if address < UserMemoryStart || address > UserMemoryLimit {
+		return &AccessViolationError{PC: v.GetRegister(RegisterPC), Address: address, Write: write}
+	}
+	return nil
+}
+
+// readMemory loads a value on behalf of an instruction, checking access
+// control.
+func (v *VM) readMemory(address uint16) (uint16, error) {
+	if err := v.checkAccess(address, false); err != nil {
+		return 0, err
+	}
+	v.memoryAccess(address)
+	return v.GetMemory(address)
+}
+
+// raiseException enters supervisor mode and jumps to the handler of vector,
+// saving PSR and the return address on the supervisor stack.
+func (v *VM) raiseException(vector uint8, returnPC uint16) error {
+	psr := v.PSR()
+	if !v.Privileged() {
+		v.savedUSP = v.GetRegister(RegisterR6)
+		v.SetRegister(RegisterR6, v.savedSSP)
+	}
+	v.psr &^= PSRUser
+
+	for _, value := range []uint16{psr, returnPC} {
+		sp := v.GetRegister(RegisterR6) - 1
+		v.SetRegister(RegisterR6, sp)
+		if err := v.writeMemory(sp, value); err != nil {
+			return err
+		}
+	}
+
+	v.memoryAccess(MemoryInterruptVectors + uint16(vector))
+	handler, err := v.GetMemory(MemoryInterruptVectors + uint16(vector))
+	if err != nil {
+		return err
+	}
+	v.SetRegister(RegisterPC, handler)
+	return nil
+}
+
+// handleException turns errors of the instruction at pc into exceptions when
+// they are enabled. It returns whether an exception was raised.
+func (v *VM) handleException(pc uint16, err error) (bool, error) {
+	if v.protection != ProtectionException {
+		return false, err
+	}
+
+	var acv *AccessViolationError
+	var illegal *illegalOpcodeError
+	switch {
+	case errors.As(err, &acv):
+		return true, v.raiseException(ExceptionACV, pc+1)
+	case errors.As(err, &illegal):
+		return true, v.raiseException(ExceptionIllegalOpcode, pc+1)
+	case errors.Is(err, ErrPrivilegeViolation):
+		return true, v.raiseException(ExceptionPrivilege, pc+1)
+	}
+	return false, err
+}
+
+// interruptRequest is an interrupt waiting for the priority level to drop
+// below its own.
+type interruptRequest struct {
+	vector   uint8
+	priority uint8
+}
+
+// RequestInterrupt asserts an interrupt, serviced before the next instruction
+// once priority is above the current priority level: PSR and PC are pushed on
+// the supervisor stack, the priority level is raised to priority and
+// execution continues at the handler in the interrupt vector table, e.g.
+// x0180 for the keyboard vector x80. Devices use it from scheduled events.
+func (v *VM) RequestInterrupt(vector uint8, priority uint8) error {
+	if priority > 7 {
+		return fmt.Errorf("invalid interrupt priority %d", priority)
+	}
+	v.interrupts = append(v.interrupts, interruptRequest{vector: vector, priority: priority})
+	v.checkInterrupts()
+	return nil
+}
+
+// serviceInterrupt initiates the highest priority pending interrupt, if it is
+// above the current priority level.
+func (v *VM) serviceInterrupt() error {
+	irq, ok := v.takeInterrupt()
+	if !ok {
+		return nil
+	}
+
+	if err := v.raiseException(irq.vector, v.registers[RegisterPC]); err != nil {
+		return err
+	}
+	v.setPriority(irq.priority)
+	if v.timing != nil {
+		v.chargeException()
+	}
+	return nil
+}
+
+// takeInterrupt removes and returns the highest priority pending interrupt
+// above the current priority level, if any.
+func (v *VM) takeInterrupt() (interruptRequest, bool) {
+	level := uint8((v.psr & psrPriorityMask) >> psrPriorityShift)
+	next := -1
+	for i, irq := range v.interrupts {
+		if irq.priority > level && (next < 0 || irq.priority > v.interrupts[next].priority) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return interruptRequest{}, false
+	}
+	irq := v.interrupts[next]
+	v.interrupts = append(v.interrupts[:next], v.interrupts[next+1:]...)
+	v.checkInterrupts()
+	return irq, true
+}
+
+// checkInterrupts updates interruptible, after the pending interrupts or the
+// priority level changed.
+func (v *VM) checkInterrupts() {
+	level := uint8((v.psr & psrPriorityMask) >> psrPriorityShift)
+	v.interruptible = false
+	for _, irq := range v.interrupts {
+		if irq.priority > level {
+			v.interruptible = true
+			break
+		}
+	}
+	v.updateSlow()
+}
+
+type illegalOpcodeError struct {
+	op uint8
+}
+
+func (e *illegalOpcodeError) Error() string {
+	return fmt.Sprintf("Operation %q not implemented", opNames[e.op])
+}
+
+func (v *VM) execReturnFromInterrupt(d *decoded) error {
+	if !v.Privileged() {
+		return ErrPrivilegeViolation
+	}
+
+	var values [2]uint16
+	for i := range values {
+		sp := v.GetRegister(RegisterR6)
+		v.memoryAccess(sp)
+		value, err := v.GetMemory(sp)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+		v.SetRegister(RegisterR6, sp+1)
+	}
+	pc, psr := values[0], values[1]
+
+	v.setPSR(psr)
+	if !v.Privileged() {
+		v.savedSSP = v.GetRegister(RegisterR6)
+		v.SetRegister(RegisterR6, v.savedUSP)
+	}
+	v.SetRegister(RegisterPC, pc)
+	return nil
+}
@@ -0,0 +1,132 @@
+package lc3_test
+
+import (
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryProtection(t *testing.T) {
+	t.Run("report user mode accesses outside user memory", func(t *testing.T) {
+		testCases := []struct {
+			name    string
+			program []uint16
+			r1      uint16
+			address uint16
+			write   bool
+		}{
+			{"LDR from system space", []uint16{0x6040}, 0x1000, 0x1000, false},
+			{"STR to device registers", []uint16{0x7040}, 0xfe00, 0xfe00, true},
+			{"LDI through user memory", []uint16{0xa000, 0x0200}, 0, 0x0200, false},
+			{"STI through user memory", []uint16{0xb000, 0xfe02}, 0, 0xfe02, true},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				vm, err := lc3.New(
+					lc3.WithMemoryProtection(lc3.ProtectionError),
+					lc3.WithMemory(0x3000, test.program...),
+					lc3.WithRegister(lc3.RegisterR1, test.r1),
+				)
+				assert.NoError(t, err)
+
+				err = vm.Step()
+				var acv *lc3.AccessViolationError
+				if assert.ErrorAs(t, err, &acv) {
+					assert.Equal(t, lc3.AccessViolationError{PC: 0x3000, Address: test.address, Write: test.write}, *acv)
+				}
+				assert.Equal(t, uint16(0x3000), vm.GetRegister(lc3.RegisterPC))
+			})
+		}
+	})
+
+	t.Run("report fetches outside user memory", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithMemoryProtection(lc3.ProtectionError),
+			lc3.WithMemory(0x3000, 0xc040), // JMP R1
+			lc3.WithRegister(lc3.RegisterR1, 0x0200),
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, vm.Step())
+		var acv *lc3.AccessViolationError
+		assert.ErrorAs(t, vm.Step(), &acv)
+		assert.Equal(t, uint16(0x0200), acv.Address)
+	})
+
+	t.Run("allow everything without protection or in supervisor mode", func(t *testing.T) {
+		for _, opt := range []lc3.Option{lc3.WithMemoryProtection(lc3.ProtectionOff), lc3.WithSupervisorMode()} {
+			vm, err := lc3.New(
+				lc3.WithMemoryProtection(lc3.ProtectionError),
+				opt,
+				lc3.WithMemory(0x3000, 0x7040), // STR R0, R1, #0
+				lc3.WithMemory(0x1000, 0x1234),
+				lc3.WithRegister(lc3.RegisterR1, 0x1000),
+			)
+			assert.NoError(t, err)
+			assert.NoError(t, vm.Step())
+		}
+	})
+
+	t.Run("raise an ACV exception and return to user mode", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithMemoryProtection(lc3.ProtectionException),
+			// LDR R0, R1, #0; HALT
+			lc3.WithMemory(0x3000, 0x6040, 0xf025),
+			lc3.WithMemory(0x0100+uint16(lc3.ExceptionACV), 0x1000),
+			// Handler: ADD R2, R2, #1; RTI
+			lc3.WithMemory(0x1000, 0x14a1, 0x8000),
+			lc3.WithRegister(lc3.RegisterR1, 0x0010),
+			lc3.WithRegister(lc3.RegisterR6, 0x5000),
+		)
+		assert.NoError(t, err)
+		assert.False(t, vm.Privileged())
+
+		assert.NoError(t, vm.Step())
+		assert.True(t, vm.Privileged())
+		assert.Equal(t, uint16(0x1000), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, lc3.DefaultSupervisorStack-2, vm.GetRegister(lc3.RegisterR6))
+		for address, want := range map[uint16]uint16{0x2ffe: 0x3001, 0x2fff: lc3.PSRUser | lc3.FlagZ} {
+			val, err := vm.GetMemory(address)
+			assert.NoError(t, err)
+			assert.Equal(t, want, val)
+		}
+
+		assert.NoError(t, vm.Run())
+		assert.False(t, vm.Privileged())
+		assert.Equal(t, uint16(1), vm.GetRegister(lc3.RegisterR2))
+		assert.Equal(t, uint16(0x5000), vm.GetRegister(lc3.RegisterR6))
+		assert.Equal(t, uint16(0x3002), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, lc3.PSRUser|lc3.FlagZ, vm.PSR())
+	})
+
+	t.Run("raise illegal opcode and privilege exceptions", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			inst   uint16
+			vector uint8
+		}{
+			{"RES", 0xd000, lc3.ExceptionIllegalOpcode},
+			{"RTI in user mode", 0x8000, lc3.ExceptionPrivilege},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				vm, err := lc3.New(lc3.WithMemory(0x3000, test.inst))
+				assert.NoError(t, err)
+				assert.Error(t, vm.Step())
+
+				vm, err = lc3.New(
+					lc3.WithMemoryProtection(lc3.ProtectionException),
+					lc3.WithMemory(0x3000, test.inst),
+					lc3.WithMemory(0x0100+uint16(test.vector), 0x0800),
+				)
+				assert.NoError(t, err)
+				assert.NoError(t, vm.Step())
+				assert.Equal(t, uint16(0x0800), vm.GetRegister(lc3.RegisterPC))
+				assert.True(t, vm.Privileged())
+			})
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package lc3
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// instRET is JMP R7.
+const instRET = uint16(0xc1c0)
+
+// Profiler is a tracer counting the instructions executed per address, per
+// opcode and per subroutine. Subroutines are entered with JSR or JSRR and
+// left with RET to the return address, which gives the calling context of
+// each instruction.
+type Profiler struct {
+	symbols *SymbolTable
+
+	total   uint64
+	cycles  uint64
+	pcs     map[uint16]*hotSpot
+	opcodes [16]uint64
+
+	root    *callNode
+	current *callNode
+	// lastCycles is the cycle count after the previous instruction.
+	lastCycles uint64
+}
+
+type hotSpot struct {
+	inst  uint16
+	count uint64
+}
+
+// callNode is a node of the calling context tree: a subroutine entered from
+// a call site, under the context of its caller.
+type callNode struct {
+	parent   *callNode
+	callSite uint16
+	entry    uint16
+	// ret is the address RET is expected to return to.
+	ret      uint16
+	calls    uint64
+	children map[uint32]*callNode
+	// counts holds the instructions and cycles spent at each address.
+	counts map[uint16]*[2]uint64
+}
+
+// NewProfiler returns a profiler naming addresses with symbols.
+func NewProfiler(symbols ...Symbol) *Profiler {
+	return &Profiler{symbols: NewSymbolTable(symbols...), pcs: map[uint16]*hotSpot{}}
+}
+
+func (p *Profiler) Trace(v *VM, pc uint16, inst uint16) {
+	if p.root == nil {
+		p.root = newCallNode(nil, pc, pc)
+		p.current = p.root
+	}
+	var cycles uint64
+	if now := v.Cycles(); now > 0 {
+		cycles, p.lastCycles = now-p.lastCycles, now
+	}
+
+	p.total++
+	p.cycles += cycles
+	p.opcodes[inst>>12]++
+	spot := p.pcs[pc]
+	if spot == nil {
+		spot = &hotSpot{}
+		p.pcs[pc] = spot
+	}
+	spot.inst = inst
+	spot.count++
+	count := p.current.counts[pc]
+	if count == nil {
+		count = &[2]uint64{}
+		p.current.counts[pc] = count
+	}
+	count[0]++
+	count[1] += cycles
+
+	switch {
+	case inst>>12 == OperationJSR:
+		p.current = p.current.child(pc, v.GetRegister(RegisterPC))
+		p.current.calls++
+	case inst == instRET:
+		// Pop up to the frame returning there, ignoring unmatched returns.
+		for node := p.current; node.parent != nil; node = node.parent {
+			if node.ret == v.GetRegister(RegisterPC) {
+				p.current = node.parent
+				break
+			}
+		}
+	}
+}
+
+func newCallNode(parent *callNode, callSite, entry uint16) *callNode {
+	return &callNode{
+		parent:   parent,
+		callSite: callSite,
+		entry:    entry,
+		ret:      callSite + 1,
+		children: map[uint32]*callNode{},
+		counts:   map[uint16]*[2]uint64{},
+	}
+}
+
+func (n *callNode) child(callSite, entry uint16) *callNode {
+	key := uint32(callSite)<<16 | uint32(entry)
+	c := n.children[key]
+	if c == nil {
+		c = newCallNode(n, callSite, entry)
+		n.children[key] = c
+	}
+	return c
+}
+
+// walk calls fn on the node and its descendants.
+func (n *callNode) walk(fn func(n *callNode)) {
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// self returns the instructions executed in the node itself.
+func (n *callNode) self() uint64 {
+	var total uint64
+	for _, count := range n.counts {
+		total += count[0]
+	}
+	return total
+}
+
+// HotSpot is the number of executions of an instruction.
+type HotSpot struct {
+	Address uint16
+	Inst    uint16
+	Count   uint64
+}
+
+// SubroutineProfile sums the executions of a subroutine: the number of
+// calls, the instructions executed in it and those executed in it or its
+// callees.
+type SubroutineProfile struct {
+	Entry uint16
+	Name  string
+	Calls uint64
+	Self  uint64
+	Total uint64
+}
+
+// CallEdge counts the calls from a subroutine to another.
+type CallEdge struct {
+	Caller, Callee uint16
+	Calls          uint64
+}
+
+// Instructions returns the number of instructions executed.
+func (p *Profiler) Instructions() uint64 {
+	return p.total
+}
+
+// HotSpots returns the executed instructions, most executed first.
+func (p *Profiler) HotSpots() []HotSpot {
+	spots := make([]HotSpot, 0, len(p.pcs))
+	for pc, spot := range p.pcs {
+		spots = append(spots, HotSpot{Address: pc, Inst: spot.inst, Count: spot.count})
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		if spots[i].Count != spots[j].Count {
+			return spots[i].Count > spots[j].Count
+		}
+		return spots[i].Address < spots[j].Address
+	})
+	return spots
+}
+
+// Opcodes returns the number of executions of each opcode.
+func (p *Profiler) Opcodes() map[string]uint64 {
+	opcodes := map[string]uint64{}
+	for op, count := range p.opcodes {
+		if count > 0 {
+			opcodes[opNames[uint8(op)]] = count
+		}
+	}
+	return opcodes
+}
+
+// Subroutines returns the profile of each subroutine, including the entry
+// point of the program, by decreasing total.
+func (p *Profiler) Subroutines() []SubroutineProfile {
+	if p.root == nil {
+		return nil
+	}
+	profiles := map[uint16]*SubroutineProfile{}
+	var visit func(n *callNode, active map[uint16]bool) uint64
+	visit = func(n *callNode, active map[uint16]bool) uint64 {
+		prof := profiles[n.entry]
+		if prof == nil {
+			prof = &SubroutineProfile{Entry: n.entry, Name: p.symbols.Name(n.entry)}
+			profiles[n.entry] = prof
+		}
+		if n.parent != nil {
+			prof.Calls += n.calls
+		}
+		total := n.self()
+		prof.Self += total
+
+		recursive := active[n.entry]
+		active[n.entry] = true
+		for _, c := range n.children {
+			total += visit(c, active)
+		}
+		if !recursive {
+			delete(active, n.entry)
+			prof.Total += total
+		}
+		return total
+	}
+	visit(p.root, map[uint16]bool{})
+
+	result := make([]SubroutineProfile, 0, len(profiles))
+	for _, prof := range profiles {
+		result = append(result, *prof)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Entry < result[j].Entry
+	})
+	return result
+}
+
+// CallGraph returns the calls between subroutines, most frequent first.
+func (p *Profiler) CallGraph() []CallEdge {
+	if p.root == nil {
+		return nil
+	}
+	edges := map[uint32]*CallEdge{}
+	p.root.walk(func(n *callNode) {
+		if n.parent == nil {
+			return
+		}
+		key := uint32(n.parent.entry)<<16 | uint32(n.entry)
+		edge := edges[key]
+		if edge == nil {
+			edge = &CallEdge{Caller: n.parent.entry, Callee: n.entry}
+			edges[key] = edge
+		}
+		edge.Calls += n.calls
+	})
+
+	result := make([]CallEdge, 0, len(edges))
+	for _, edge := range edges {
+		result = append(result, *edge)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Calls != result[j].Calls {
+			return result[i].Calls > result[j].Calls
+		}
+		if result[i].Caller != result[j].Caller {
+			return result[i].Caller < result[j].Caller
+		}
+		return result[i].Callee < result[j].Callee
+	})
+	return result
+}
+
+// WriteReport writes a text report: the top hot spots, the opcodes, the
+// subroutines and the call graph.
+func (p *Profiler) WriteReport(w io.Writer, top int) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d instructions", p.total)
+	if p.cycles > 0 {
+		fmt.Fprintf(&b, ", %d cycles", p.cycles)
+	}
+	b.WriteString("\n\nHot spots:\n")
+	for i, spot := range p.HotSpots() {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(&b, "%10d %6.2f%%  x%04X  %-16s %s\n", spot.Count, p.percent(spot.Count),
+			spot.Address, p.symbols.Name(spot.Address), Disassemble(spot.Address, spot.Inst))
+	}
+
+	b.WriteString("\nOpcodes:\n")
+	opcodes := p.Opcodes()
+	names := make([]string, 0, len(opcodes))
+	for name := range opcodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return opcodes[names[i]] > opcodes[names[j]] })
+	for _, name := range names {
+		fmt.Fprintf(&b, "%10d %6.2f%%  %s\n", opcodes[name], p.percent(opcodes[name]), name)
+	}
+
+	b.WriteString("\nSubroutines:\n")
+	fmt.Fprintf(&b, "%10s %10s %10s  %s\n", "calls", "self", "total", "name")
+	for _, sub := range p.Subroutines() {
+		fmt.Fprintf(&b, "%10d %10d %10d  %s\n", sub.Calls, sub.Self, sub.Total, sub.Name)
+	}
+
+	b.WriteString("\nCall graph:\n")
+	for _, edge := range p.CallGraph() {
+		fmt.Fprintf(&b, "%10d  %s -> %s\n", edge.Calls, p.symbols.Name(edge.Caller), p.symbols.Name(edge.Callee))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (p *Profiler) percent(count uint64) float64 {
+	if p.total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(p.total)
+}
@@ -0,0 +1,163 @@
+package lc3_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const symbolFile = `// Symbol table
+// Scope level 0:
+//	Symbol Name       Page Address
+//	----------------  ------------
+//	MAIN              3000
+//	SUB               3004
+
+`
+
+func TestProfiler(t *testing.T) {
+	symbols, err := lc3.ReadSymbolFile(strings.NewReader(symbolFile))
+	require.NoError(t, err)
+	assert.Equal(t, []lc3.Symbol{
+		{Name: "MAIN", Address: 0x3000, Kind: lc3.SymbolGlobal},
+		{Name: "SUB", Address: 0x3004, Kind: lc3.SymbolGlobal},
+	}, symbols)
+
+	profile := func(t *testing.T) *lc3.Profiler {
+		profiler := lc3.NewProfiler(symbols...)
+		vm, err := lc3.New(
+			lc3.WithTracer(profiler),
+			// MAIN: AND R0, R0, #0; JSR SUB; JSR SUB; HALT
+			// SUB: ADD R0, R0, #1; RET
+			lc3.WithMemory(0x3000, 0x5020, 0x4802, 0x4801, 0xf025, 0x1021, 0xc1c0),
+		)
+		require.NoError(t, err)
+		require.NoError(t, vm.Run())
+		return profiler
+	}
+
+	t.Run("count instructions per address and opcode", func(t *testing.T) {
+		profiler := profile(t)
+		assert.Equal(t, uint64(8), profiler.Instructions())
+		spots := profiler.HotSpots()
+		assert.Equal(t, []lc3.HotSpot{
+			{Address: 0x3004, Inst: 0x1021, Count: 2},
+			{Address: 0x3005, Inst: 0xc1c0, Count: 2},
+		}, spots[:2])
+		assert.Equal(t, map[string]uint64{"AND": 1, "JSR": 2, "TRAP": 1, "ADD": 2, "JMP": 2}, profiler.Opcodes())
+	})
+
+	t.Run("count subroutines and calls", func(t *testing.T) {
+		profiler := profile(t)
+		assert.Equal(t, []lc3.SubroutineProfile{
+			{Entry: 0x3000, Name: "MAIN", Calls: 0, Self: 4, Total: 8},
+			{Entry: 0x3004, Name: "SUB", Calls: 2, Self: 4, Total: 4},
+		}, profiler.Subroutines())
+		assert.Equal(t, []lc3.CallEdge{{Caller: 0x3000, Callee: 0x3004, Calls: 2}}, profiler.CallGraph())
+	})
+
+	t.Run("write a text report", func(t *testing.T) {
+		var report bytes.Buffer
+		require.NoError(t, profile(t).WriteReport(&report, 3))
+		assert.Contains(t, report.String(), "8 instructions\n")
+		assert.Contains(t, report.String(), "x3004  SUB              ADD R0, R0, #1\n")
+		assert.Contains(t, report.String(), "         2  MAIN -> SUB\n")
+	})
+
+	t.Run("write a pprof profile", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, profile(t).WritePprof(&out))
+
+		gz, err := gzip.NewReader(&out)
+		require.NoError(t, err)
+		data, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		// The first field is the instructions sample type.
+		assert.Equal(t, byte(1<<3|2), data[0])
+		assert.Contains(t, string(data), "SUB")
+		assert.Contains(t, string(data), "instructions")
+	})
+
+	t.Run("give no pprof line to addresses before the entry", func(t *testing.T) {
+		profiler := lc3.NewProfiler(symbols...)
+		vm, err := lc3.New(
+			lc3.WithTracer(profiler),
+			// MAIN: JSR x3003; HALT; RET; SUB: BR x3002
+			lc3.WithMemory(0x3000, 0x4802, 0xf025, 0xc1c0, 0x0ffe),
+		)
+		require.NoError(t, err)
+		require.NoError(t, vm.Run())
+
+		var out bytes.Buffer
+		require.NoError(t, profiler.WritePprof(&out))
+		gz, err := gzip.NewReader(&out)
+		require.NoError(t, err)
+		data, err := io.ReadAll(gz)
+		require.NoError(t, err)
+
+		// Map the addresses of the locations to their lines.
+		lines := map[uint64]uint64{}
+		for _, location := range protoFields(t, data)[4] {
+			fields := protoFields(t, location.bytes)
+			line := protoFields(t, fields[4][0].bytes)
+			lines[fields[3][0].value] = 0
+			if len(line[2]) > 0 {
+				lines[fields[3][0].value] = line[2][0].value
+			}
+		}
+		assert.Equal(t, map[uint64]uint64{0x3000: 0, 0x3001: 1, 0x3002: 0, 0x3003: 0}, lines)
+	})
+
+	t.Run("name addresses after the closest symbol", func(t *testing.T) {
+		table := lc3.NewSymbolTable(symbols...)
+		assert.Equal(t, "MAIN", table.Name(0x3000))
+		assert.Equal(t, "MAIN+2", table.Name(0x3002))
+		assert.Equal(t, "SUB+1", table.Name(0x3005))
+		assert.Equal(t, "x2FFF", table.Name(0x2fff))
+	})
+
+	t.Run("reject invalid symbol addresses", func(t *testing.T) {
+		_, err := lc3.ReadSymbolFile(strings.NewReader("//	MAIN  3g00\n"))
+		var syntax *lc3.SyntaxError
+		assert.ErrorAs(t, err, &syntax)
+	})
+}
+
+// protoField is a varint or length-delimited protocol buffer field.
+type protoField struct {
+	value uint64
+	bytes []byte
+}
+
+// protoFields decodes the fields of a message by number.
+func protoFields(t *testing.T, data []byte) map[int][]protoField {
+	t.Helper()
+	fields := map[int][]protoField{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		require.Greater(t, n, 0)
+		data = data[n:]
+		value, n := binary.Uvarint(data)
+		require.Greater(t, n, 0)
+		data = data[n:]
+
+		field := protoField{value: value}
+		switch key & 7 {
+		case 0:
+		case 2:
+			require.LessOrEqual(t, value, uint64(len(data)))
+			field.bytes, data = data[:value], data[value:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], field)
+	}
+	return fields
+}
@@ -0,0 +1,180 @@
+package lc3
+
+import "fmt"
+
+// UninitializedRead is a read of an uninitialized register or memory word by
+// the instruction at PC.
+type UninitializedRead struct {
+	PC   uint16
+	Inst uint16
+	// Memory tells whether the word read is at Address, rather than in
+	// Register.
+	Memory   bool
+	Address  uint16
+	Register Register
+	// Count is the number of times the instruction read it uninitialized.
+	Count uint64
+}
+
+func (r *UninitializedRead) repeat() { r.Count++ }
+
+func (r UninitializedRead) String() string {
+	what := r.Register.String()
+	if r.Memory {
+		what = fmt.Sprintf("memory x%04X", r.Address)
+	}
+	return fmt.Sprintf("read of uninitialized %s at x%04X (%s)", what, r.PC, Disassemble(r.PC, r.Inst))
+}
+
+// UninitializedReadError reports an uninitialized read with CheckError.
+type UninitializedReadError struct {
+	UninitializedRead
+}
+
+func (e *UninitializedReadError) Error() string {
+	return e.String()
+}
+
+// WithSanitizer tracks which memory words and registers are initialized and
+// checks the reads of each instruction. Words are initialized by loading
+// programs and by any write; registers by any write, except PC and COND which
+// always are.
+func WithSanitizer(mode CheckMode) Option {
+	return func(o *options) { o.sanitizer = mode }
+}
+
+// shadow holds the initialized bits of memory and registers.
+type shadow struct {
+	mode      CheckMode
+	memory    [MemorySize / 64]uint64
+	registers uint16
+	// reads are keyed by instruction and word read.
+	reads recorder[UninitializedRead, UninitializedRead]
+}
+
+func newShadow(mode CheckMode) *shadow {
+	return &shadow{mode: mode, registers: 1<<RegisterPC | 1<<RegisterCOND}
+}
+
+func (s *shadow) setMemory(address uint16) {
+	s.memory[address/64] |= 1 << (address % 64)
+}
+
+// memoryInitialized tells whether a word was initialized. Device registers
+// always are.
+func (s *shadow) memoryInitialized(address uint16) bool {
+	return address > UserMemoryLimit || s.memory[address/64]&(1<<(address%64)) != 0
+}
+
+func (s *shadow) setRegister(reg Register) {
+	s.registers |= 1 << reg
+}
+
+func (s *shadow) registerInitialized(reg Register) bool {
+	return s.registers&(1<<reg) != 0
+}
+
+// UninitializedReads returns the uninitialized reads recorded with
+// CheckReport.
+func (v *VM) UninitializedReads() []UninitializedRead {
+	if v.shadow == nil {
+		return nil
+	}
+	return v.shadow.reads.list()
+}
+
+// checkInitialized checks the words the instruction at pc is about to read:
+// the instruction itself and its source registers and memory operands.
+func (v *VM) checkInitialized(pc uint16, d *decoded) error {
+	s := v.shadow
+	var found []UninitializedRead
+	register := func(reg Register) {
+		if !s.registerInitialized(reg) {
+			found = append(found, UninitializedRead{PC: pc, Inst: d.inst, Register: reg, Count: 1})
+		}
+	}
+	memory := func(address uint16) bool {
+		if !s.memoryInitialized(address) {
+			found = append(found, UninitializedRead{PC: pc, Inst: d.inst, Memory: true, Address: address, Count: 1})
+			return false
+		}
+		return true
+	}
+
+	memory(pc)
+	switch d.op {
+	case OperationADD, OperationAND:
+		// AND R, R, #0 is how registers are cleared.
+		if d.op == OperationAND && d.imm && d.offset == 0 {
+			break
+		}
+		register(d.sr1)
+		if !d.imm {
+			register(d.sr2)
+		}
+	case OperationNOT, OperationJMP:
+		register(d.sr1)
+	case OperationJSR:
+		if !d.imm {
+			register(d.sr1)
+		}
+	case OperationLD:
+		memory(pc + d.offset + 1)
+	case OperationLDI:
+		if address := pc + d.offset + 1; memory(address) && address <= UserMemoryLimit {
+			memory(v.memory[address])
+		}
+	case OperationLDR:
+		register(d.sr1)
+		memory(v.registers[d.sr1] + d.offset)
+	case OperationST:
+		register(d.dr)
+	case OperationSTI:
+		register(d.dr)
+		memory(pc + d.offset + 1)
+	case OperationSTR:
+		register(d.dr)
+		register(d.sr1)
+	case OperationRTI:
+		if v.Privileged() {
+			register(RegisterR6)
+			memory(v.registers[RegisterR6])
+			memory(v.registers[RegisterR6] + 1)
+		}
+	case OperationTRAP:
+		switch uint8(d.offset) {
+		case TrapOUT:
+			register(RegisterR0)
+		case TrapPUTS, TrapPUTSP:
+			register(RegisterR0)
+			// Up to the terminating word, as far as it is initialized.
+			for address := v.registers[RegisterR0]; address <= UserMemoryLimit && memory(address); address++ {
+				if word := v.memory[address]; word == 0 || (d.offset == uint16(TrapPUTSP) && word>>8 == 0) {
+					break
+				}
+			}
+		}
+	}
+
+	for _, read := range found {
+		if s.mode == CheckError {
+			return &UninitializedReadError{read}
+		}
+		key := read
+		key.Count = 0
+		record(&s.reads, key, read)
+	}
+	return nil
+}
+
+// markInitialized marks the registers an instruction wrote directly. Trap
+// handlers and exceptions write through SetRegister and SetMemory, which mark
+// what they write.
+func (v *VM) markInitialized(d *decoded) {
+	switch d.op {
+	case OperationADD, OperationAND, OperationNOT, OperationLD, OperationLDI, OperationLDR, OperationLEA:
+		v.shadow.setRegister(d.dr)
+	case OperationJSR:
+		v.shadow.setRegister(RegisterR7)
+	}
+}
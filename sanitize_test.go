@@ -0,0 +1,83 @@
+package lc3_test
+
+import (
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizer(t *testing.T) {
+	// AND R0, R0, #0; ADD R0, R0, #2
+	// LOOP: ADD R3, R4, #0; ADD R0, R0, #-1; BRp LOOP
+	// LDR R5, R0, #5; LD R6, DATA; PUTS; HALT
+	// DATA: .BLKW 1
+	program := []uint16{0x5020, 0x1022, 0x1720, 0x103f, 0x03fd, 0x6a05, 0x2c02, 0xf022, 0xf025, 0x0000}
+
+	engines := map[string]lc3.Engine{"interpreter": lc3.EngineInterpreter, "jit": lc3.EngineJIT, "microcode": lc3.EngineMicrocode}
+	for name, engine := range engines {
+		t.Run("report uninitialized reads with "+name, func(t *testing.T) {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithSanitizer(lc3.CheckReport),
+				lc3.WithSegments(lc3.Segment{Origin: 0x3000, Words: program}),
+			)
+			require.NoError(t, err)
+			require.NoError(t, vm.Run())
+			assert.Equal(t, []lc3.UninitializedRead{
+				{PC: 0x3002, Inst: 0x1720, Register: lc3.RegisterR4, Count: 2},
+				{PC: 0x3005, Inst: 0x6a05, Memory: true, Address: 0x0005, Count: 1},
+				// PUTS of the string at R0, x0000.
+				{PC: 0x3007, Inst: 0xf022, Memory: true, Address: 0x0000, Count: 1},
+			}, vm.UninitializedReads())
+		})
+	}
+
+	t.Run("fail on uninitialized reads", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineMicrocode} {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithSanitizer(lc3.CheckError),
+				lc3.WithRegister(lc3.RegisterR4, 1),
+				lc3.WithSegments(lc3.Segment{Origin: 0x3000, Words: program}),
+			)
+			require.NoError(t, err)
+
+			err = vm.Run()
+			var uninitialized *lc3.UninitializedReadError
+			require.ErrorAs(t, err, &uninitialized)
+			assert.Equal(t, uint16(0x3005), uninitialized.PC)
+			assert.EqualError(t, err, "read of uninitialized memory x0005 at x3005 (LDR R5, R0, #5)")
+			assert.Equal(t, uint16(0x3005), vm.GetRegister(lc3.RegisterPC))
+			assert.Equal(t, uint16(0), vm.GetRegister(lc3.RegisterR5))
+		}
+	})
+
+	t.Run("check strings and fetched instructions", func(t *testing.T) {
+		var out strings.Builder
+		// LEA R0, STR; PUTS; BR x3005
+		// STR: .FILL 'a' (the rest is uninitialized)
+		vm, err := lc3.New(
+			lc3.WithOutput(&out),
+			lc3.WithSanitizer(lc3.CheckReport),
+			lc3.WithMemory(0x3000, 0xe002, 0xf022, 0x0e02, 0x0061),
+		)
+		require.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			require.NoError(t, vm.Step())
+		}
+		assert.Equal(t, []lc3.UninitializedRead{
+			{PC: 0x3001, Inst: 0xf022, Memory: true, Address: 0x3004, Count: 1},
+			{PC: 0x3005, Inst: 0x0000, Memory: true, Address: 0x3005, Count: 1},
+		}, vm.UninitializedReads())
+	})
+
+	t.Run("don't track without sanitizer", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithMemory(0x3000, program...))
+		require.NoError(t, err)
+		require.NoError(t, vm.Run())
+		assert.Nil(t, vm.UninitializedReads())
+	})
+}
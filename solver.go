@@ -0,0 +1,279 @@
+package lc3
+
+type exprOp uint8
+
+const (
+	exprConst exprOp = iota
+	exprVar
+	exprAdd
+	exprAnd
+	exprNot
+)
+
+// expr is a symbolic 16-bit value: a constant, a variable, or the ADD, AND or
+// NOT of other values, the only operations of the LC-3. Expressions are
+// immutable and shared between paths.
+type expr struct {
+	op    exprOp
+	value uint16
+	// v is the index of a variable.
+	v    int
+	a, b *expr
+	// vars are the variables the value depends on, sorted.
+	vars []int
+}
+
+func constant(value uint16) *expr {
+	return &expr{op: exprConst, value: value}
+}
+
+func variable(v int) *expr {
+	return &expr{op: exprVar, v: v, vars: []int{v}}
+}
+
+func (e *expr) concrete() bool {
+	return e.op == exprConst
+}
+
+// add returns a + b, folding constants.
+func add(a, b *expr) *expr {
+	if a.concrete() {
+		a, b = b, a
+	}
+	switch {
+	case a.concrete():
+		return constant(a.value + b.value)
+	case b.concrete() && b.value == 0:
+		return a
+	case b.concrete() && a.op == exprAdd && a.b.concrete():
+		return add(a.a, constant(a.b.value+b.value))
+	}
+	return &expr{op: exprAdd, a: a, b: b, vars: union(a.vars, b.vars)}
+}
+
+// and returns a & b, folding constants.
+func and(a, b *expr) *expr {
+	if a.concrete() {
+		a, b = b, a
+	}
+	switch {
+	case a.concrete():
+		return constant(a.value & b.value)
+	case b.concrete() && b.value == 0:
+		return b
+	case b.concrete() && b.value == 0xffff, a == b:
+		return a
+	}
+	return &expr{op: exprAnd, a: a, b: b, vars: union(a.vars, b.vars)}
+}
+
+// not returns ^a, folding constants.
+func not(a *expr) *expr {
+	switch {
+	case a.concrete():
+		return constant(^a.value)
+	case a.op == exprNot:
+		return a.a
+	}
+	return &expr{op: exprNot, a: a, vars: a.vars}
+}
+
+// eval returns the value of e given the values of the variables.
+func (e *expr) eval(values []uint16) uint16 {
+	switch e.op {
+	case exprConst:
+		return e.value
+	case exprVar:
+		return values[e.v]
+	case exprAdd:
+		return e.a.eval(values) + e.b.eval(values)
+	case exprAnd:
+		return e.a.eval(values) & e.b.eval(values)
+	default:
+		return ^e.a.eval(values)
+	}
+}
+
+// union merges two sorted sets of variables.
+func union(a, b []int) []int {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	merged := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || i < len(a) && a[i] < b[j]:
+			merged = append(merged, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			merged = append(merged, b[j])
+			j++
+		default:
+			merged = append(merged, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return merged
+}
+
+// constraint requires the condition codes of a value to be among nzp, as
+// tested by BR.
+type constraint struct {
+	e   *expr
+	nzp uint16
+}
+
+// equal returns the constraint e == value.
+func equal(e *expr, value uint16) constraint {
+	return constraint{e: add(e, constant(-value)), nzp: FlagZ}
+}
+
+func (c constraint) holds(values []uint16) bool {
+	return conditionCodes(c.e.eval(values))&c.nzp != 0
+}
+
+// symVar is a symbolic variable, ranging over 0 to max.
+type symVar struct {
+	max uint16
+	// input tells the variable is a character read, whose printable values
+	// are tried first.
+	input bool
+}
+
+// first returns the first value of the variable tried, without building
+// them all.
+func (s symVar) first() uint16 {
+	if s.input {
+		return ' '
+	}
+	return 0
+}
+
+// candidates returns the values of the variable in the order they are tried.
+func (s symVar) candidates() []uint16 {
+	values := make([]uint16, 0, int(s.max)+1)
+	if s.input {
+		for c := uint16(' '); c <= '~'; c++ {
+			values = append(values, c)
+		}
+		values = append(values, '\n')
+	}
+	for value := 0; value <= int(s.max); value++ {
+		if !s.input || value < ' ' && value != '\n' || value > '~' {
+			values = append(values, uint16(value))
+		}
+	}
+	return values
+}
+
+type solveStatus uint8
+
+const (
+	solveSat solveStatus = iota
+	solveUnsat
+	// solveUnknown is a search given up after the evaluation budget.
+	solveUnknown
+)
+
+// solveBudget bounds the constraint evaluations of a search.
+const solveBudget = 1 << 22
+
+// solve looks for values of vars satisfying the constraints. The values of
+// each variable are first filtered by the constraints on that variable
+// alone, then the search backtracks over the constraints relating several
+// variables, checking each once its last variable is set. Variables without
+// constraints get their first candidate.
+func solve(vars []symVar, constraints []constraint) ([]uint16, solveStatus) {
+	values := make([]uint16, len(vars))
+	single := make([][]constraint, len(vars))
+	multi := make([][]constraint, len(vars))
+	constrained := make([]bool, len(vars))
+	for _, c := range constraints {
+		switch n := len(c.e.vars); n {
+		case 0:
+			if !c.holds(values) {
+				return nil, solveUnsat
+			}
+		case 1:
+			single[c.e.vars[0]] = append(single[c.e.vars[0]], c)
+		default:
+			multi[c.e.vars[n-1]] = append(multi[c.e.vars[n-1]], c)
+		}
+		for _, v := range c.e.vars {
+			constrained[v] = true
+		}
+	}
+
+	budget := solveBudget
+	candidates := make([][]uint16, len(vars))
+	for v, s := range vars {
+		if !constrained[v] {
+			values[v] = s.first()
+			continue
+		}
+		for _, value := range s.candidates() {
+			values[v] = value
+			ok := true
+			for _, c := range single[v] {
+				budget--
+				if !c.holds(values) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				candidates[v] = append(candidates[v], value)
+			}
+		}
+		if len(candidates[v]) == 0 {
+			return nil, solveUnsat
+		}
+		values[v] = candidates[v][0]
+	}
+
+	// Only constrained variables are searched.
+	var order []int
+	for v := range vars {
+		if constrained[v] {
+			order = append(order, v)
+		}
+	}
+
+	status := solveUnsat
+	var search func(i int) bool
+	search = func(i int) bool {
+		if i == len(order) {
+			return true
+		}
+		v := order[i]
+		for _, value := range candidates[v] {
+			values[v] = value
+			ok := true
+			for _, c := range multi[v] {
+				if budget--; budget < 0 {
+					status = solveUnknown
+					return false
+				}
+				if !c.holds(values) {
+					ok = false
+					break
+				}
+			}
+			if ok && search(i+1) {
+				return true
+			}
+			if status == solveUnknown {
+				return false
+			}
+		}
+		return false
+	}
+	if !search(0) {
+		return nil, status
+	}
+	return values, solveSat
+}
@@ -0,0 +1,247 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SourceMap maps addresses to the lines of an LC-3 assembly source, without
+// assembling it: it only follows the location counter through .ORIG, labels,
+// instructions and data directives.
+type SourceMap struct {
+	File string
+	// Source holds the text of each line, Source[0] being line 1.
+	Source []string
+	// Lines holds the first address of each line emitting words, in
+	// address order.
+	Lines   []LineInfo
+	Symbols []Symbol
+
+	spans []sourceSpan
+}
+
+// sourceSpan is the words emitted by a line.
+type sourceSpan struct {
+	LineInfo
+	words uint16
+	code  bool
+	// op is the upper case mnemonic or directive.
+	op string
+}
+
+var mnemonics = map[string]bool{
+	"ADD": true, "AND": true, "JMP": true, "JSR": true, "JSRR": true, "LD": true, "LDI": true, "LDR": true,
+	"LEA": true, "NOT": true, "RET": true, "RTI": true, "ST": true, "STI": true, "STR": true, "TRAP": true,
+	"GETC": true, "OUT": true, "PUTS": true, "IN": true, "PUTSP": true, "HALT": true,
+}
+
+func isMnemonic(token string) bool {
+	token = strings.ToUpper(token)
+	if strings.HasPrefix(token, "BR") {
+		return strings.Trim(token[2:], "NZP") == "" && len(token) <= 5
+	}
+	return mnemonics[token]
+}
+
+// ReadSourceMap reads an assembly source, named file in the map.
+func ReadSourceMap(r io.Reader, file string) (*SourceMap, error) {
+	m := &SourceMap{File: file}
+	scanner := bufio.NewScanner(r)
+	var pc uint16
+	inBlock := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		m.Source = append(m.Source, text)
+
+		tokens := tokenizeAssembly(text)
+		if len(tokens) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(tokens[0], ".") && !isMnemonic(tokens[0]) {
+			if !inBlock {
+				return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("label %s outside of .ORIG", tokens[0])}
+			}
+			m.Symbols = append(m.Symbols, Symbol{Name: tokens[0], Address: pc, Kind: SymbolLocal})
+			tokens = tokens[1:]
+			if len(tokens) == 0 {
+				continue
+			}
+		}
+
+		op := strings.ToUpper(tokens[0])
+		if op == ".ORIG" {
+			if len(tokens) != 2 {
+				return nil, &SyntaxError{Line: line, Msg: ".ORIG needs an address"}
+			}
+			origin, err := parseAssemblyNumber(tokens[1])
+			if err != nil {
+				return nil, &SyntaxError{Line: line, Msg: err.Error()}
+			}
+			pc, inBlock = uint16(origin), true
+			continue
+		}
+		if !inBlock {
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("%s outside of .ORIG", tokens[0])}
+		}
+
+		var words uint16
+		code := false
+		switch op {
+		case ".END":
+			inBlock = false
+			continue
+		case ".FILL":
+			words = 1
+		case ".BLKW":
+			if len(tokens) != 2 {
+				return nil, &SyntaxError{Line: line, Msg: ".BLKW needs a count"}
+			}
+			count, err := parseAssemblyNumber(tokens[1])
+			if err != nil {
+				return nil, &SyntaxError{Line: line, Msg: err.Error()}
+			}
+			words = uint16(count)
+		case ".STRINGZ":
+			if len(tokens) != 2 {
+				return nil, &SyntaxError{Line: line, Msg: ".STRINGZ needs a string"}
+			}
+			length, ok := stringLength(tokens[1])
+			if !ok {
+				return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid string %s", tokens[1])}
+			}
+			words = uint16(length + 1)
+		default:
+			if !isMnemonic(op) {
+				return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("unknown instruction %s", tokens[0])}
+			}
+			words, code = 1, true
+		}
+
+		info := LineInfo{Address: pc, File: file, Line: line}
+		m.Lines = append(m.Lines, info)
+		m.spans = append(m.spans, sourceSpan{LineInfo: info, words: words, code: code, op: op})
+		pc += words
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	sort.SliceStable(m.spans, func(i, j int) bool { return m.spans[i].Address < m.spans[j].Address })
+	sort.SliceStable(m.Lines, func(i, j int) bool { return m.Lines[i].Address < m.Lines[j].Address })
+	return m, nil
+}
+
+// tokenizeAssembly splits a line into tokens, dropping commas and comments
+// but keeping string literals whole.
+func tokenizeAssembly(text string) []string {
+	var tokens []string
+	var token strings.Builder
+	flush := func() {
+		if token.Len() > 0 {
+			tokens = append(tokens, token.String())
+			token.Reset()
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == ';':
+			flush()
+			return tokens
+		case c == '"':
+			flush()
+			j := i + 1
+			for ; j < len(text) && text[j] != '"'; j++ {
+				if text[j] == '\\' {
+					j++
+				}
+			}
+			tokens = append(tokens, text[i:min(j+1, len(text))])
+			i = j
+		case c == ',' || c == ' ' || c == '\t':
+			flush()
+		default:
+			token.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// stringLength returns the number of characters of a quoted string literal,
+// counting escape sequences such as \n or \e as one.
+func stringLength(quoted string) (int, bool) {
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		return 0, false
+	}
+	length := 0
+	for i := 1; i < len(quoted)-1; i++ {
+		if quoted[i] == '\\' {
+			i++
+		}
+		length++
+	}
+	return length, true
+}
+
+// parseAssemblyNumber accepts xNNNN, #NNN and decimal numbers.
+func parseAssemblyNumber(s string) (int64, error) {
+	var value int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "x") || strings.HasPrefix(s, "X"):
+		value, err = strconv.ParseInt(s[1:], 16, 32)
+	case strings.HasPrefix(s, "#"):
+		value, err = strconv.ParseInt(s[1:], 10, 32)
+	default:
+		value, err = strconv.ParseInt(s, 0, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return value, nil
+}
+
+// Line returns the line emitting the word at address.
+func (m *SourceMap) Line(address uint16) (LineInfo, bool) {
+	span, ok := m.span(address)
+	return span.LineInfo, ok
+}
+
+// IsCode tells whether address holds an instruction, rather than data.
+func (m *SourceMap) IsCode(address uint16) bool {
+	span, ok := m.span(address)
+	return ok && span.code
+}
+
+func (m *SourceMap) span(address uint16) (sourceSpan, bool) {
+	i := sort.Search(len(m.spans), func(i int) bool { return m.spans[i].Address > address })
+	if i == 0 {
+		return sourceSpan{}, false
+	}
+	span := m.spans[i-1]
+	if uint32(address) >= uint32(span.Address)+uint32(span.words) {
+		return sourceSpan{}, false
+	}
+	return span, true
+}
+
+// DataRegions returns the regions emitted by data directives, merging
+// adjacent ones.
+func (m *SourceMap) DataRegions() []DataRegion {
+	var regions []DataRegion
+	for _, span := range m.spans {
+		if span.code || span.words == 0 {
+			continue
+		}
+		if n := len(regions); n > 0 && regions[n-1].Origin+regions[n-1].Size == span.Address {
+			regions[n-1].Size += span.words
+			continue
+		}
+		regions = append(regions, DataRegion{Origin: span.Address, Size: span.words})
+	}
+	return regions
+}
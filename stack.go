@@ -0,0 +1,170 @@
+package lc3
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stack is the memory R6 points into: it grows down from Base, the value of
+// R6 when empty, to Limit, the lowest address it may use.
+type Stack struct {
+	Limit uint16
+	Base  uint16
+}
+
+// DefaultStack is a 3.5K words stack right below the device registers.
+var DefaultStack = Stack{Limit: 0xf000, Base: 0xfe00}
+
+// StackViolation is an instruction moving R6 out of the stack, with
+// ADD R6, R6, ..., or accessing memory out of it through R6, with LDR or STR.
+type StackViolation struct {
+	PC   uint16
+	Inst uint16
+	// Address is the new R6 or the address accessed.
+	Address uint16
+	// Overflow tells whether Address is below the stack rather than above.
+	Overflow bool
+	Count    uint64
+}
+
+func (s *StackViolation) repeat() { s.Count++ }
+
+func (s StackViolation) String() string {
+	kind := "underflow"
+	if s.Overflow {
+		kind = "overflow"
+	}
+	return fmt.Sprintf("stack %s at x%04X (%s): x%04X is out of the stack", kind, s.PC, Disassemble(s.PC, s.Inst), s.Address)
+}
+
+// StackViolationError reports a stack violation with CheckError.
+type StackViolationError struct {
+	StackViolation
+}
+
+func (e *StackViolationError) Error() string {
+	return e.String()
+}
+
+// StackFrame is a subroutine call in progress.
+type StackFrame struct {
+	Entry    uint16
+	CallSite uint16
+	// SP is R6 on entry.
+	SP uint16
+}
+
+// WithStackGuard checks the accesses to the stack through R6 for overflows
+// and underflows, and tracks stack frames across JSR/JSRR and RET.
+func WithStackGuard(mode CheckMode, stack Stack) Option {
+	return func(o *options) {
+		o.stackGuard = mode
+		o.stack = stack
+	}
+}
+
+// stackGuard checks R6 and tracks frames.
+type stackGuard struct {
+	mode       CheckMode
+	stack      Stack
+	frames     []StackFrame
+	violations recorder[uint16, StackViolation]
+}
+
+// StackViolations returns the violations recorded with CheckReport.
+func (v *VM) StackViolations() []StackViolation {
+	if v.stackGuard == nil {
+		return nil
+	}
+	return v.stackGuard.violations.list()
+}
+
+// StackFrames returns the subroutine calls in progress, innermost last, as
+// tracked by the stack guard.
+func (v *VM) StackFrames() []StackFrame {
+	if v.stackGuard == nil {
+		return nil
+	}
+	return append([]StackFrame(nil), v.stackGuard.frames...)
+}
+
+// checkStack checks the stack accesses of the instruction at pc.
+func (v *VM) checkStack(pc uint16, d *decoded) error {
+	g := v.stackGuard
+	sp := v.registers[RegisterR6]
+	var address uint16
+	// inStack tells whether address is a valid word, or R6 value when
+	// moving the stack pointer.
+	var inStack bool
+	switch {
+	case d.op == OperationADD && d.dr == RegisterR6 && d.sr1 == RegisterR6:
+		address = sp + d.offset
+		if !d.imm {
+			address = sp + v.registers[d.sr2]
+		}
+		inStack = address >= g.stack.Limit && address <= g.stack.Base
+	case (d.op == OperationLDR || d.op == OperationSTR) && d.sr1 == RegisterR6:
+		address = sp + d.offset
+		inStack = address >= g.stack.Limit && address < g.stack.Base
+	default:
+		return nil
+	}
+	if inStack {
+		return nil
+	}
+
+	violation := StackViolation{PC: pc, Inst: d.inst, Address: address, Overflow: address < g.stack.Limit, Count: 1}
+	if g.mode == CheckError {
+		return &StackViolationError{violation}
+	}
+	record(&g.violations, pc, violation)
+	return nil
+}
+
+// trackFrames pushes a frame on JSR/JSRR and pops the frames up to the one
+// RET returns to.
+func (v *VM) trackFrames(pc uint16, inst uint16) {
+	g := v.stackGuard
+	switch {
+	case inst>>12 == OperationJSR:
+		g.frames = append(g.frames, StackFrame{Entry: v.registers[RegisterPC], CallSite: pc, SP: v.registers[RegisterR6]})
+	case inst == instRET:
+		for i := len(g.frames) - 1; i >= 0; i-- {
+			if g.frames[i].CallSite+1 == v.registers[RegisterPC] {
+				g.frames = g.frames[:i]
+				break
+			}
+		}
+	}
+}
+
+// WriteStack writes the words on the stack, from R6 up to its base, under
+// the frame that pushed them.
+func (v *VM) WriteStack(w io.Writer) error {
+	g := v.stackGuard
+	if g == nil {
+		return fmt.Errorf("no stack guard")
+	}
+
+	var b strings.Builder
+	sp := v.registers[RegisterR6]
+	fmt.Fprintf(&b, "stack x%04X-x%04X, R6 x%04X\n", g.stack.Limit, g.stack.Base, sp)
+	address := uint32(sp)
+	for i := len(g.frames); i >= 0; i-- {
+		// Words below the SP on entry of a frame were pushed by it.
+		end := uint32(g.stack.Base)
+		if i > 0 {
+			frame := g.frames[i-1]
+			fmt.Fprintf(&b, "  x%04X called from x%04X\n", frame.Entry, frame.CallSite)
+			end = uint32(frame.SP)
+		} else {
+			b.WriteString("  main\n")
+		}
+		for ; address < end && address < uint32(g.stack.Base); address++ {
+			fmt.Fprintf(&b, "    x%04X  x%04X\n", address, v.memory[address])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,80 @@
+package lc3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackGuard(t *testing.T) {
+	stack := lc3.Stack{Limit: 0x3ffe, Base: 0x4000}
+	// MAIN: JSR SUB; HALT
+	// SUB: push R7, R1 and R2 in a two words stack, pop them with
+	// ADD R6, R6, #3, reload R7 and read past the base; RET
+	program := []uint16{0x4801, 0xf025, 0x1dbf, 0x7f80, 0x1dbf, 0x7380, 0x1dbf, 0x7580, 0x1da3, 0x6fbf, 0x6180, 0xc1c0}
+	newVM := func(t *testing.T, mode lc3.CheckMode, opts ...lc3.Option) *lc3.VM {
+		vm, err := lc3.New(append(opts,
+			lc3.WithStackGuard(mode, stack),
+			lc3.WithRegister(lc3.RegisterR6, 0x4000),
+			lc3.WithMemory(0x3000, program...),
+		)...)
+		require.NoError(t, err)
+		return vm
+	}
+
+	t.Run("report overflows and underflows", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineJIT, lc3.EngineMicrocode} {
+			vm := newVM(t, lc3.CheckReport, lc3.WithEngine(engine))
+			require.NoError(t, vm.Run())
+			violations := vm.StackViolations()
+			assert.Equal(t, []lc3.StackViolation{
+				{PC: 0x3006, Inst: 0x1dbf, Address: 0x3ffd, Overflow: true, Count: 1},
+				{PC: 0x3007, Inst: 0x7580, Address: 0x3ffd, Overflow: true, Count: 1},
+				{PC: 0x300a, Inst: 0x6180, Address: 0x4000, Count: 1},
+			}, violations)
+			assert.Equal(t, "stack overflow at x3006 (ADD R6, R6, #-1): x3FFD is out of the stack", violations[0].String())
+			assert.Empty(t, vm.StackFrames())
+		}
+	})
+
+	t.Run("fail on overflows", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineMicrocode} {
+			vm := newVM(t, lc3.CheckError, lc3.WithEngine(engine))
+			err := vm.Run()
+			var violation *lc3.StackViolationError
+			require.ErrorAs(t, err, &violation)
+			assert.True(t, violation.Overflow)
+			assert.Equal(t, uint16(0x3006), vm.GetRegister(lc3.RegisterPC))
+			assert.Equal(t, uint16(0x3ffe), vm.GetRegister(lc3.RegisterR6))
+		}
+	})
+
+	t.Run("show frames", func(t *testing.T) {
+		vm := newVM(t, lc3.CheckReport)
+		for i := 0; i < 7; i++ {
+			require.NoError(t, vm.Step())
+		}
+		assert.Equal(t, []lc3.StackFrame{{Entry: 0x3002, CallSite: 0x3000, SP: 0x4000}}, vm.StackFrames())
+
+		var view bytes.Buffer
+		require.NoError(t, vm.WriteStack(&view))
+		assert.Equal(t, "stack x3FFE-x4000, R6 x3FFD\n"+
+			"  x3002 called from x3000\n"+
+			"    x3FFD  x0000\n"+
+			"    x3FFE  x0000\n"+
+			"    x3FFF  x3001\n"+
+			"  main\n", view.String())
+	})
+
+	t.Run("trace the stack", func(t *testing.T) {
+		var trace strings.Builder
+		vm := newVM(t, lc3.CheckReport, lc3.WithTracer(lc3.NewTextTracer(&trace)))
+		require.NoError(t, vm.Run())
+		assert.Contains(t, trace.String(), "JSR x3002")
+		assert.Contains(t, trace.String(), "stack x3FFE-x4000, R6 x3FFE\n  x3002 called from x3000\n    x3FFE  x0000\n    x3FFF  x3001\n  main\n")
+	})
+}
@@ -0,0 +1,448 @@
+package lc3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Default limits of Explore.
+const (
+	DefaultMaxInput = 32
+	DefaultMaxSteps = 100000
+	DefaultMaxPaths = 10000
+)
+
+// SymbolicConfig configures Explore.
+type SymbolicConfig struct {
+	// Registers and Memory are made symbolic: they may hold any value.
+	Registers []Register
+	Memory    []DataRegion
+	// Targets are the addresses to find inputs reaching.
+	Targets []uint16
+	// MaxInput bounds the characters read by a path, MaxSteps the
+	// instructions it executes and MaxPaths the paths explored. Zero means
+	// the default.
+	MaxInput int
+	MaxSteps int
+	MaxPaths int
+}
+
+// FindingKind is a kind of finding of Explore.
+type FindingKind uint8
+
+const (
+	// FindingTarget is a target reached.
+	FindingTarget FindingKind = iota
+	// FindingIllegal is the execution of a word that isn't a valid
+	// instruction.
+	FindingIllegal
+)
+
+// Finding is a target or an illegal instruction reached, with concrete
+// values leading there.
+type Finding struct {
+	Kind FindingKind
+	PC   uint16
+	Inst uint16
+	// Input is the input read by the path, through GETC, IN or KBDR.
+	Input []byte
+	// Registers and Memory are the values of the symbolic registers and
+	// memory words.
+	Registers map[Register]uint16
+	Memory    map[uint16]uint16
+	// Steps is the number of instructions executed before reaching PC.
+	Steps int
+}
+
+func (f Finding) String() string {
+	var b strings.Builder
+	if f.Kind == FindingIllegal {
+		fmt.Fprintf(&b, "illegal instruction x%04X at x%04X", f.Inst, f.PC)
+	} else {
+		fmt.Fprintf(&b, "x%04X reached", f.PC)
+	}
+	fmt.Fprintf(&b, " with input %q", f.Input)
+	for reg := RegisterR0; reg <= RegisterR7; reg++ {
+		if value, ok := f.Registers[reg]; ok {
+			fmt.Fprintf(&b, ", %s=x%04X", reg, value)
+		}
+	}
+	addresses := make([]int, 0, len(f.Memory))
+	for address := range f.Memory {
+		addresses = append(addresses, int(address))
+	}
+	sort.Ints(addresses)
+	for _, address := range addresses {
+		fmt.Fprintf(&b, ", [x%04X]=x%04X", address, f.Memory[uint16(address)])
+	}
+	return b.String()
+}
+
+// Exploration is the outcome of Explore.
+type Exploration struct {
+	Findings []Finding
+	// Paths is the number of paths explored and Instructions the number of
+	// instructions executed over all of them.
+	Paths        int
+	Instructions uint64
+	// Complete tells every path ended within the limits, so that nothing
+	// was missed.
+	Complete bool
+}
+
+// symPath is the state of an execution path.
+type symPath struct {
+	pc      uint16
+	regs    [RegisterR7 + 1]*expr
+	cond    *expr
+	memory  map[uint16]*expr
+	latched *expr
+	// constraints are the branch conditions leading to the path, satisfied
+	// by model.
+	constraints []constraint
+	model       []uint16
+	inputs      []int
+	steps       int
+}
+
+func (p *symPath) fork() *symPath {
+	q := *p
+	q.memory = make(map[uint16]*expr, len(p.memory))
+	for address, e := range p.memory {
+		q.memory[address] = e
+	}
+	q.constraints = p.constraints[:len(p.constraints):len(p.constraints)]
+	q.model = append([]uint16(nil), p.model...)
+	q.inputs = p.inputs[:len(p.inputs):len(p.inputs)]
+	return &q
+}
+
+func (p *symPath) set(reg Register, e *expr) {
+	p.regs[reg] = e
+	p.cond = e
+}
+
+// explorer runs the paths of a program symbolically.
+type explorer struct {
+	vm         *VM
+	cfg        SymbolicConfig
+	vars       []symVar
+	registers  map[Register]int
+	memory     map[uint16]int
+	targets    map[uint16]bool
+	found      map[[2]uint16]bool
+	result     *Exploration
+	incomplete bool
+}
+
+// Explore runs the program loaded in the VM from PC, with symbolic input:
+// each character read may be any byte, as may the registers and memory
+// words of cfg. Paths fork on conditional branches whose outcome depends on
+// symbolic values, and a built-in solver keeps the feasible ones, giving
+// concrete input for each target reached and each illegal instruction
+// executed.
+//
+// Instructions follow the semantics of the VM in user mode, without its
+// devices other than the keyboard. Paths end on HALT, RTI and traps other
+// than the standard ones. Symbolic addresses and jump targets are fixed to
+// a single value. The VM itself isn't changed.
+func (v *VM) Explore(cfg SymbolicConfig) (*Exploration, error) {
+	if cfg.MaxInput == 0 {
+		cfg.MaxInput = DefaultMaxInput
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = DefaultMaxSteps
+	}
+	if cfg.MaxPaths == 0 {
+		cfg.MaxPaths = DefaultMaxPaths
+	}
+	x := &explorer{
+		vm:        v,
+		cfg:       cfg,
+		registers: map[Register]int{},
+		memory:    map[uint16]int{},
+		targets:   map[uint16]bool{},
+		found:     map[[2]uint16]bool{},
+		result:    &Exploration{},
+	}
+	for _, target := range cfg.Targets {
+		x.targets[target] = true
+	}
+
+	p := &symPath{pc: v.registers[RegisterPC], memory: map[uint16]*expr{}}
+	for reg := range p.regs {
+		p.regs[reg] = constant(v.registers[reg])
+	}
+	// COND is rebuilt from a value with the same condition codes.
+	switch v.registers[RegisterCOND] {
+	case FlagN:
+		p.cond = constant(0x8000)
+	case FlagP:
+		p.cond = constant(1)
+	default:
+		p.cond = constant(0)
+	}
+	for _, reg := range cfg.Registers {
+		if reg > RegisterR7 {
+			return nil, fmt.Errorf("register %s can't be symbolic", reg)
+		}
+		x.registers[reg] = x.newVar(p, symVar{max: 0xffff})
+		p.regs[reg] = variable(x.registers[reg])
+	}
+	for _, region := range cfg.Memory {
+		for i := uint16(0); i < region.Size; i++ {
+			address := region.Origin + i
+			x.memory[address] = x.newVar(p, symVar{max: 0xffff})
+			p.memory[address] = variable(x.memory[address])
+		}
+	}
+
+	queue := []*symPath{p}
+	x.result.Paths = 1
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		next := x.run(p)
+		if room := cfg.MaxPaths - x.result.Paths; len(next) > 1 && room < len(next)-1 {
+			next = next[:room+1]
+			x.incomplete = true
+		}
+		x.result.Paths += max(len(next)-1, 0)
+		queue = append(queue, next...)
+	}
+	x.result.Complete = !x.incomplete
+	return x.result, nil
+}
+
+// newVar adds a variable to the explorer and to the model of p.
+func (x *explorer) newVar(p *symPath, s symVar) int {
+	x.vars = append(x.vars, s)
+	x.extend(p)
+	return len(x.vars) - 1
+}
+
+// extend gives the model of p a value for each variable.
+func (x *explorer) extend(p *symPath) {
+	for v := len(p.model); v < len(x.vars); v++ {
+		p.model = append(p.model, x.vars[v].first())
+	}
+}
+
+// run executes p until it ends or forks, returning the paths to carry on.
+func (x *explorer) run(p *symPath) []*symPath {
+	for {
+		if p.steps == x.cfg.MaxSteps {
+			x.incomplete = true
+			return nil
+		}
+		next := x.step(p)
+		x.result.Instructions++
+		if len(next) != 1 || next[0] != p {
+			return next
+		}
+	}
+}
+
+// step executes the instruction at the PC of p, returning the paths
+// following it.
+func (x *explorer) step(p *symPath) []*symPath {
+	pc := p.pc
+	inst := x.concretize(p, x.read(p, pc))
+	if x.targets[pc] {
+		x.report(FindingTarget, p, inst)
+	}
+	if !wellFormed(inst) {
+		x.report(FindingIllegal, p, inst)
+		return nil
+	}
+
+	d := decode(inst)
+	p.pc = pc + 1
+	p.steps++
+	source2 := func() *expr {
+		if d.imm {
+			return constant(d.offset)
+		}
+		return p.regs[d.sr2]
+	}
+	switch d.op {
+	case OperationADD:
+		p.set(d.dr, add(p.regs[d.sr1], source2()))
+	case OperationAND:
+		p.set(d.dr, and(p.regs[d.sr1], source2()))
+	case OperationNOT:
+		p.set(d.dr, not(p.regs[d.sr1]))
+	case OperationLEA:
+		p.set(d.dr, constant(pc+1+d.offset))
+	case OperationLD:
+		p.set(d.dr, x.load(p, constant(pc+1+d.offset)))
+	case OperationLDI:
+		p.set(d.dr, x.load(p, x.load(p, constant(pc+1+d.offset))))
+	case OperationLDR:
+		p.set(d.dr, x.load(p, add(p.regs[d.sr1], constant(d.offset))))
+	case OperationST:
+		x.store(p, constant(pc+1+d.offset), p.regs[d.dr])
+	case OperationSTI:
+		x.store(p, x.load(p, constant(pc+1+d.offset)), p.regs[d.dr])
+	case OperationSTR:
+		x.store(p, add(p.regs[d.sr1], constant(d.offset)), p.regs[d.dr])
+	case OperationBR:
+		return x.branch(p, pc, d)
+	case OperationJMP:
+		p.pc = x.concretize(p, p.regs[d.sr1])
+	case OperationJSR:
+		if d.imm {
+			p.pc = pc + 1 + d.offset
+		} else {
+			p.pc = x.concretize(p, p.regs[d.sr1])
+		}
+		p.regs[RegisterR7] = constant(pc + 1)
+	case OperationTRAP:
+		switch uint8(d.offset) {
+		case TrapGETC, TrapIN:
+			char := x.input(p)
+			if char == nil {
+				return nil
+			}
+			p.regs[RegisterR0] = char
+		case TrapOUT, TrapPUTS, TrapPUTSP:
+		default:
+			return nil
+		}
+	case OperationRTI:
+		return nil
+	}
+	return []*symPath{p}
+}
+
+// branch forks p on the outcome of the BR at pc, keeping the feasible paths.
+func (x *explorer) branch(p *symPath, pc uint16, d decoded) []*symPath {
+	if p.cond.concrete() || d.nzp == 0 || d.nzp == 0x7 {
+		if conditionCodes(p.cond.eval(p.model))&d.nzp != 0 {
+			p.pc = pc + 1 + d.offset
+		}
+		return []*symPath{p}
+	}
+
+	var next []*symPath
+	for _, taken := range []bool{true, false} {
+		c := constraint{e: p.cond, nzp: d.nzp}
+		if !taken {
+			c.nzp = 0x7 &^ d.nzp
+		}
+		q := p.fork()
+		if !x.assume(q, c) {
+			continue
+		}
+		if taken {
+			q.pc = pc + 1 + d.offset
+		}
+		next = append(next, q)
+	}
+	return next
+}
+
+// assume adds c to the constraints of p, returning whether they can still
+// be satisfied.
+func (x *explorer) assume(p *symPath, c constraint) bool {
+	p.constraints = append(p.constraints, c)
+	x.extend(p)
+	if c.holds(p.model) {
+		return true
+	}
+	model, status := solve(x.vars, p.constraints)
+	if status == solveUnknown {
+		x.incomplete = true
+	}
+	if status != solveSat {
+		return false
+	}
+	p.model = model
+	return true
+}
+
+// concretize returns the value of e in the model of p, constraining e to
+// it.
+func (x *explorer) concretize(p *symPath, e *expr) uint16 {
+	if e.concrete() {
+		return e.value
+	}
+	x.extend(p)
+	value := e.eval(p.model)
+	p.constraints = append(p.constraints, equal(e, value))
+	return value
+}
+
+// input returns a new character read by p, or nil past the input limit.
+func (x *explorer) input(p *symPath) *expr {
+	if len(p.inputs) == x.cfg.MaxInput {
+		x.incomplete = true
+		return nil
+	}
+	v := x.newVar(p, symVar{max: 0xff, input: true})
+	p.inputs = append(p.inputs, v)
+	return variable(v)
+}
+
+// read returns the word at address without side effects.
+func (x *explorer) read(p *symPath, address uint16) *expr {
+	if e, ok := p.memory[address]; ok {
+		return e
+	}
+	return constant(x.vm.memory[address])
+}
+
+// load returns the word at address for a load instruction. Reading KBSR
+// latches a new character into KBDR, the keyboard being always ready until
+// the input limit.
+func (x *explorer) load(p *symPath, address *expr) *expr {
+	switch a := x.concretize(p, address); a {
+	case MemoryKBSR:
+		if p.latched = x.input(p); p.latched == nil {
+			return constant(0)
+		}
+		return constant(1 << 15)
+	case MemoryKBDR:
+		if p.latched == nil {
+			return constant(0)
+		}
+		return p.latched
+	default:
+		return x.read(p, a)
+	}
+}
+
+// store writes value at address. Writes to device registers are dropped.
+func (x *explorer) store(p *symPath, address *expr, value *expr) {
+	if a := x.concretize(p, address); a <= UserMemoryLimit {
+		p.memory[a] = value
+	}
+}
+
+// report records a finding at the PC of p, once per kind and address.
+func (x *explorer) report(kind FindingKind, p *symPath, inst uint16) {
+	pc := p.pc
+	if x.found[[2]uint16{uint16(kind), pc}] {
+		return
+	}
+	x.found[[2]uint16{uint16(kind), pc}] = true
+
+	f := Finding{Kind: kind, PC: pc, Inst: inst, Steps: p.steps}
+	for _, v := range p.inputs {
+		f.Input = append(f.Input, byte(p.model[v]))
+	}
+	if len(x.registers) > 0 {
+		f.Registers = map[Register]uint16{}
+		for reg, v := range x.registers {
+			f.Registers[reg] = p.model[v]
+		}
+	}
+	if len(x.memory) > 0 {
+		f.Memory = map[uint16]uint16{}
+		for address, v := range x.memory {
+			f.Memory[address] = p.model[v]
+		}
+	}
+	x.result.Findings = append(x.result.Findings, f)
+}
@@ -0,0 +1,115 @@
+package lc3_test
+
+import (
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplore(t *testing.T) {
+	// Reads "ko", then executes a reserved opcode.
+	password := []uint16{
+		0xf020, // GETC
+		0x2208, // LD R1, NEGK
+		0x1201, // ADD R1, R0, R1
+		0x0a05, // BRnp FAIL
+		0xf020, // GETC
+		0x2205, // LD R1, NEGO
+		0x1201, // ADD R1, R0, R1
+		0x0a01, // BRnp FAIL
+		0xd000, // reserved opcode
+		0xf025, // FAIL HALT
+		0xff95, // NEGK .FILL #-107
+		0xff91, // NEGO .FILL #-111
+	}
+
+	t.Run("find input reaching targets and illegal instructions", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithMemory(0x3000, password...))
+		require.NoError(t, err)
+		x, err := vm.Explore(lc3.SymbolicConfig{Targets: []uint16{0x3004}})
+		require.NoError(t, err)
+		assert.True(t, x.Complete)
+		assert.Equal(t, 3, x.Paths)
+		assert.Equal(t, []lc3.Finding{
+			{Kind: lc3.FindingTarget, PC: 0x3004, Inst: 0xf020, Input: []byte("k"), Steps: 4},
+			{Kind: lc3.FindingIllegal, PC: 0x3008, Inst: 0xd000, Input: []byte("ko"), Steps: 8},
+		}, x.Findings)
+		assert.Equal(t, `illegal instruction xD000 at x3008 with input "ko"`, x.Findings[1].String())
+		assert.Equal(t, uint16(0x3000), vm.GetRegister(lc3.RegisterPC))
+
+		replay, err := lc3.New(lc3.WithMemory(0x3000, password...), lc3.WithInput(strings.NewReader("ko")))
+		require.NoError(t, err)
+		assert.Error(t, replay.Run())
+		assert.Equal(t, uint16(0x3008), replay.GetRegister(lc3.RegisterPC))
+	})
+
+	t.Run("solve symbolic registers", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithMemory(0x3000,
+			0x546f, // AND R2, R1, #15
+			0x14bd, // ADD R2, R2, #-3
+			0x0a01, // BRnp END
+			0x16e0, // ADD R3, R3, #0
+			0xf025, // END HALT
+		))
+		require.NoError(t, err)
+		x, err := vm.Explore(lc3.SymbolicConfig{Registers: []lc3.Register{lc3.RegisterR1}, Targets: []uint16{0x3003}})
+		require.NoError(t, err)
+		require.Len(t, x.Findings, 1)
+		assert.Equal(t, map[lc3.Register]uint16{lc3.RegisterR1: 3}, x.Findings[0].Registers)
+		assert.Equal(t, `x3003 reached with input "", R1=x0003`, x.Findings[0].String())
+	})
+
+	t.Run("read the keyboard registers and symbolic memory", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithMemory(0x3000,
+			0xa007, // POLL LDI R0, KBSRP
+			0x07fe, // BRzp POLL
+			0xa006, // LDI R0, KBDRP
+			0x2206, // LD R1, KEY
+			0x1201, // ADD R1, R0, R1
+			0x0a01, // BRnp END
+			0xd000, // reserved opcode
+			0xf025, // END HALT
+			0xfe00, // KBSRP .FILL xFE00
+			0xfe02, // KBDRP .FILL xFE02
+			0x0000, // KEY .FILL 0
+		))
+		require.NoError(t, err)
+		x, err := vm.Explore(lc3.SymbolicConfig{Memory: []lc3.DataRegion{{Origin: 0x300a, Size: 1}}})
+		require.NoError(t, err)
+		require.Len(t, x.Findings, 1)
+		f := x.Findings[0]
+		assert.Equal(t, lc3.FindingIllegal, f.Kind)
+		assert.Equal(t, uint16(0), uint16(f.Input[0])+f.Memory[0x300a])
+	})
+
+	t.Run("bound input and paths", func(t *testing.T) {
+		// Echoes characters until a newline.
+		vm, err := lc3.New(lc3.WithMemory(0x3000,
+			0xf020, // LOOP GETC
+			0x1236, // ADD R1, R0, #-10
+			0x0bfd, // BRnp LOOP
+			0xf025, // HALT
+		))
+		require.NoError(t, err)
+		x, err := vm.Explore(lc3.SymbolicConfig{MaxInput: 4, Targets: []uint16{0x3003}})
+		require.NoError(t, err)
+		assert.False(t, x.Complete)
+		require.Len(t, x.Findings, 1)
+		assert.Equal(t, []byte("\n"), x.Findings[0].Input)
+
+		x, err = vm.Explore(lc3.SymbolicConfig{MaxPaths: 2})
+		require.NoError(t, err)
+		assert.False(t, x.Complete)
+		assert.Equal(t, 2, x.Paths)
+	})
+
+	t.Run("reject non general purpose registers", func(t *testing.T) {
+		vm, err := lc3.New()
+		require.NoError(t, err)
+		_, err = vm.Explore(lc3.SymbolicConfig{Registers: []lc3.Register{lc3.RegisterPC}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,88 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadSymbolFile reads a symbol table in the .sym format written by lc3as:
+// comment lines holding a symbol name and its hexadecimal address.
+func ReadSymbolFile(r io.Reader) ([]Symbol, error) {
+	var symbols []Symbol
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "//"))
+		if len(fields) != 2 || fields[0] == "Symbol" || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		digits := strings.TrimPrefix(strings.TrimPrefix(fields[1], "x"), "X")
+		address, err := strconv.ParseUint(digits, 16, 16)
+		if err != nil {
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid address %q", fields[1])}
+		}
+		symbols = append(symbols, Symbol{Name: fields[0], Address: uint16(address), Kind: SymbolGlobal})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading symbols: %w", err)
+	}
+	return symbols, nil
+}
+
+// ParseAddress parses an address in LC-3 style (x3000), Go style (0x3000) or
+// decimal.
+func ParseAddress(s string) (uint16, error) {
+	if len(s) > 1 && (s[0] == 'x' || s[0] == 'X') {
+		s = "0x" + s[1:]
+	}
+	value, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint16(value), nil
+}
+
+// SymbolTable names addresses after the closest symbol at or below them.
+type SymbolTable struct {
+	symbols []Symbol
+}
+
+// NewSymbolTable builds a table from symbols, ignoring external ones.
+func NewSymbolTable(symbols ...Symbol) *SymbolTable {
+	t := &SymbolTable{}
+	for _, sym := range symbols {
+		if sym.Kind != SymbolExternal {
+			t.symbols = append(t.symbols, sym)
+		}
+	}
+	sort.SliceStable(t.symbols, func(i, j int) bool { return t.symbols[i].Address < t.symbols[j].Address })
+	return t
+}
+
+// Lookup returns the closest symbol at or below address.
+func (t *SymbolTable) Lookup(address uint16) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+	i := sort.Search(len(t.symbols), func(i int) bool { return t.symbols[i].Address > address })
+	if i == 0 {
+		return Symbol{}, false
+	}
+	return t.symbols[i-1], true
+}
+
+// Name returns "LABEL" or "LABEL+N" for address, or "xNNNN" when no symbol
+// precedes it.
+func (t *SymbolTable) Name(address uint16) string {
+	sym, ok := t.Lookup(address)
+	if !ok {
+		return fmt.Sprintf("x%04X", address)
+	}
+	if sym.Address == address {
+		return sym.Name
+	}
+	return fmt.Sprintf("%s+%d", sym.Name, address-sym.Address)
+}
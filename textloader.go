@@ -0,0 +1,246 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError reports malformed input in a text image.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ReadHex reads a text image with one hexadecimal word per line, as produced
+// by lc3tools and the web simulator. The first word is the origin. Words may
+// be prefixed with x or 0x; blank lines and ';' comments are ignored.
+func ReadHex(r io.Reader) (Segment, error) {
+	return readTextImage(r, func(s string) (uint64, error) {
+		s = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "x")
+		if len(s) > 4 {
+			return 0, fmt.Errorf("%q has more than 4 digits", s)
+		}
+		return strconv.ParseUint(s, 16, 16)
+	})
+}
+
+// ReadBin reads a text image with one word of 16 binary digits per line. The
+// first word is the origin. Blank lines and ';' comments are ignored.
+func ReadBin(r io.Reader) (Segment, error) {
+	return readTextImage(r, func(s string) (uint64, error) {
+		if len(s) != 16 {
+			return 0, fmt.Errorf("%q is not 16 binary digits", s)
+		}
+		return strconv.ParseUint(s, 2, 16)
+	})
+}
+
+func readTextImage(r io.Reader, parse func(string) (uint64, error)) (Segment, error) {
+	var seg Segment
+	scanner := bufio.NewScanner(r)
+	hasOrigin := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		value, err := parse(text)
+		if err != nil {
+			if numErr, ok := err.(*strconv.NumError); ok {
+				err = numErr.Err
+			}
+			return Segment{}, &SyntaxError{Line: line, Msg: fmt.Sprintf("invalid word %q: %v", text, err)}
+		}
+		if !hasOrigin {
+			seg.Origin, hasOrigin = uint16(value), true
+			continue
+		}
+		seg.Words = append(seg.Words, uint16(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return Segment{}, err
+	}
+	if !hasOrigin {
+		return Segment{}, fmt.Errorf("Failed to read orig value from program: %v", io.EOF)
+	}
+
+	return seg, nil
+}
+
+// ReadIntelHex reads an Intel HEX file. Its byte addresses are mapped to LC-3
+// words by halving them, each word being stored big-endian, so every word must
+// be fully defined. Contiguous words are returned as one segment.
+func ReadIntelHex(r io.Reader) ([]Segment, error) {
+	image := map[uint32]imageByte{}
+	var base uint32
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		record, err := parseIntelHexRecord(text)
+		if err != nil {
+			return nil, &SyntaxError{Line: line, Msg: err.Error()}
+		}
+		address := uint32(record[1])<<8 | uint32(record[2])
+		data := record[4 : len(record)-1]
+
+		switch kind := record[3]; kind {
+		case 0x00:
+			for i, b := range data {
+				image[base+address+uint32(i)] = imageByte{b, line}
+			}
+		case 0x01:
+			return intelHexSegments(image)
+		case 0x02, 0x04:
+			if len(data) != 2 {
+				return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("record type %02X needs 2 data bytes", kind)}
+			}
+			base = uint32(data[0])<<8 | uint32(data[1])
+			if kind == 0x02 {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case 0x03, 0x05:
+			// Start address records have no meaning for the LC-3.
+		default:
+			return nil, &SyntaxError{Line: line, Msg: fmt.Sprintf("unknown record type %02X", kind)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, &SyntaxError{Line: line, Msg: "missing end of file record"}
+}
+
+// parseIntelHexRecord decodes and checks a ":LLAAAATTDD...CC" record, returning
+// its bytes.
+func parseIntelHexRecord(text string) ([]byte, error) {
+	if text[0] != ':' {
+		return nil, fmt.Errorf("record doesn't start with ':'")
+	}
+	text = text[1:]
+	if len(text)%2 != 0 || len(text) < 10 {
+		return nil, fmt.Errorf("invalid record length %d", len(text))
+	}
+
+	record := make([]byte, len(text)/2)
+	var sum byte
+	for i := range record {
+		b, err := strconv.ParseUint(text[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex digits %q", text[2*i:2*i+2])
+		}
+		record[i] = byte(b)
+		sum += byte(b)
+	}
+	if int(record[0]) != len(record)-5 {
+		return nil, fmt.Errorf("byte count %d doesn't match %d data bytes", record[0], len(record)-5)
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("bad checksum %02X", record[len(record)-1])
+	}
+	return record, nil
+}
+
+// imageByte is a byte of an Intel HEX file, with the line of its record.
+type imageByte struct {
+	value byte
+	line  int
+}
+
+func intelHexSegments(image map[uint32]imageByte) ([]Segment, error) {
+	addresses := make([]uint32, 0, len(image))
+	for address := range image {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+	var segments []Segment
+	for i := 0; i < len(addresses); i += 2 {
+		address := addresses[i]
+		if address%2 != 0 || i+1 >= len(addresses) || addresses[i+1] != address+1 {
+			return nil, &SyntaxError{Line: image[address].line, Msg: fmt.Sprintf("incomplete word at byte address 0x%X", address&^1)}
+		}
+		word := address / 2
+		if word >= uint32(MemorySize) {
+			return nil, &SyntaxError{Line: image[address].line, Msg: fmt.Sprintf("byte address 0x%X is out of the LC-3 memory", address)}
+		}
+		value := uint16(image[address].value)<<8 | uint16(image[address+1].value)
+
+		if n := len(segments); n > 0 && uint32(segments[n-1].Origin)+uint32(len(segments[n-1].Words)) == word {
+			segments[n-1].Words = append(segments[n-1].Words, value)
+		} else {
+			segments = append(segments, Segment{Origin: uint16(word), Words: []uint16{value}})
+		}
+	}
+
+	return segments, nil
+}
+
+// ReadProgramFile reads a program file, choosing its format from the file
+// extension: .hex and .bin text images, .ihx and .ihex Intel HEX, and the
+// formats understood by ReadProgram otherwise.
+func ReadProgramFile(path string) (*Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadNamedProgram(path, f)
+}
+
+// ReadNamedProgram reads a program from r, choosing its format from the
+// extension of name like ReadProgramFile, e.g. for files uploaded to a web
+// page.
+func ReadNamedProgram(name string, r io.Reader) (*Object, error) {
+	var obj *Object
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".hex":
+		var seg Segment
+		if seg, err = ReadHex(r); err == nil {
+			obj = ObjectFromSegment(seg)
+		}
+	case ".bin":
+		var seg Segment
+		if seg, err = ReadBin(r); err == nil {
+			obj = ObjectFromSegment(seg)
+		}
+	case ".ihx", ".ihex":
+		var segments []Segment
+		if segments, err = ReadIntelHex(r); err == nil {
+			obj = &Object{}
+			for i, seg := range segments {
+				obj.Sections = append(obj.Sections, Section{Name: fmt.Sprintf(".text%d", i), Origin: seg.Origin, Words: seg.Words})
+			}
+		}
+	default:
+		obj, err = ReadProgram(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,102 @@
+package lc3_test
+
+import (
+	"strings"
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextLoaders(t *testing.T) {
+	t.Run("read hex image", func(t *testing.T) {
+		image := "x3000\n; comment\n\n1021 ; ADD R0, R0, #1\n0xF025\n"
+
+		seg, err := lc3.ReadHex(strings.NewReader(image))
+		assert.NoError(t, err)
+		assert.Equal(t, lc3.Segment{Origin: 0x3000, Words: []uint16{0x1021, 0xf025}}, seg)
+	})
+
+	t.Run("read bin image", func(t *testing.T) {
+		image := "0011000000000000\n0001000000100001\n1111000000100101\n"
+
+		seg, err := lc3.ReadBin(strings.NewReader(image))
+		assert.NoError(t, err)
+		assert.Equal(t, lc3.Segment{Origin: 0x3000, Words: []uint16{0x1021, 0xf025}}, seg)
+	})
+
+	t.Run("report malformed text images with line numbers", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			read  func(string) error
+			image string
+			line  int
+		}{
+			{"hex with bad digit", readHex, "3000\n\n1g21\n", 3},
+			{"hex too long", readHex, "3000\n10210\n", 2},
+			{"bin too short", readBin, "0011000000000000\n0101\n", 2},
+			{"bin with bad digit", readBin, "0011000000000002\n", 1},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				err := test.read(test.image)
+				var syntax *lc3.SyntaxError
+				if assert.ErrorAs(t, err, &syntax) {
+					assert.Equal(t, test.line, syntax.Line)
+				}
+			})
+		}
+
+		assert.Error(t, readHex("; only a comment\n"))
+	})
+
+	t.Run("read Intel HEX", func(t *testing.T) {
+		// x3000: ADD R0, R0, #1; HALT, then x3100: .FILL x1234
+		image := ":046000001021F02556\n" +
+			":02620000123456\n" +
+			":00000001FF\n"
+
+		segments, err := lc3.ReadIntelHex(strings.NewReader(image))
+		assert.NoError(t, err)
+		assert.Equal(t, []lc3.Segment{
+			{Origin: 0x3000, Words: []uint16{0x1021, 0xf025}},
+			{Origin: 0x3100, Words: []uint16{0x1234}},
+		}, segments)
+	})
+
+	t.Run("report malformed Intel HEX", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			image string
+			line  int
+		}{
+			{"bad checksum", ":046000001021F02557\n", 1},
+			{"no colon", ":046000001021F02556\n046000001021F02556\n", 2},
+			{"bad byte count", "\n:056000001021F02555\n", 2},
+			{"missing end", ":046000001021F02556\n", 1},
+			{"half a word", ":046000001021F02556\n:01600400108B\n:00000001FF\n", 2},
+			{"out of memory", ":020000040002F8\n\n:02000000102FBF\n:00000001FF\n", 3},
+		}
+
+		for _, test := range testCases {
+			t.Run(test.name, func(t *testing.T) {
+				_, err := lc3.ReadIntelHex(strings.NewReader(test.image))
+				var syntax *lc3.SyntaxError
+				if assert.ErrorAs(t, err, &syntax) {
+					assert.Equal(t, test.line, syntax.Line)
+				}
+			})
+		}
+	})
+}
+
+func readHex(image string) error {
+	_, err := lc3.ReadHex(strings.NewReader(image))
+	return err
+}
+
+func readBin(image string) error {
+	_, err := lc3.ReadBin(strings.NewReader(image))
+	return err
+}
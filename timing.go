@@ -0,0 +1,194 @@
+package lc3
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+)
+
+// TimingModel describes the cost of memory accesses for cycle counting. Each
+// instruction is charged the states it goes through in the LC-3 state
+// machine: one cycle per state, except memory states which wait for the
+// ready bit during the configured latency.
+//
+// TRAP routines implemented in Go are charged as the TRAP instruction alone.
+type TimingModel struct {
+	// MemoryLatency is the number of cycles of a memory state; at least 1.
+	MemoryLatency int
+	// DeviceLatency is the number of cycles of a memory state accessing a
+	// device register; at least 1.
+	DeviceLatency int
+}
+
+// DefaultTimingModel has a 5 cycles memory and fast devices.
+var DefaultTimingModel = TimingModel{MemoryLatency: 5, DeviceLatency: 1}
+
+// OpcodeStats counts the executions of an opcode and the cycles they took.
+type OpcodeStats struct {
+	Count  uint64
+	Cycles uint64
+}
+
+// ErrNoTiming is returned when scheduling events without a timing model.
+var ErrNoTiming = errors.New("no timing model")
+
+// fetchStates are the non-memory states of fetch and decode: 18, 35 and 32.
+const fetchStates = 3
+
+// exceptionStates are the non-memory states initiating an exception or an
+// interrupt.
+const exceptionStates = 6
+
+// opStates are the non-memory states of each opcode after decode. BR takes
+// one more state when the branch is taken.
+var opStates = [16]uint64{
+	OperationBR:   1,
+	OperationADD:  1,
+	OperationLD:   2,
+	OperationST:   2,
+	OperationJSR:  2,
+	OperationAND:  1,
+	OperationLDR:  2,
+	OperationSTR:  2,
+	OperationRTI:  6,
+	OperationNOT:  1,
+	OperationLDI:  3,
+	OperationSTI:  3,
+	OperationJMP:  1,
+	OperationRES:  0,
+	OperationLEA:  1,
+	OperationTRAP: 2,
+}
+
+type timing struct {
+	model  TimingModel
+	cycles uint64
+	// waits are the memory cycles of the instruction being executed.
+	waits uint64
+	// start is the cycle count when the microcode engine started the
+	// current instruction.
+	start  uint64
+	stats  [16]OpcodeStats
+	events eventQueue
+}
+
+// WithTiming enables cycle counting with the given timing model. The JIT
+// engine falls back to the interpreter when it is enabled.
+func WithTiming(model TimingModel) Option {
+	return func(o *options) {
+		o.setup = append(o.setup, func(v *VM) error {
+			if model.MemoryLatency < 1 || model.DeviceLatency < 1 {
+				return fmt.Errorf("invalid timing model latencies: %+v", model)
+			}
+			v.timing = &timing{model: model}
+			return nil
+		})
+	}
+}
+
+// Cycles returns the number of cycles elapsed, or 0 without a timing model.
+func (v *VM) Cycles() uint64 {
+	if v.timing == nil {
+		return 0
+	}
+	return v.timing.cycles
+}
+
+// CycleStats returns the execution count and cycles of each opcode executed,
+// by opcode name.
+func (v *VM) CycleStats() map[string]OpcodeStats {
+	stats := map[string]OpcodeStats{}
+	if v.timing == nil {
+		return stats
+	}
+	for op, s := range v.timing.stats {
+		if s.Count > 0 {
+			stats[opNames[uint8(op)]] = s
+		}
+	}
+	return stats
+}
+
+// Schedule calls event once the cycle counter reaches cycle, after the
+// instruction executing at that time. Events scheduled in the past run after
+// the next instruction.
+func (v *VM) Schedule(cycle uint64, event func(v *VM)) error {
+	if v.timing == nil {
+		return ErrNoTiming
+	}
+	heap.Push(&v.timing.events, scheduledEvent{cycle: cycle, seq: v.timing.events.seq, run: event})
+	v.timing.events.seq++
+	return nil
+}
+
+// memoryAccess charges a memory state accessing address.
+func (v *VM) memoryAccess(address uint16) {
+	if v.timing == nil {
+		return
+	}
+	if address > UserMemoryLimit {
+		v.timing.waits += uint64(v.timing.model.DeviceLatency)
+	} else {
+		v.timing.waits += uint64(v.timing.model.MemoryLatency)
+	}
+}
+
+// chargeInstruction accounts for an executed instruction, then runs the
+// events that are due.
+func (v *VM) chargeInstruction(op uint8, branchTaken bool) {
+	t := v.timing
+	cycles := fetchStates + opStates[op] + t.waits
+	if branchTaken {
+		cycles++
+	}
+	t.stats[op].Count++
+	t.stats[op].Cycles += cycles
+	v.advance(cycles)
+}
+
+// chargeException accounts for an instruction interrupted by an exception,
+// or for an interrupt initiation.
+func (v *VM) chargeException() {
+	v.advance(exceptionStates + v.timing.waits)
+}
+
+func (v *VM) advance(cycles uint64) {
+	t := v.timing
+	t.cycles += cycles
+	t.waits = 0
+	for t.events.Len() > 0 && t.events.items[0].cycle <= t.cycles {
+		event := heap.Pop(&t.events).(scheduledEvent)
+		event.run(v)
+	}
+}
+
+type scheduledEvent struct {
+	cycle uint64
+	// seq keeps events scheduled for the same cycle in order.
+	seq uint64
+	run func(v *VM)
+}
+
+type eventQueue struct {
+	items []scheduledEvent
+	seq   uint64
+}
+
+func (q eventQueue) Len() int { return len(q.items) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q.items[i].cycle != q.items[j].cycle {
+		return q.items[i].cycle < q.items[j].cycle
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *eventQueue) Push(x any) { q.items = append(q.items, x.(scheduledEvent)) }
+
+func (q *eventQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
@@ -0,0 +1,118 @@
+package lc3_test
+
+import (
+	"testing"
+
+	lc3 "github.com/kroosec/lc3vm-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiming(t *testing.T) {
+	t.Run("charge instructions their states and memory latency", func(t *testing.T) {
+		for _, engine := range []lc3.Engine{lc3.EngineInterpreter, lc3.EngineJIT} {
+			vm, err := lc3.New(
+				lc3.WithEngine(engine),
+				lc3.WithTiming(lc3.TimingModel{MemoryLatency: 5, DeviceLatency: 1}),
+				lc3.WithMemory(0x3000,
+					0x5020, // AND R0, R0, #0: 3+1 states, fetch
+					0x2202, // LD R1, #2: 3+2 states, fetch and load
+					0x0401, // BRz #1: 3+2 states when taken, fetch
+					0x1021, // ADD R0, R0, #1: skipped
+					0x0000, // NOP: 3+1 states, fetch
+					0xf025, // HALT: 3+2 states, fetch and trap vector
+				),
+			)
+			assert.NoError(t, err)
+			assert.NoError(t, vm.Run())
+
+			assert.Equal(t, uint64(58), vm.Cycles())
+			assert.Equal(t, map[string]lc3.OpcodeStats{
+				"AND":  {Count: 1, Cycles: 9},
+				"LD":   {Count: 1, Cycles: 15},
+				"BR":   {Count: 2, Cycles: 19},
+				"TRAP": {Count: 1, Cycles: 15},
+			}, vm.CycleStats())
+		}
+	})
+
+	t.Run("charge device registers their own latency", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithTiming(lc3.TimingModel{MemoryLatency: 5, DeviceLatency: 1}),
+			lc3.WithMemory(0x3000, 0xa000, 0xfe00), // LDI R0, #0
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, uint64(3+3+5+5+1), vm.Cycles())
+	})
+
+	t.Run("don't count without a timing model", func(t *testing.T) {
+		vm, err := lc3.New(lc3.WithMemory(0x3000, 0x5020))
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, uint64(0), vm.Cycles())
+		assert.Empty(t, vm.CycleStats())
+		assert.ErrorIs(t, vm.Schedule(10, func(*lc3.VM) {}), lc3.ErrNoTiming)
+	})
+
+	t.Run("reject invalid latencies", func(t *testing.T) {
+		_, err := lc3.New(lc3.WithTiming(lc3.TimingModel{}))
+		assert.Error(t, err)
+	})
+
+	t.Run("run scheduled events in cycle order", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithTiming(lc3.DefaultTimingModel),
+			lc3.WithMemory(0x3000, 0x0fff), // BRnzp #-1
+		)
+		assert.NoError(t, err)
+
+		var fired []uint64
+		record := func(v *lc3.VM) { fired = append(fired, v.Cycles()) }
+		assert.NoError(t, vm.Schedule(25, record))
+		assert.NoError(t, vm.Schedule(5, record))
+		assert.NoError(t, vm.Schedule(25, func(v *lc3.VM) { v.Halt() }))
+
+		assert.NoError(t, vm.Run())
+		assert.Equal(t, []uint64{10, 30}, fired)
+	})
+
+	t.Run("deliver a scheduled interrupt", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithTiming(lc3.DefaultTimingModel),
+			lc3.WithMemory(0x3000, 0x0fff), // BRnzp #-1
+			lc3.WithMemory(0x0180, 0x1000),
+			lc3.WithMemory(0x1000, 0xf025), // HALT
+			lc3.WithRegister(lc3.RegisterR6, 0x4000),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.Schedule(25, func(v *lc3.VM) {
+			assert.NoError(t, v.RequestInterrupt(0x80, 4))
+		}))
+
+		assert.NoError(t, vm.Run())
+		assert.True(t, vm.Privileged())
+		assert.Equal(t, uint16(4<<8), vm.PSR()&0x0700)
+		assert.Equal(t, uint16(0x1001), vm.GetRegister(lc3.RegisterPC))
+		assert.Equal(t, lc3.DefaultSupervisorStack-2, vm.GetRegister(lc3.RegisterR6))
+		saved, err := vm.GetMemory(lc3.DefaultSupervisorStack - 2)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0x3000), saved)
+
+		// Three branches, the interrupt initiation and HALT.
+		assert.Equal(t, uint64(3*10+(6+3*5)+15), vm.Cycles())
+	})
+
+	t.Run("hold interrupts at or below the priority level", func(t *testing.T) {
+		vm, err := lc3.New(
+			lc3.WithSupervisorMode(),
+			lc3.WithMemory(0x3000, 0x5020),
+			lc3.WithMemory(0x0180, 0x1000),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, vm.RequestInterrupt(0x80, 0))
+		assert.Error(t, vm.RequestInterrupt(0x80, 8))
+
+		assert.NoError(t, vm.Step())
+		assert.Equal(t, uint16(0x3001), vm.GetRegister(lc3.RegisterPC))
+	})
+}
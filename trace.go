@@ -0,0 +1,61 @@
+package lc3
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer is called after each instruction the VM executes, with the address
+// and value of the instruction. The VM state is the one after execution.
+type Tracer interface {
+	Trace(v *VM, pc uint16, inst uint16)
+}
+
+// TracerFunc adapts a function to the Tracer interface.
+type TracerFunc func(v *VM, pc uint16, inst uint16)
+
+func (f TracerFunc) Trace(v *VM, pc uint16, inst uint16) {
+	f(v, pc, inst)
+}
+
+type textTracer struct {
+	w io.Writer
+	// sp is R6 after the previous instruction.
+	sp uint16
+}
+
+// NewTextTracer returns a tracer writing one line per instruction to w: its
+// address, value and disassembly, followed by the resulting registers. With a
+// stack guard, the stack is written after each JSR, RET or change of R6.
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+func (t *textTracer) Trace(v *VM, pc uint16, inst uint16) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "x%04X  %04X  %-20s", pc, inst, Disassemble(pc, inst))
+	for reg := RegisterR0; reg <= RegisterR7; reg++ {
+		fmt.Fprintf(&line, " %s=%04X", reg, v.GetRegister(reg))
+	}
+	fmt.Fprintf(&line, " PC=%04X %s\n", v.GetRegister(RegisterPC), flagNames(v.GetRegister(RegisterCOND)))
+	io.WriteString(t.w, line.String())
+
+	sp := v.GetRegister(RegisterR6)
+	if v.stackGuard != nil && (sp != t.sp || inst>>12 == OperationJSR || inst == instRET) {
+		v.WriteStack(t.w)
+	}
+	t.sp = sp
+}
+
+func flagNames(cond uint16) string {
+	switch cond {
+	case FlagN:
+		return "N"
+	case FlagZ:
+		return "Z"
+	case FlagP:
+		return "P"
+	}
+	return "?"
+}
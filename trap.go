@@ -1,13 +1,35 @@
 package lc3
 
 import (
+	"errors"
 	"fmt"
 )
 
+// TrapHandler implements a trap routine in Go. PC already points to the TRAP
+// instruction and is incremented past it once the handler returns.
+type TrapHandler func(v *VM) error
+
+func defaultTrapHandlers() map[uint8]TrapHandler {
+	return map[uint8]TrapHandler{
+		TrapGETC:  (*VM).trapGetc,
+		TrapOUT:   (*VM).trapOut,
+		TrapPUTS:  (*VM).trapPuts,
+		TrapIN:    (*VM).trapIn,
+		TrapPUTSP: (*VM).trapPutsp,
+		TrapHALT:  func(v *VM) error { v.trapHalt(); return nil },
+	}
+}
+
+// ErrNoInput is returned by input readers that can't block, e.g. in a
+// browser, when no character is available yet. The keyboard status register
+// then reports no key, and GETC and IN fail with it before reading, leaving PC
+// on the TRAP to execute it again once input is available.
+var ErrNoInput = errors.New("no input available")
+
 func (v *VM) trapGetc() error {
 	char, err := v.getChar()
 	if err != nil {
-		return fmt.Errorf("couldn't read input: %v", err)
+		return fmt.Errorf("couldn't read input: %w", err)
 	}
 	v.SetRegister(RegisterR0, uint16(char))
 	return nil
@@ -31,9 +53,60 @@ func (v *VM) trapOut() error {
 }
 
 func (v *VM) trapHalt() {
+	v.Halt()
+}
+
+// Halt stops the VM, e.g. from a trap handler.
+func (v *VM) Halt() {
 	v.state = StateHalted
 }
 
+func (v *VM) trapIn() error {
+	// The prompt was already written if the previous attempt ran out of
+	// input.
+	if !v.inputPending {
+		if _, err := fmt.Fprint(v.output, "Enter a character: "); err != nil {
+			return fmt.Errorf("couldn't write output: %v", err)
+		}
+	}
+	err := v.trapGetc()
+	v.inputPending = errors.Is(err, ErrNoInput)
+	if err != nil {
+		return err
+	}
+	return v.trapOut()
+}
+
+func (v *VM) trapPutsp() error {
+	address := v.GetRegister(RegisterR0)
+
+	var out []byte
+	for {
+		value, err := v.GetMemory(address)
+		if err != nil {
+			return err
+		}
+		if value == 0 {
+			break
+		}
+
+		out = append(out, byte(value))
+		if value>>8 == 0 {
+			break
+		}
+		out = append(out, byte(value>>8))
+		if address == UserMemoryLimit {
+			break
+		}
+		address++
+	}
+
+	if _, err := v.output.Write(out); err != nil {
+		return fmt.Errorf("Couldn't write output %v: %v", out, err)
+	}
+	return nil
+}
+
 func (v *VM) trapPuts() error {
 	address := v.GetRegister(RegisterR0)
 
@@ -48,7 +121,7 @@ func (v *VM) trapPuts() error {
 		}
 
 		if value > 0xff {
-			return fmt.Errorf("Invalid character in string: 0x%x", value)
+			return &invalidCharacterError{value: value}
 		}
 
 		out = append(out, byte(value))
@@ -67,4 +140,13 @@ func (v *VM) trapPuts() error {
 func (v *VM) peekChar() bool {
 	_, err := v.input.Peek(1)
 	return err == nil
-}
\ No newline at end of file
+}
+
+// invalidCharacterError is a word of a PUTS string that isn't a character.
+type invalidCharacterError struct {
+	value uint16
+}
+
+func (e *invalidCharacterError) Error() string {
+	return fmt.Sprintf("Invalid character in string: 0x%x", e.value)
+}